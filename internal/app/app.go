@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,9 +15,11 @@ import (
 
 	"github.com/shaibs3/Guardz/internal/handlers"
 	"github.com/shaibs3/Guardz/internal/router"
+	"github.com/shaibs3/Guardz/internal/service_health"
 	"golang.org/x/time/rate"
 
 	"github.com/shaibs3/Guardz/internal/config"
+	guardzlogger "github.com/shaibs3/Guardz/internal/logger"
 	"github.com/shaibs3/Guardz/internal/lookup"
 	"github.com/shaibs3/Guardz/internal/telemetry"
 	"go.uber.org/zap"
@@ -26,14 +31,31 @@ type App struct {
 	logger    *zap.Logger
 	telemetry *telemetry.Telemetry
 	server    *http.Server
+	db        lookup.DbProvider
+	audit     *zap.Logger
+	handler   *handlers.DynamicHandler
 }
 
 func NewApp(cfg *config.Config, logger *zap.Logger) (*App, error) {
-	// Initialize telemetry
-	tel, err := telemetry.NewTelemetry(logger)
+	// Initialize telemetry, pushing metrics over OTLP as well when an endpoint is set
+	metricExporter, err := telemetry.NewOTLPMetricExporter(context.Background(), cfg.MetricsOTLPEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid METRICS_OTLP_ENDPOINT: %w", err)
+	}
+	tel, err := telemetry.NewTelemetry(logger, telemetry.MetricExport{
+		Exporter:  metricExporter,
+		Interval:  cfg.MetricsExportInterval,
+		BatchSize: cfg.MetricsExportBatchSize,
+	})
 	if err != nil {
 		return nil, err
 	}
+	tel.MetricsNamespace = cfg.MetricsNamespace
+	spanExporter, err := telemetry.NewOTLPSpanExporter(context.Background(), cfg.TracesOTLPEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRACES_OTLP_ENDPOINT: %w", err)
+	}
+	tel.SetupTracing(cfg.TraceSampleRatio, spanExporter)
 
 	// Use the factory to create the DB provider
 	factory := lookup.NewDbProviderFactory(logger, tel)
@@ -54,15 +76,127 @@ func NewApp(cfg *config.Config, logger *zap.Logger) (*App, error) {
 		return nil, err
 	}
 
+	if cfg.OutboundSourceIP != "" && net.ParseIP(cfg.OutboundSourceIP) == nil {
+		return nil, fmt.Errorf("invalid OUTBOUND_SOURCE_IP %q", cfg.OutboundSourceIP)
+	}
+	outboundProxy, err := handlers.ParseOutboundProxy(cfg.OutboundProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUTBOUND_PROXY: %w", err)
+	}
+	invalidUTF8Policy, err := handlers.ParseInvalidUTF8Policy(cfg.InvalidUTF8Policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid INVALID_UTF8_POLICY: %w", err)
+	}
+	cookieJarScope, err := handlers.ParseCookieJarScope(cfg.OutboundCookieJar)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUTBOUND_COOKIE_JAR: %w", err)
+	}
+
 	// Initialize router with handlers
 	var limiter = rate.NewLimiter(rate.Limit(cfg.RPSLimit), cfg.RPSBurst)
 
 	// Create handlers
+	dynamicHandler := handlers.NewDynamicHandler(dbProvider)
+	dynamicHandler.MaxConcurrentFetches = cfg.MaxConcurrentFetches
+	dynamicHandler.MaxConcurrentFetchesPerHost = cfg.MaxConcurrentFetchesPerHost
+	dynamicHandler.ResultBufferSize = cfg.ResultBufferSize
+	dynamicHandler.TextMIMEAllowlist = cfg.TextMIMEAllowlist
+	dynamicHandler.InvalidUTF8Policy = invalidUTF8Policy
+	dynamicHandler.CookieJarScope = cookieJarScope
+	dynamicHandler.ReadOnly = cfg.ReadOnly
+	dynamicHandler.AllowClearOnEmptyPost = cfg.AllowClearOnEmptyPost
+	dynamicHandler.AllowedOutboundMethods = cfg.AllowedOutboundMethods
+	dynamicHandler.MaxFetchTimeout = cfg.MaxFetchTimeout
+	dynamicHandler.MaxURLLength = cfg.MaxURLLength
+	dynamicHandler.MaxResponseHeaderBytes = cfg.MaxResponseHeaderBytes
+	dynamicHandler.OutboundSourceIP = cfg.OutboundSourceIP
+	dynamicHandler.OutboundProxy = outboundProxy
+	dynamicHandler.CrossHostRedirectLimit = cfg.CrossHostRedirectLimit
+	dynamicHandler.MaxOutboundBodyBytes = cfg.MaxOutboundBodyBytes
+	dynamicHandler.MaxDecompressionRatio = cfg.MaxDecompressionRatio
+	dynamicHandler.MaxDecompressedBytes = cfg.MaxDecompressedBytes
+	dynamicHandler.ReturnPartialReads = cfg.ReturnPartialReads
+	dynamicHandler.OutboundHeaderDenylist = cfg.OutboundHeaderDenylist
+	dynamicHandler.MaxQueryOverrides = cfg.MaxQueryOverrides
+	dynamicHandler.ResultCacheTTL = cfg.ResultCacheTTL
+	dynamicHandler.ResultCacheStaleWhileRevalidate = cfg.ResultCacheStaleWhileRevalidate
+	dynamicHandler.ResultCacheMaxEntries = cfg.ResultCacheMaxEntries
+	dynamicHandler.MetadataOnlyAboveBytes = cfg.MetadataOnlyAboveBytes
+	dynamicHandler.SkipFetchAboveBytes = cfg.SkipFetchAboveBytes
+	dynamicHandler.AllowedRedirectCodes = cfg.AllowedRedirectCodes
+	dynamicHandler.CorrelationIDHeader = cfg.CorrelationIDHeader
+	dynamicHandler.MaxConcurrentStores = cfg.MaxConcurrentStores
+	dynamicHandler.ValidationMetrics = handlers.NewValidationMetrics(tel.Meter, tel.MetricsNamespace, logger.Named("metrics"))
+
+	var auditLogger *zap.Logger
+	if cfg.AuditLog != "" {
+		auditLogger, err = guardzlogger.NewAuditLogger(cfg.AuditLog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log %q: %w", cfg.AuditLog, err)
+		}
+		dynamicHandler.AuditLogger = auditLogger
+	}
+	dynamicHandler.DefaultReferer = cfg.DefaultReferer
+	dynamicHandler.DefaultOrigin = cfg.DefaultOrigin
+	dynamicHandler.CanonicalizeURLs = cfg.CanonicalizeURLs
+	dynamicHandler.MaxGlobalFetches = cfg.MaxGlobalFetches
+	dynamicHandler.FetchQueueTimeout = cfg.FetchQueueTimeout
+	dynamicHandler.RetryAfterMax = cfg.RetryAfterMax
+
+	allowlistProfiles, err := handlers.ParseAllowlistProfiles(cfg.AllowlistProfiles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ALLOWLIST_PROFILES: %w", err)
+	}
+	dynamicHandler.AllowlistProfiles = allowlistProfiles
+	dynamicHandler.AllowlistProfileHeader = cfg.AllowlistProfileHeader
+	dynamicHandler.ExplicitRoutes = cfg.ExplicitRoutes
+	if len(cfg.MetadataEndpoints) > 0 {
+		dynamicHandler.MetadataEndpoints = cfg.MetadataEndpoints
+	}
+	dynamicHandler.CompressCachedContent = cfg.CompressCachedContent
+	dynamicHandler.HostPolicy = handlers.NewHostPolicy(cfg.HostAllowlist, cfg.HostDenylist)
+	dynamicHandler.HostBreakers = handlers.HostBreakerSettings{
+		FailureThreshold: uint32(max(cfg.HostBreakerFailureThreshold, 0)),
+		MaxRequests:      uint32(max(cfg.HostBreakerMaxRequests, 0)),
+		Interval:         cfg.HostBreakerInterval,
+		Timeout:          cfg.HostBreakerTimeout,
+	}
+	dynamicHandler.AdminToken = cfg.AdminToken
+	dynamicHandler.BreakerMetrics = handlers.NewBreakerMetrics(tel.Meter, tel.MetricsNamespace, logger.Named("metrics"))
+	dynamicHandler.ResultCacheMaxAge = cfg.ResultCacheMaxAge
+	dynamicHandler.FetchTimeout = cfg.FetchTimeout
+	dynamicHandler.MaxRedirects = cfg.MaxRedirects
+	dynamicHandler.StrictContentType = cfg.StrictContentType
+	dynamicHandler.DedupeFetches = cfg.DedupeFetches
+	dynamicHandler.MaxBytesPerHostPerBatch = cfg.MaxBytesPerHostPerBatch
+	dynamicHandler.UserAgent = cfg.UserAgent
+	dynamicHandler.UserAgents = cfg.UserAgents
+	dynamicHandler.PersistFetchResults = cfg.PersistFetchResults
+	dynamicHandler.SuccessBodiesOnly = cfg.SuccessBodiesOnly
+	dynamicHandler.SuccessStatuses = cfg.SuccessStatuses
+	dynamicHandler.FetchRatePerHost = cfg.FetchRatePerHost
+	dynamicHandler.FetchBurstPerHost = cfg.FetchBurstPerHost
+	dynamicHandler.JobTTL = cfg.JobTTL
+	dynamicHandler.MaxRunningRefreshJobs = cfg.MaxRunningRefreshJobs
+	dynamicHandler.ContentHashDenylist = cfg.ContentHashDenylist
+	dynamicHandler.MaxFetchQueue = cfg.MaxFetchQueue
+	dynamicHandler.FetchQueueDeadline = cfg.FetchQueueDeadline
+
 	handlerList := []router.Handler{
-		handlers.NewDynamicHandler(dbProvider),
+		dynamicHandler,
 	}
 
 	appRouter := router.NewRouter(limiter, tel, logger, handlerList)
+	appRouter.RateLimitMaxWait = cfg.RateLimitMaxWait
+	appRouter.RetryAfterMax = cfg.RetryAfterMax
+	appRouter.RequestIDHeader = cfg.RequestIDHeader
+	appRouter.SlowRequestThreshold = cfg.SlowRequestThreshold
+	if cfg.LivenessStallWindow > 0 {
+		appRouter.Watchdog = service_health.NewWatchdog(cfg.LivenessStallWindow)
+	}
+	if pinger, ok := dbProvider.(lookup.Pinger); ok {
+		appRouter.ReadinessProbe = service_health.NewReadinessProbe(pinger.Ping, cfg.ReadinessCacheInterval)
+	}
 	server := appRouter.CreateServer(":" + cfg.Port)
 
 	return &App{
@@ -70,6 +204,9 @@ func NewApp(cfg *config.Config, logger *zap.Logger) (*App, error) {
 		logger:    logger,
 		telemetry: tel,
 		server:    server,
+		db:        dbProvider,
+		audit:     auditLogger,
+		handler:   dynamicHandler,
 	}, nil
 }
 
@@ -99,6 +236,27 @@ func (app *App) stop() error {
 		return err
 	}
 
+	// Refresh jobs and cache revalidations outlive their requests, so they are cancelled and
+	// awaited separately
+	if err := app.handler.Close(shutdownCtx); err != nil {
+		app.logger.Error("refresh jobs did not stop in time", zap.Error(err))
+	}
+
+	// Providers holding connections release them once requests have drained
+	if closer, ok := app.db.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			app.logger.Error("failed to close db provider", zap.Error(err))
+		}
+	}
+
+	if app.audit != nil {
+		_ = app.audit.Sync()
+	}
+
+	if err := app.telemetry.Shutdown(shutdownCtx); err != nil {
+		app.logger.Error("failed to shut down telemetry", zap.Error(err))
+	}
+
 	app.logger.Info("server exited gracefully")
 	return nil
 }
@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
@@ -16,6 +18,237 @@ type Config struct {
 	IPDBConfig  string
 	Environment string
 	LogLevel    string
+
+	// RateLimitMaxWait is how long a rate-limited request may queue before a 429
+	RateLimitMaxWait time.Duration
+	// RetryAfterMax caps the Retry-After advertised on 429 responses and on GETs shed with 503; zero leaves it uncapped
+	RetryAfterMax time.Duration
+
+	// LivenessStallWindow fails liveness when no request completes within it under load; zero disables
+	LivenessStallWindow time.Duration
+
+	// MaxConcurrentFetches bounds the number of URLs fetched in parallel per GET
+	MaxConcurrentFetches int
+
+	// MaxConcurrentFetchesPerHost bounds parallel fetches to one host per GET; zero disables
+	MaxConcurrentFetchesPerHost int
+
+	// ResultBufferSize is the capacity of the fetch result channel; zero matches the worker pool
+	ResultBufferSize int
+
+	// TextMIMEAllowlist restricts which media types may be inlined as text in fetch results
+	TextMIMEAllowlist []string
+
+	// InvalidUTF8Policy is either "base64" or "replace" for text responses with invalid UTF-8
+	InvalidUTF8Policy string
+
+	// OutboundCookieJar is "off", "url" or "batch", the scope in which upstream cookies are kept
+	OutboundCookieJar string
+
+	// ReadOnly rejects store requests while still serving fetches
+	ReadOnly bool
+
+	// AllowClearOnEmptyPost lets a POST with an empty urls array clear the path
+	AllowClearOnEmptyPost bool
+
+	// AllowedOutboundMethods lists the HTTP methods that may be sent to upstreams
+	AllowedOutboundMethods []string
+
+	// MetricsNamespace prefixes every metric name to avoid collisions in shared Prometheus setups
+	MetricsNamespace string
+
+	// TraceSampleRatio is the fraction of new traces that are sampled (0 to 1)
+	TraceSampleRatio float64
+
+	// TracesOTLPEndpoint is the OTLP/HTTP collector URL sampled spans are sent to; empty keeps them in process
+	TracesOTLPEndpoint string
+
+	// MaxFetchTimeout bounds every upstream fetch, including per-URL timeout hints
+	MaxFetchTimeout time.Duration
+
+	// MaxURLLength is the longest URL accepted for storage or fetching
+	MaxURLLength int
+
+	// MaxResponseHeaderBytes caps the size of upstream response headers
+	MaxResponseHeaderBytes int64
+
+	// OutboundSourceIP is the local address upstream connections are bound to
+	OutboundSourceIP string
+
+	// CrossHostRedirectLimit caps redirect hops to a different host; negative disables the cap
+	CrossHostRedirectLimit int
+
+	// MaxOutboundBodyBytes caps the body replayed to an upstream
+	MaxOutboundBodyBytes int64
+
+	// MaxDecompressionRatio is the largest decompressed-to-compressed ratio accepted for gzip bodies
+	MaxDecompressionRatio float64
+
+	// MaxDecompressedBytes caps the decompressed size of gzip bodies
+	MaxDecompressedBytes int64
+
+	// ReturnPartialReads keeps content read before an upstream dropped the connection
+	ReturnPartialReads bool
+
+	// OutboundHeaderDenylist lists headers stripped from every upstream request
+	OutboundHeaderDenylist []string
+
+	// MaxQueryOverrides caps the query parameters on a GET, checked before parsing; zero disables the cap
+	MaxQueryOverrides int
+
+	// ResultCacheTTL is how long fetch results are cached per URL; zero disables the cache
+	ResultCacheTTL time.Duration
+
+	// ResultCacheStaleWhileRevalidate serves expired results this long while refreshing them
+	ResultCacheStaleWhileRevalidate time.Duration
+
+	// ResultCacheMaxEntries bounds the number of cached fetch results
+	ResultCacheMaxEntries int
+
+	// MetadataOnlyAboveBytes returns metadata only for URLs whose HEAD reports a larger size; zero disables it
+	MetadataOnlyAboveBytes int64
+
+	// SkipFetchAboveBytes skips URLs whose HEAD reports a larger size; zero disables it
+	SkipFetchAboveBytes int64
+
+	// AllowedRedirectCodes lists the redirect status codes that are followed; empty allows all
+	AllowedRedirectCodes []int
+
+	// RequestIDHeader carries the request ID, taken from the client or generated
+	RequestIDHeader string
+
+	// CorrelationIDHeader forwards the request ID to upstreams
+	CorrelationIDHeader string
+
+	// MaxConcurrentStores bounds concurrent POST and PATCH stores; zero disables the limit
+	MaxConcurrentStores int
+
+	// AuditLog is where audit entries for stores are written: stdout, stderr or a file path; empty disables auditing
+	AuditLog string
+
+	// DefaultReferer is sent upstream for URLs stored without their own referer
+	DefaultReferer string
+
+	// DefaultOrigin is sent upstream for URLs stored without their own origin
+	DefaultOrigin string
+
+	// CanonicalizeURLs stores posted URLs in canonical form so equivalent URLs dedupe
+	CanonicalizeURLs bool
+
+	// SlowRequestThreshold logs requests slower than it at Warn; zero disables
+	SlowRequestThreshold time.Duration
+
+	// MaxGlobalFetches bounds outbound fetches in flight across all requests; zero disables the limit
+	MaxGlobalFetches int
+
+	// FetchQueueTimeout is how long a GET waits for a global fetch slot before it is shed with 503
+	FetchQueueTimeout time.Duration
+
+	// AllowlistProfiles is the JSON definition of named SSRF allowlist profiles
+	AllowlistProfiles string
+
+	// AllowlistProfileHeader names the request header selecting an allowlist profile
+	AllowlistProfileHeader string
+
+	// ExplicitRoutes adds /_store/{path} and /_fetch/{path} alongside the method-based routes
+	ExplicitRoutes bool
+
+	// MetadataEndpoints replaces the built-in list of cloud metadata hosts and addresses that are never fetched
+	MetadataEndpoints []string
+
+	// CompressCachedContent keeps the content of the in-memory result cache gzip-compressed
+	CompressCachedContent bool
+
+	// HostBreakerFailureThreshold is the number of consecutive failed fetches that opens an upstream host's circuit breaker. Zero disables the breakers.
+	HostBreakerFailureThreshold int
+
+	// HostBreakerMaxRequests is the number of trial fetches let through while a host's breaker is half-open
+	HostBreakerMaxRequests int
+
+	// HostBreakerInterval is how often a closed host breaker clears its failure counts. Zero never clears them.
+	HostBreakerInterval time.Duration
+
+	// HostBreakerTimeout is how long an open host breaker waits before letting trial fetches through
+	HostBreakerTimeout time.Duration
+
+	// AdminToken is the bearer token admin endpoints require; they are not served without one
+	AdminToken string
+
+	// ResultCacheMaxAge is the oldest a cached result may be served, even while stale-while-revalidate applies
+	ResultCacheMaxAge time.Duration
+
+	// FetchTimeout is the timeout of each upstream fetch stored without a timeout hint
+	FetchTimeout time.Duration
+
+	// MaxRedirects is the redirect hop that fails a fetch; one fewer hops are followed
+	MaxRedirects int
+
+	// HostAllowlist restricts stored and fetched URLs to these hosts; *.example.com matches subdomains
+	HostAllowlist []string
+
+	// HostDenylist lists hosts that are always rejected, even when allowlisted
+	HostDenylist []string
+
+	// StrictContentType rejects POST and PATCH bodies not sent as application/json
+	StrictContentType bool
+
+	// DedupeFetches fetches a URL repeated under one path once and shares the result
+	DedupeFetches bool
+
+	// ReadinessCacheInterval is how long a readiness database ping is reused before another one runs
+	ReadinessCacheInterval time.Duration
+
+	// MaxBytesPerHostPerBatch caps the body bytes read from one host per GET; zero disables
+	MaxBytesPerHostPerBatch int64
+
+	// UserAgent is the User-Agent header fetches send when UserAgents is empty
+	UserAgent string
+
+	// UserAgents is a pool of User-Agent headers fetches rotate through, separated by "|"
+	// since User-Agents contain commas
+	UserAgents []string
+
+	// PersistFetchResults stores the status code, content, error and time of every live fetch on the stored URL
+	PersistFetchResults bool
+
+	// SuccessBodiesOnly returns content only for responses with a status in SuccessStatuses
+	SuccessBodiesOnly bool
+
+	// SuccessStatuses lists the statuses SuccessBodiesOnly returns content for; empty means every 2xx
+	SuccessStatuses []int
+
+	// FetchRatePerHost limits the requests per second sent to one upstream host; zero disables
+	FetchRatePerHost float64
+
+	// FetchBurstPerHost is how many requests a host may be sent at once before FetchRatePerHost applies
+	FetchBurstPerHost int
+
+	// JobTTL is how long completed refresh job results are kept; zero keeps them
+	JobTTL time.Duration
+
+	// MaxRunningRefreshJobs bounds refresh jobs running at once; zero disables the limit
+	MaxRunningRefreshJobs int
+
+	// MetricsOTLPEndpoint is the OTLP/HTTP collector URL metrics are pushed to; empty disables pushing
+	MetricsOTLPEndpoint string
+
+	// MetricsExportInterval is how often metrics are pushed to MetricsOTLPEndpoint; zero keeps the SDK default
+	MetricsExportInterval time.Duration
+
+	// MetricsExportBatchSize caps the metrics sent in one push; zero sends them all at once
+	MetricsExportBatchSize int
+
+	// ContentHashDenylist lists hex SHA-256 hashes of known-bad content whose fetched bodies are dropped
+	ContentHashDenylist []string
+
+	// OutboundProxy is the http, https or socks5 proxy every upstream fetch goes through; empty connects directly
+	OutboundProxy string
+
+	// MaxFetchQueue bounds fetches waiting in line for a global fetch slot; zero leaves the queue unbounded
+	MaxFetchQueue int
+
+	// FetchQueueDeadline is how long a queued fetch waits for a global fetch slot before it fails; zero waits as long as its request
+	FetchQueueDeadline time.Duration
 }
 
 // Load loads configuration from environment variables
@@ -32,14 +265,205 @@ func Load(logger *zap.Logger) *Config {
 		IPDBConfig:  os.Getenv("DB_CONFIG"),
 		Environment: getEnv("ENVIRONMENT", "production"),
 		LogLevel:    getEnv("LOG_LEVEL", "info"),
+
+		RateLimitMaxWait:    getEnvAsDuration("RATE_LIMIT_MAX_WAIT", 0),
+		RetryAfterMax:       getEnvAsDuration("RETRY_AFTER_MAX", time.Minute),
+		LivenessStallWindow: getEnvAsDuration("LIVENESS_STALL_WINDOW", 0),
+
+		MaxConcurrentFetches: getEnvAsInt("MAX_CONCURRENT_FETCHES", 10),
+		ResultBufferSize:     getEnvAsInt("RESULT_BUFFER_SIZE", 0),
+		TextMIMEAllowlist:    getEnvAsSlice("TEXT_MIME_ALLOWLIST", nil),
+		InvalidUTF8Policy:    getEnv("INVALID_UTF8_POLICY", "base64"),
+		OutboundCookieJar:    getEnv("OUTBOUND_COOKIE_JAR", "off"),
+		ReadOnly:             getEnvAsBool("READ_ONLY", false),
+
+		MaxConcurrentFetchesPerHost: getEnvAsInt("MAX_CONCURRENT_FETCHES_PER_HOST", 0),
+
+		AllowClearOnEmptyPost: getEnvAsBool("ALLOW_CLEAR_ON_EMPTY_POST", false),
+
+		AllowedOutboundMethods: getEnvAsSlice("ALLOWED_OUTBOUND_METHODS", []string{"GET", "HEAD"}),
+		MetricsNamespace:       getEnv("METRICS_NAMESPACE", ""),
+		TraceSampleRatio:       getEnvAsFloat("TRACE_SAMPLE_RATIO", 0.01),
+		TracesOTLPEndpoint:     os.Getenv("TRACES_OTLP_ENDPOINT"),
+		MaxFetchTimeout:        getEnvAsDuration("MAX_FETCH_TIMEOUT", 30*time.Second),
+		MaxURLLength:           getEnvAsInt("MAX_URL_LENGTH", 2048),
+		MaxResponseHeaderBytes: int64(getEnvAsInt("MAX_RESPONSE_HEADER_BYTES", 64<<10)),
+		OutboundSourceIP:       getEnv("OUTBOUND_SOURCE_IP", ""),
+		CrossHostRedirectLimit: getEnvAsInt("CROSS_HOST_REDIRECT_LIMIT", -1),
+		MaxOutboundBodyBytes:   int64(getEnvAsInt("MAX_OUTBOUND_BODY_BYTES", 1<<20)),
+		MaxDecompressionRatio:  getEnvAsFloat("MAX_DECOMPRESSION_RATIO", 100),
+		MaxDecompressedBytes:   int64(getEnvAsInt("MAX_DECOMPRESSED_BYTES", 1<<20)),
+		ReturnPartialReads:     getEnvAsBool("RETURN_PARTIAL_READS", false),
+		OutboundHeaderDenylist: getEnvAsSlice("OUTBOUND_HEADER_DENYLIST", []string{"Authorization", "Cookie"}),
+		MaxQueryOverrides:      getEnvAsInt("MAX_QUERY_OVERRIDES", 100),
+
+		ResultCacheTTL:                  getEnvAsDuration("RESULT_CACHE_TTL", 0),
+		ResultCacheStaleWhileRevalidate: getEnvAsDuration("RESULT_CACHE_STALE_WHILE_REVALIDATE", 0),
+		ResultCacheMaxEntries:           getEnvAsInt("RESULT_CACHE_MAX_ENTRIES", 1000),
+
+		MetadataOnlyAboveBytes: int64(getEnvAsInt("METADATA_ONLY_ABOVE_BYTES", 0)),
+		SkipFetchAboveBytes:    int64(getEnvAsInt("SKIP_FETCH_ABOVE_BYTES", 0)),
+
+		AllowedRedirectCodes: getEnvAsIntSlice("ALLOWED_REDIRECT_CODES", nil),
+
+		RequestIDHeader:     getEnv("REQUEST_ID_HEADER", "X-Request-ID"),
+		CorrelationIDHeader: getEnv("CORRELATION_ID_HEADER", "X-Correlation-ID"),
+
+		MaxConcurrentStores: getEnvAsInt("MAX_CONCURRENT_STORES", 0),
+
+		AuditLog: getEnv("AUDIT_LOG", ""),
+
+		DefaultReferer: getEnv("DEFAULT_REFERER", ""),
+		DefaultOrigin:  getEnv("DEFAULT_ORIGIN", ""),
+
+		CanonicalizeURLs: getEnvAsBool("CANONICALIZE_URLS", false),
+
+		SlowRequestThreshold: getEnvAsDuration("SLOW_REQUEST_THRESHOLD", 0),
+
+		MaxGlobalFetches:  getEnvAsInt("MAX_GLOBAL_FETCHES", 0),
+		FetchQueueTimeout: getEnvAsDuration("FETCH_QUEUE_TIMEOUT", 5*time.Second),
+
+		AllowlistProfiles:      os.Getenv("ALLOWLIST_PROFILES"),
+		AllowlistProfileHeader: getEnv("ALLOWLIST_PROFILE_HEADER", "X-Allowlist-Profile"),
+
+		ExplicitRoutes: getEnvAsBool("EXPLICIT_ROUTES", false),
+
+		MetadataEndpoints: getEnvAsSlice("METADATA_ENDPOINTS", nil),
+
+		CompressCachedContent: getEnvAsBool("COMPRESS_CACHED_CONTENT", false),
+
+		HostBreakerFailureThreshold: getEnvAsInt("HOST_BREAKER_FAILURE_THRESHOLD", 0),
+		HostBreakerMaxRequests:      getEnvAsInt("HOST_BREAKER_MAX_REQUESTS", 1),
+		HostBreakerInterval:         getEnvAsDuration("HOST_BREAKER_INTERVAL", 0),
+		HostBreakerTimeout:          getEnvAsDuration("HOST_BREAKER_TIMEOUT", 30*time.Second),
+		AdminToken:                  os.Getenv("ADMIN_TOKEN"),
+
+		ResultCacheMaxAge: getEnvAsDuration("RESULT_CACHE_MAX_AGE", 0),
+
+		FetchTimeout: getEnvAsDuration("FETCH_TIMEOUT", 30*time.Second),
+		MaxRedirects: getEnvAsInt("MAX_REDIRECTS", 10),
+
+		HostAllowlist: getEnvAsSlice("HOST_ALLOWLIST", nil),
+		HostDenylist:  getEnvAsSlice("HOST_DENYLIST", nil),
+
+		StrictContentType: getEnvAsBool("STRICT_CONTENT_TYPE", false),
+
+		DedupeFetches: getEnvAsBool("DEDUPE_FETCHES", false),
+
+		ReadinessCacheInterval: getEnvAsDuration("READINESS_CACHE_INTERVAL", 2*time.Second),
+
+		MaxBytesPerHostPerBatch: int64(getEnvAsInt("MAX_BYTES_PER_HOST_PER_BATCH", 0)),
+
+		UserAgent:  getEnv("FETCH_USER_AGENT", "Guardz-URL-Fetcher/1.0"),
+		UserAgents: getEnvAsSeparatedSlice("FETCH_USER_AGENTS", "|", nil),
+
+		PersistFetchResults: getEnvAsBool("PERSIST_FETCH_RESULTS", false),
+
+		SuccessBodiesOnly: getEnvAsBool("SUCCESS_BODIES_ONLY", false),
+		SuccessStatuses:   getEnvAsIntSlice("SUCCESS_STATUSES", nil),
+
+		FetchRatePerHost:  getEnvAsFloat("FETCH_RATE_PER_HOST", 0),
+		FetchBurstPerHost: getEnvAsInt("FETCH_BURST_PER_HOST", 1),
+
+		JobTTL: getEnvAsDuration("JOB_TTL", 0),
+
+		MaxRunningRefreshJobs: getEnvAsInt("MAX_RUNNING_REFRESH_JOBS", 4),
+
+		MetricsOTLPEndpoint:    os.Getenv("METRICS_OTLP_ENDPOINT"),
+		MetricsExportInterval:  getEnvAsDuration("METRICS_EXPORT_INTERVAL", 0),
+		MetricsExportBatchSize: getEnvAsInt("METRICS_EXPORT_BATCH_SIZE", 0),
+
+		ContentHashDenylist: getEnvAsSlice("CONTENT_HASH_DENYLIST", nil),
+
+		OutboundProxy: getEnv("OUTBOUND_PROXY", ""),
+
+		MaxFetchQueue:      getEnvAsInt("MAX_FETCH_QUEUE", 0),
+		FetchQueueDeadline: getEnvAsDuration("FETCH_QUEUE_DEADLINE", 0),
 	}
 
 	logger.Info("configuration loaded",
 		zap.String("port", config.Port),
 		zap.Int("rps_limit", config.RPSLimit),
 		zap.Int("rps_burst", config.RPSBurst),
+		zap.Duration("rate_limit_max_wait", config.RateLimitMaxWait),
+		zap.Duration("retry_after_max", config.RetryAfterMax),
+		zap.Duration("liveness_stall_window", config.LivenessStallWindow),
 		zap.String("environment", config.Environment),
 		zap.String("log_level", config.LogLevel),
+		zap.Int("max_concurrent_fetches", config.MaxConcurrentFetches),
+		zap.Int("max_concurrent_fetches_per_host", config.MaxConcurrentFetchesPerHost),
+		zap.Int("result_buffer_size", config.ResultBufferSize),
+		zap.Strings("text_mime_allowlist", config.TextMIMEAllowlist),
+		zap.String("invalid_utf8_policy", config.InvalidUTF8Policy),
+		zap.String("outbound_cookie_jar", config.OutboundCookieJar),
+		zap.Bool("read_only", config.ReadOnly),
+		zap.Bool("allow_clear_on_empty_post", config.AllowClearOnEmptyPost),
+		zap.Strings("allowed_outbound_methods", config.AllowedOutboundMethods),
+		zap.String("metrics_namespace", config.MetricsNamespace),
+		zap.Float64("trace_sample_ratio", config.TraceSampleRatio),
+		zap.String("traces_otlp_endpoint", config.TracesOTLPEndpoint),
+		zap.Duration("max_fetch_timeout", config.MaxFetchTimeout),
+		zap.Int("max_url_length", config.MaxURLLength),
+		zap.Int64("max_response_header_bytes", config.MaxResponseHeaderBytes),
+		zap.String("outbound_source_ip", config.OutboundSourceIP),
+		zap.Int("cross_host_redirect_limit", config.CrossHostRedirectLimit),
+		zap.Int64("max_outbound_body_bytes", config.MaxOutboundBodyBytes),
+		zap.Float64("max_decompression_ratio", config.MaxDecompressionRatio),
+		zap.Int64("max_decompressed_bytes", config.MaxDecompressedBytes),
+		zap.Bool("return_partial_reads", config.ReturnPartialReads),
+		zap.Strings("outbound_header_denylist", config.OutboundHeaderDenylist),
+		zap.Int("max_query_overrides", config.MaxQueryOverrides),
+		zap.Duration("result_cache_ttl", config.ResultCacheTTL),
+		zap.Duration("result_cache_stale_while_revalidate", config.ResultCacheStaleWhileRevalidate),
+		zap.Int("result_cache_max_entries", config.ResultCacheMaxEntries),
+		zap.Int64("metadata_only_above_bytes", config.MetadataOnlyAboveBytes),
+		zap.Int64("skip_fetch_above_bytes", config.SkipFetchAboveBytes),
+		zap.Ints("allowed_redirect_codes", config.AllowedRedirectCodes),
+		zap.String("request_id_header", config.RequestIDHeader),
+		zap.String("correlation_id_header", config.CorrelationIDHeader),
+		zap.Int("max_concurrent_stores", config.MaxConcurrentStores),
+		zap.String("audit_log", config.AuditLog),
+		zap.String("default_referer", config.DefaultReferer),
+		zap.String("default_origin", config.DefaultOrigin),
+		zap.Bool("canonicalize_urls", config.CanonicalizeURLs),
+		zap.Duration("slow_request_threshold", config.SlowRequestThreshold),
+		zap.Int("max_global_fetches", config.MaxGlobalFetches),
+		zap.Duration("fetch_queue_timeout", config.FetchQueueTimeout),
+		zap.Bool("allowlist_profiles_configured", config.AllowlistProfiles != ""),
+		zap.String("allowlist_profile_header", config.AllowlistProfileHeader),
+		zap.Bool("explicit_routes", config.ExplicitRoutes),
+		zap.Strings("metadata_endpoints", config.MetadataEndpoints),
+		zap.Bool("compress_cached_content", config.CompressCachedContent),
+		zap.Int("host_breaker_failure_threshold", config.HostBreakerFailureThreshold),
+		zap.Int("host_breaker_max_requests", config.HostBreakerMaxRequests),
+		zap.Duration("host_breaker_interval", config.HostBreakerInterval),
+		zap.Duration("host_breaker_timeout", config.HostBreakerTimeout),
+		zap.Bool("admin_token_configured", config.AdminToken != ""),
+		zap.Duration("result_cache_max_age", config.ResultCacheMaxAge),
+		zap.Duration("fetch_timeout", config.FetchTimeout),
+		zap.Int("max_redirects", config.MaxRedirects),
+		zap.Strings("host_allowlist", config.HostAllowlist),
+		zap.Strings("host_denylist", config.HostDenylist),
+		zap.Bool("strict_content_type", config.StrictContentType),
+		zap.Bool("dedupe_fetches", config.DedupeFetches),
+		zap.Duration("readiness_cache_interval", config.ReadinessCacheInterval),
+		zap.Int64("max_bytes_per_host_per_batch", config.MaxBytesPerHostPerBatch),
+		zap.String("fetch_user_agent", config.UserAgent),
+		zap.Strings("fetch_user_agents", config.UserAgents),
+		zap.Bool("persist_fetch_results", config.PersistFetchResults),
+		zap.Bool("success_bodies_only", config.SuccessBodiesOnly),
+		zap.Ints("success_statuses", config.SuccessStatuses),
+		zap.Float64("fetch_rate_per_host", config.FetchRatePerHost),
+		zap.Int("fetch_burst_per_host", config.FetchBurstPerHost),
+		zap.Duration("job_ttl", config.JobTTL),
+		zap.Int("max_running_refresh_jobs", config.MaxRunningRefreshJobs),
+		zap.String("metrics_otlp_endpoint", config.MetricsOTLPEndpoint),
+		zap.Duration("metrics_export_interval", config.MetricsExportInterval),
+		zap.Int("metrics_export_batch_size", config.MetricsExportBatchSize),
+		zap.Int("content_hash_denylist_size", len(config.ContentHashDenylist)),
+		zap.Bool("outbound_proxy_configured", config.OutboundProxy != ""),
+		zap.Int("max_fetch_queue", config.MaxFetchQueue),
+		zap.Duration("fetch_queue_deadline", config.FetchQueueDeadline),
 	)
 
 	return config
@@ -62,3 +486,68 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvAsDuration gets an environment variable as a duration (e.g. "250ms") with a default value
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if durationValue, err := time.ParseDuration(value); err == nil {
+			return durationValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsFloat gets an environment variable as float with a default value
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsBool gets an environment variable as boolean with a default value
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsSlice gets a comma-separated environment variable as a slice with a default value
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	return getEnvAsSeparatedSlice(key, ",", defaultValue)
+}
+
+// getEnvAsSeparatedSlice splits the variable on sep, for values that may contain commas themselves
+func getEnvAsSeparatedSlice(key, sep string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var items []string
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvAsIntSlice gets a comma-separated environment variable as integers, skipping entries that do not parse
+func getEnvAsIntSlice(key string, defaultValue []int) []int {
+	items := getEnvAsSlice(key, nil)
+	if items == nil {
+		return defaultValue
+	}
+	var ints []int
+	for _, item := range items {
+		if intValue, err := strconv.Atoi(item); err == nil {
+			ints = append(ints, intValue)
+		}
+	}
+	return ints
+}
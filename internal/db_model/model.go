@@ -1,28 +1,61 @@
 package db_model
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrVersionMismatch is returned by a conditional replace when the path has been modified since the expected version
+var ErrVersionMismatch = errors.New("path version does not match")
+
+// ErrPathNotFound is returned by a delete when the path has no URLs stored
+var ErrPathNotFound = errors.New("path has no URLs")
+
+// ErrIPNotFound is returned by a lookup when no stored range holds the address
+var ErrIPNotFound = errors.New("ip address not found")
+
 // Path represents a unique path
 type Path struct {
 	ID   uint64 `db_model:"id" json:"id"`
 	Path string `db_model:"path" json:"path"`
+	// Version is bumped on every write to the path's URLs
+	Version uint64 `db_model:"version" json:"version"`
 }
 
 // URLRecord represents a fetched URL and its content
 type URLRecord struct {
-	ID     uint64 `db_model:"id" json:"id"`
-	PathID uint64 `db_model:"path_id" json:"path_id"`
-	URL    string `db_model:"url" json:"url"`
+	ID        uint64    `db_model:"id" json:"id"`
+	PathID    uint64    `db_model:"path_id" json:"path_id"`
+	Path      string    `db_model:"-" json:"path,omitempty"`
+	URL       string    `db_model:"url" json:"url"`
+	UpdatedAt time.Time `db_model:"updated_at" json:"updated_at"`
+	// TimeoutMs is the suggested fetch timeout for this URL in milliseconds; zero uses the server default
+	TimeoutMs int `db_model:"timeout_ms" json:"timeout_ms,omitempty"`
+	// Referer and Origin override the server's default headers when fetching this URL
+	Referer string `db_model:"referer" json:"referer,omitempty"`
+	Origin  string `db_model:"origin" json:"origin,omitempty"`
+	// Headers are extra request headers sent when fetching this URL. They may carry credentials,
+	// so they are never encoded into responses.
+	Headers map[string]string `db_model:"headers" json:"-"`
+	// StatusCode, Content, FetchError and FetchedAt hold the latest fetch of this URL when fetch
+	// results are persisted
+	StatusCode int       `db_model:"status_code" json:"status_code,omitempty"`
+	Content    string    `db_model:"content" json:"content,omitempty"`
+	FetchError string    `db_model:"fetch_error" json:"fetch_error,omitempty"`
+	FetchedAt  time.Time `db_model:"fetched_at" json:"fetched_at,omitzero"`
 }
 
-// Schema is the SQL schema for the paths and urls tables
-const Schema = `
-CREATE TABLE IF NOT EXISTS paths (
-    id SERIAL PRIMARY KEY,
-    path TEXT UNIQUE NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS urls (
-    id SERIAL PRIMARY KEY,
-    path_id INTEGER REFERENCES paths(id) ON DELETE CASCADE,
-    url TEXT NOT NULL
-);
-`
+// RecordsFromURLs wraps plain URLs into records carrying no per-URL settings
+func RecordsFromURLs(urls []string) []URLRecord {
+	records := make([]URLRecord, len(urls))
+	for i, url := range urls {
+		records[i] = URLRecord{URL: url}
+	}
+	return records
+}
+
+// GeoLocation is where a lookup places an IP address
+type GeoLocation struct {
+	City    string `json:"city"`
+	Country string `json:"country"`
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shaibs3/Guardz/internal/render"
+)
+
+// DefaultAllowlistProfileHeader is the request header naming the allowlist profile to use
+const DefaultAllowlistProfileHeader = "X-Allowlist-Profile"
+
+// AllowlistProfile is a named set of hosts exempt from SSRF protection, e.g. internal services
+// one caller needs to reach. Only requests bearing one of its API keys may select it.
+type AllowlistProfile struct {
+	Hosts   []string `json:"hosts"`
+	APIKeys []string `json:"api_keys"`
+}
+
+// ParseAllowlistProfiles parses profiles given as JSON, e.g.
+// {"internal": {"hosts": ["inventory.internal"], "api_keys": ["..."]}}. Empty means no profiles.
+func ParseAllowlistProfiles(profilesJSON string) (map[string]AllowlistProfile, error) {
+	if strings.TrimSpace(profilesJSON) == "" {
+		return nil, nil
+	}
+	var profiles map[string]AllowlistProfile
+	if err := json.Unmarshal([]byte(profilesJSON), &profiles); err != nil {
+		return nil, fmt.Errorf("invalid allowlist profiles: %w", err)
+	}
+	for name, profile := range profiles {
+		if len(profile.APIKeys) == 0 {
+			return nil, fmt.Errorf("allowlist profile %q has no api_keys and could never be selected", name)
+		}
+	}
+	return profiles, nil
+}
+
+// allows reports whether the profile exempts host
+func (p *AllowlistProfile) allows(host string) bool {
+	for _, allowed := range p.Hosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizes reports whether key is one of the profile's API keys
+func (p *AllowlistProfile) authorizes(key string) bool {
+	authorized := false
+	for _, candidate := range p.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			authorized = true
+		}
+	}
+	return authorized
+}
+
+// allowlistProfileKey carries the selected allowlist profile on a context
+type allowlistProfileKey struct{}
+
+// withAllowlistProfile returns ctx carrying profile, or ctx unchanged when profile is nil
+func withAllowlistProfile(ctx context.Context, profile *AllowlistProfile) context.Context {
+	if profile == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, allowlistProfileKey{}, profile)
+}
+
+// allowlistProfileFrom returns the allowlist profile on ctx, or nil if none was selected
+func allowlistProfileFrom(ctx context.Context) *AllowlistProfile {
+	profile, _ := ctx.Value(allowlistProfileKey{}).(*AllowlistProfile)
+	return profile
+}
+
+// selectAllowlistProfile wraps next so the allowlist profile named in the request, if any, is
+// carried on its context. Selecting a profile takes one of its API keys as a bearer token.
+func (h *DynamicHandler) selectAllowlistProfile(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		header := h.AllowlistProfileHeader
+		if header == "" {
+			header = DefaultAllowlistProfileHeader
+		}
+		name := req.Header.Get(header)
+		if name == "" {
+			next(w, req)
+			return
+		}
+
+		key, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			render.Error(w, req, "an API key is required to select an allowlist profile", http.StatusUnauthorized)
+			return
+		}
+		// Unknown profiles are refused like unauthorized ones so names are not disclosed
+		profile, ok := h.AllowlistProfiles[name]
+		if !ok || !profile.authorizes(key) {
+			render.Error(w, req, fmt.Sprintf("not authorized for allowlist profile %q", name), http.StatusForbidden)
+			return
+		}
+		next(w, req.WithContext(withAllowlistProfile(req.Context(), &profile)))
+	}
+}
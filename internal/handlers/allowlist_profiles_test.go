@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestValidateURL_AllowlistProfiles(t *testing.T) {
+	h := setupTestHandler()
+	profileA := &AllowlistProfile{Hosts: []string{"10.0.0.5"}}
+	profileB := &AllowlistProfile{Hosts: []string{"10.0.0.6"}}
+
+	ctxA := withAllowlistProfile(context.Background(), profileA)
+	ctxB := withAllowlistProfile(context.Background(), profileB)
+	require.NoError(t, h.validateURLContext(ctxA, "http://10.0.0.5/status"), "profile A allows its host")
+	require.Error(t, h.validateURLContext(ctxB, "http://10.0.0.5/status"), "profile B rejects it")
+	require.Error(t, h.validateURLContext(context.Background(), "http://10.0.0.5/status"), "no profile rejects it")
+}
+
+func TestDynamicHandler_AllowlistProfileSelection(t *testing.T) {
+	h := setupTestHandler()
+	h.AllowlistProfiles = map[string]AllowlistProfile{
+		"a": {Hosts: []string{"10.0.0.5"}, APIKeys: []string{"key-a"}},
+		"b": {Hosts: []string{"10.0.0.6"}, APIKeys: []string{"key-b"}},
+	}
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	post := func(profile, key string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"urls": []string{"http://10.0.0.5/status"}})
+		req := httptest.NewRequest(http.MethodPost, "/profile-test", bytes.NewReader(body))
+		if profile != "" {
+			req.Header.Set(DefaultAllowlistProfileHeader, profile)
+		}
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusCreated, post("a", "key-a").Code, "profile A allows the host")
+	require.Equal(t, http.StatusBadRequest, post("b", "key-b").Code, "profile B rejects the host")
+	require.Equal(t, http.StatusBadRequest, post("", "").Code, "without a profile the host is rejected")
+
+	// Callers may only select the profiles their key is authorized for
+	require.Equal(t, http.StatusUnauthorized, post("a", "").Code)
+	require.Equal(t, http.StatusForbidden, post("a", "key-b").Code)
+	require.Equal(t, http.StatusForbidden, post("missing", "key-a").Code)
+}
+
+func TestParseAllowlistProfiles(t *testing.T) {
+	profiles, err := ParseAllowlistProfiles("")
+	require.NoError(t, err)
+	require.Nil(t, profiles)
+
+	profiles, err = ParseAllowlistProfiles(`{"internal": {"hosts": ["inventory.internal"], "api_keys": ["k"]}}`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"inventory.internal"}, profiles["internal"].Hosts)
+
+	_, err = ParseAllowlistProfiles(`{"internal": {"hosts": ["inventory.internal"]}}`)
+	require.Error(t, err, "a profile without keys could never be selected")
+	_, err = ParseAllowlistProfiles(`not json`)
+	require.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/request_id"
+	"go.uber.org/zap"
+)
+
+// Audited operations
+const (
+	auditOpStore  = "store"
+	auditOpClear  = "clear"
+	auditOpAdd    = "add"
+	auditOpDelete = "delete"
+)
+
+// audit records a successful mutating operation in the audit log, if one is configured
+func (h *DynamicHandler) audit(req *http.Request, operation, path string, urlCount int) {
+	if h.AuditLogger == nil {
+		return
+	}
+	h.AuditLogger.Info("audit",
+		zap.String("operation", operation),
+		zap.String("path", path),
+		zap.Int("url_count", urlCount),
+		zap.String("client", clientIdentity(req)),
+		zap.String("request_id", request_id.FromContext(req.Context())),
+		zap.Time("timestamp", time.Now().UTC()),
+	)
+}
+
+// clientIdentity names the client behind a request. There is no authentication,
+// so the client is identified by its address.
+func clientIdentity(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
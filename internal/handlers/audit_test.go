@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDynamicHandler_AuditsStores(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	h := setupTestHandler()
+	h.AuditLogger = zap.New(core)
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/audit-test", strings.NewReader(`{"urls": ["https://example.com/a", "https://example.com/b"]}`))
+	req.RemoteAddr = "203.0.113.7:51234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	require.Equal(t, "store", fields["operation"])
+	require.Equal(t, "audit-test", fields["path"])
+	require.Equal(t, int64(2), fields["url_count"])
+	require.Equal(t, "203.0.113.7", fields["client"])
+	require.WithinDuration(t, time.Now(), fields["timestamp"].(time.Time), time.Minute)
+
+	// Rejected writes are not audited
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/audit-test", strings.NewReader(`{}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Len(t, logs.All(), 1)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+)
+
+// background holds the work a handler keeps running after the request that started it
+// answered, so Close can cancel it and wait for it to finish
+type background struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   sync.WaitGroup
+}
+
+// context returns the context background work runs on, creating it on first use.
+// The caller holds b.mu.
+func (b *background) context() context.Context {
+	if b.ctx == nil {
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+	}
+	return b.ctx
+}
+
+// start runs fn on its own goroutine with the background context. It returns false without
+// running fn once the handler is closed.
+func (b *background) start(fn func(ctx context.Context)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ctx := b.context()
+	if ctx.Err() != nil {
+		return false
+	}
+	b.jobs.Add(1)
+	go func() {
+		defer b.jobs.Done()
+		fn(ctx)
+	}()
+	return true
+}
+
+// Close cancels the refresh jobs and stale cache revalidations still running and waits for
+// them to return, or for ctx to end. Refreshes started after Close are rejected, and stale
+// cache entries are no longer revalidated.
+func (h *DynamicHandler) Close(ctx context.Context) error {
+	h.background.mu.Lock()
+	h.background.context()
+	h.background.cancel()
+	h.background.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.background.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+)
+
+// fetchOutcome is the result of fetching one stored URL
+type fetchOutcome struct {
+	index    int
+	result   map[string]interface{}
+	duration time.Duration
+	// fetchedAt is when the result came from the upstream, earlier than now for cache hits
+	fetchedAt time.Time
+}
+
+// fetchOptions tune how a batch is fetched
+type fetchOptions struct {
+	// timings adds a per-phase timing breakdown to every result
+	timings bool
+	// refresh skips cached results and stores the fresh ones in the cache
+	refresh bool
+	// resolveOnly reports only where each URL redirects to, without downloading bodies
+	resolveOnly bool
+	// head sends HEAD requests, reporting each URL's metadata without its content
+	head bool
+	// extractMeta adds the title and meta description of every HTML result
+	extractMeta bool
+	// onResult, when set, is called with every outcome as soon as it is collected
+	onResult func(fetchOutcome)
+	// persistPath, when set, stores every result on the URLs of that path once the batch is
+	// fetched, cache hits included. Nothing is stored while the handler is ReadOnly.
+	persistPath string
+}
+
+// fetchAll fetches every URL with a fixed pool of workers and returns the outcomes in storage order
+func (h *DynamicHandler) fetchAll(ctx context.Context, urls []db_model.URLRecord, opts fetchOptions) []fetchOutcome {
+	// Feed the URLs to a fixed pool of workers so the number of goroutines
+	// stays bounded by MaxConcurrentFetches regardless of how many URLs are stored
+	type urlJob struct {
+		index  int
+		urlRec db_model.URLRecord
+	}
+	order := make([]int, len(urls))
+	for i := range order {
+		order[i] = i
+	}
+	hosts := newHostLimiter(h.MaxConcurrentFetchesPerHost)
+	if hosts != nil {
+		// Interleave hosts so workers blocked on a busy host don't starve the others
+		order = interleaveByHost(urls)
+	}
+	var duplicates map[int][]int
+	if h.DedupeFetches {
+		order, duplicates = dedupeFetchOrder(urls, order)
+	}
+	jobs := make(chan urlJob)
+	go func() {
+		defer close(jobs)
+		for _, i := range order {
+			jobs <- urlJob{index: i, urlRec: urls[i]}
+		}
+	}()
+
+	workers := h.MaxConcurrentFetches
+	if workers <= 0 {
+		workers = DefaultMaxConcurrentFetches
+	}
+	if workers > len(order) {
+		workers = len(order)
+	}
+
+	// Keep the result buffer small and let the collector below drain it continuously.
+	// Workers block once it is full, so memory stays flat however many URLs are stored.
+	bufferSize := h.ResultBufferSize
+	if bufferSize <= 0 {
+		bufferSize = workers
+	}
+	resultChan := make(chan fetchOutcome, bufferSize)
+
+	batchJar := h.batchCookieJar()
+	budget := newHostByteBudget(h.MaxBytesPerHostPerBatch)
+
+	// Create a WaitGroup to wait for all workers to complete
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				start := time.Now()
+				out := outboundRequest{
+					URL:         job.urlRec.URL,
+					Timeout:     time.Duration(job.urlRec.TimeoutMs) * time.Millisecond,
+					Header:      h.urlHeaders(job.urlRec),
+					Timings:     opts.timings,
+					Jar:         h.urlCookieJar(batchJar),
+					ResolveOnly: opts.resolveOnly,
+					Budget:      budget,
+				}
+				if opts.head {
+					out.Method = http.MethodHead
+				}
+				// Slots are only taken by live fetches, cache hits need none
+				out.Slots = func(ctx context.Context) (func(), error) {
+					releaseGlobal, err := h.acquireFetchSlot(ctx)
+					if err != nil {
+						return nil, err
+					}
+					release := hosts.acquire(urlHost(out.URL))
+					return func() {
+						release()
+						releaseGlobal()
+					}, nil
+				}
+				var result map[string]interface{}
+				var fetchedAt time.Time
+				switch {
+				case opts.timings || opts.resolveOnly || opts.head:
+					// Timings, resolutions and HEAD metadata describe a live fetch without a
+					// cacheable body, so the result cache is bypassed
+					result, fetchedAt = h.fetchURL(ctx, out), h.clock()
+				case opts.refresh && h.ResultCacheTTL > 0:
+					result, fetchedAt = copyResult(h.fetchAndCache(ctx, out)), h.clock()
+				case opts.refresh:
+					result, fetchedAt = h.fetchURL(ctx, out), h.clock()
+				default:
+					result, fetchedAt = h.cachedFetch(ctx, out)
+				}
+				resultChan <- fetchOutcome{index: job.index, result: result, duration: time.Since(start), fetchedAt: fetchedAt}
+			}
+		}()
+	}
+
+	// Close the channel when all workers complete
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	// Collect results in order. Results to persist are written once every fetch is done, a
+	// database round trip per result here would hold up the workers behind resultChan.
+	outcomes := make([]fetchOutcome, len(urls))
+	var fetched []int
+	for outcome := range resultChan {
+		fetched = append(fetched, outcome.index)
+		if opts.extractMeta {
+			extractHTMLMeta(outcome.result)
+		}
+		outcomes[outcome.index] = outcome
+		if opts.onResult != nil {
+			opts.onResult(outcome)
+		}
+		// Repeats of a deduplicated request share its result
+		for _, index := range duplicates[outcome.index] {
+			repeat := fetchOutcome{index: index, result: copyResult(outcome.result), duration: outcome.duration, fetchedAt: outcome.fetchedAt}
+			outcomes[index] = repeat
+			if opts.onResult != nil {
+				opts.onResult(repeat)
+			}
+		}
+	}
+
+	// A read-only instance may be serving from a replica, and writes nothing
+	if opts.persistPath != "" && !h.ReadOnly {
+		for _, index := range fetched {
+			h.persistFetchResult(ctx, opts.persistPath, outcomes[index])
+			if flag, ok := outcomes[index].result["persist_error"]; ok {
+				for _, repeat := range duplicates[index] {
+					outcomes[repeat].result["persist_error"] = flag
+				}
+			}
+		}
+	}
+	return outcomes
+}
+
+// persistFetchResult stores a fetch result on the URL of path it was fetched for. Cache hits are
+// stored too, with the time they were fetched: the entry may come from another path storing the
+// same URL, or from a background revalidation, neither of which stores anything on this path.
+// Content is stored as fetched, CompressCachedContent only applies to the result cache.
+func (h *DynamicHandler) persistFetchResult(ctx context.Context, path string, outcome fetchOutcome) {
+	result := outcome.result
+	record := db_model.URLRecord{FetchedAt: outcome.fetchedAt.UTC()}
+	record.URL, _ = result["url"].(string)
+	record.StatusCode, _ = result["status_code"].(int)
+	record.Content, _ = result["content"].(string)
+	record.FetchError, _ = result["error"].(string)
+	if err := h.DB.StoreFetchResult(ctx, path, record); err != nil {
+		result["persist_error"] = "failed to store fetch result"
+	}
+}
+
+// dedupeFetchOrder drops from order every URL record identical to one earlier in it, so each
+// distinct outbound request is made once. It returns the remaining order and, for each index
+// kept, the indices of its dropped repeats.
+func dedupeFetchOrder(urls []db_model.URLRecord, order []int) ([]int, map[int][]int) {
+	type requestKey struct {
+		url       string
+		timeoutMs int
+		referer   string
+		origin    string
+		headers   string
+	}
+	first := make(map[requestKey]int, len(order))
+	duplicates := make(map[int][]int)
+	kept := make([]int, 0, len(order))
+	for _, i := range order {
+		rec := urls[i]
+		key := requestKey{url: rec.URL, timeoutMs: rec.TimeoutMs, referer: rec.Referer, origin: rec.Origin, headers: headersKey(rec.Headers)}
+		if j, ok := first[key]; ok {
+			duplicates[j] = append(duplicates[j], i)
+			continue
+		}
+		first[key] = i
+		kept = append(kept, i)
+	}
+	return kept, duplicates
+}
+
+// hostLimiter bounds how many fetches of one batch may hit the same host at once
+type hostLimiter struct {
+	mu    sync.Mutex
+	limit int
+	slots map[string]chan struct{}
+}
+
+// newHostLimiter returns a limiter allowing limit fetches per host, or nil when limit is not positive
+func newHostLimiter(limit int) *hostLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &hostLimiter{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+// acquire blocks until host has a free slot and returns the function releasing it.
+// A nil limiter never blocks.
+func (l *hostLimiter) acquire(host string) func() {
+	if l == nil {
+		return func() {}
+	}
+	l.mu.Lock()
+	slots, ok := l.slots[host]
+	if !ok {
+		slots = make(chan struct{}, l.limit)
+		l.slots[host] = slots
+	}
+	l.mu.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// skippedHostByteBudget flags a result not fetched because its host used up its byte budget
+const skippedHostByteBudget = "host_byte_budget"
+
+// hostByteBudget caps the body bytes read from each host within one batch. Hosts are those
+// of the stored URLs, so bytes read after a redirect count against the host redirecting.
+type hostByteBudget struct {
+	mu    sync.Mutex
+	limit int64
+	read  map[string]int64
+}
+
+// newHostByteBudget returns a budget of limit bytes per host, or nil when limit is not positive
+func newHostByteBudget(limit int64) *hostByteBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &hostByteBudget{limit: limit, read: make(map[string]int64)}
+}
+
+// exhausted reports whether host has used up its budget. A nil budget never runs out.
+func (b *hostByteBudget) exhausted(host string) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.read[host] >= b.limit
+}
+
+// charge counts n bytes read from host. Fetches already in flight when the budget runs out
+// still complete, so a host can end up slightly over it.
+func (b *hostByteBudget) charge(host string, n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.read[host] += n
+	b.mu.Unlock()
+}
+
+// interleaveByHost returns the URL indexes ordered round-robin across hosts,
+// keeping storage order within each host
+func interleaveByHost(urls []db_model.URLRecord) []int {
+	var hostOrder []string
+	byHost := make(map[string][]int)
+	for i, urlRec := range urls {
+		host := urlHost(urlRec.URL)
+		if _, ok := byHost[host]; !ok {
+			hostOrder = append(hostOrder, host)
+		}
+		byHost[host] = append(byHost[host], i)
+	}
+
+	order := make([]int, 0, len(urls))
+	for len(order) < len(urls) {
+		for _, host := range hostOrder {
+			if pending := byHost[host]; len(pending) > 0 {
+				order = append(order, pending[0])
+				byHost[host] = pending[1:]
+			}
+		}
+	}
+	return order
+}
+
+// urlHost returns the lower-cased host of rawURL, or "" if it does not parse
+func urlHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
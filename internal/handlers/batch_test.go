@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/stretchr/testify/require"
+)
+
+// BenchmarkFetchAll_ResultBuffer compares a result buffer sized to the whole batch
+// with the default one sized to the worker pool. Run with -benchmem.
+func BenchmarkFetchAll_ResultBuffer(b *testing.B) {
+	// Unsupported schemes fail validation without any network traffic
+	const batchSize = 100000
+	urls := make([]db_model.URLRecord, batchSize)
+	for i := range urls {
+		urls[i] = db_model.URLRecord{URL: fmt.Sprintf("ftp://example.com/%d", i)}
+	}
+
+	for _, bc := range []struct {
+		name       string
+		bufferSize int
+	}{
+		{name: "buffer=batch", bufferSize: batchSize},
+		{name: "buffer=workers", bufferSize: 0},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			h := setupTestHandler()
+			h.ResultBufferSize = bc.bufferSize
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h.fetchAll(context.Background(), urls, fetchOptions{})
+			}
+		})
+	}
+}
+
+func TestDynamicHandler_PerHostConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	maxPerHost := map[string]int{}
+	maxTotal := 0
+	total := 0
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Split(r.Host, ":")[0]
+		mu.Lock()
+		inFlight[host]++
+		total++
+		if inFlight[host] > maxPerHost[host] {
+			maxPerHost[host] = inFlight[host]
+		}
+		if total > maxTotal {
+			maxTotal = total
+		}
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		inFlight[host]--
+		total--
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+
+	require.NoError(t, os.Setenv("GUARDZ_TEST_ALLOWLIST", "127.0.0.1,localhost"))
+	defer func() { _ = os.Unsetenv("GUARDZ_TEST_ALLOWLIST") }()
+
+	// Same-host URLs are stored first so a naive pool would send them all at once
+	sameHost := mockServer.URL
+	otherHost := strings.Replace(mockServer.URL, "127.0.0.1", "localhost", 1)
+	var urls []db_model.URLRecord
+	for i := 0; i < 8; i++ {
+		urls = append(urls, db_model.URLRecord{URL: fmt.Sprintf("%s/same/%d", sameHost, i)})
+	}
+	for i := 0; i < 2; i++ {
+		urls = append(urls, db_model.URLRecord{URL: fmt.Sprintf("%s/other/%d", otherHost, i)})
+	}
+
+	h := setupTestHandler()
+	h.MaxConcurrentFetches = 10
+	h.MaxConcurrentFetchesPerHost = 2
+
+	outcomes := h.fetchAll(context.Background(), urls, fetchOptions{})
+	require.Len(t, outcomes, len(urls))
+	for i, outcome := range outcomes {
+		require.NotContains(t, outcome.result, "error")
+		require.Equal(t, urls[i].URL, outcome.result["url"], "results keep storage order")
+	}
+
+	require.LessOrEqual(t, maxPerHost["127.0.0.1"], 2, "per-host limit exceeded")
+	require.LessOrEqual(t, maxPerHost["localhost"], 2, "per-host limit exceeded")
+	require.Greater(t, maxTotal, 2, "different hosts should be fetched in parallel")
+}
+
+func TestDynamicHandler_FetchRatePerHost(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	var urls []db_model.URLRecord
+	for i := 0; i < 6; i++ {
+		urls = append(urls, db_model.URLRecord{URL: fmt.Sprintf("%s/%d", server.URL, i)})
+	}
+
+	h := setupTestHandler()
+	h.MaxConcurrentFetches = 10
+	h.FetchRatePerHost = 20
+	h.FetchBurstPerHost = 2
+
+	start := time.Now()
+	outcomes := h.fetchAll(context.Background(), urls, fetchOptions{})
+	elapsed := time.Since(start)
+	for _, outcome := range outcomes {
+		require.NotContains(t, outcome.result, "error")
+	}
+	require.Equal(t, int32(len(urls)), atomic.LoadInt32(calls))
+
+	// Two requests go out at once, the other four are spaced 50ms apart
+	require.GreaterOrEqual(t, elapsed, 180*time.Millisecond, "same-host fetches should follow the host's rate")
+}
+
+func TestInterleaveByHost(t *testing.T) {
+	urls := []db_model.URLRecord{
+		{URL: "https://a.example/1"},
+		{URL: "https://a.example/2"},
+		{URL: "https://a.example/3"},
+		{URL: "https://b.example/1"},
+		{URL: "https://c.example/1"},
+	}
+	require.Equal(t, []int{0, 3, 4, 1, 2}, interleaveByHost(urls))
+}
+
+func TestDynamicHandler_DedupeFetches(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.DedupeFetches = true
+	urls := []db_model.URLRecord{
+		{URL: server.URL + "/a"},
+		{URL: server.URL + "/b"},
+		{URL: server.URL + "/a"},
+		{URL: server.URL + "/a"},
+		// Different per-URL settings make a different outbound request
+		{URL: server.URL + "/a", Referer: "https://referrer.example/"},
+	}
+
+	outcomes := h.fetchAll(context.Background(), urls, fetchOptions{})
+	require.Equal(t, int32(3), atomic.LoadInt32(calls), "each distinct request should be made once")
+	require.Len(t, outcomes, len(urls))
+	for i, outcome := range outcomes {
+		require.Equal(t, i, outcome.index)
+		require.Equal(t, urls[i].URL, outcome.result["url"])
+		require.NotEmpty(t, outcome.result["content"], "every slot should be filled")
+	}
+	require.Equal(t, outcomes[0].result["content"], outcomes[2].result["content"])
+	require.Equal(t, outcomes[0].result["content"], outcomes[3].result["content"])
+
+	// Slots get their own copy of the shared result
+	outcomes[2].result["content"] = "changed"
+	require.NotEqual(t, "changed", outcomes[3].result["content"])
+}
+
+func TestDynamicHandler_HostByteBudget(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	defer server.Close()
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.MaxConcurrentFetches = 1
+	h.MaxBytesPerHostPerBatch = 2500
+	h.ResultCacheTTL = time.Minute
+	urls := make([]db_model.URLRecord, 5)
+	for i := range urls {
+		urls[i] = db_model.URLRecord{URL: fmt.Sprintf("%s/%d", server.URL, i)}
+	}
+
+	outcomes := h.fetchAll(context.Background(), urls, fetchOptions{})
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls), "fetching should stop once the host used up its budget")
+	for i, outcome := range outcomes {
+		if i < 3 {
+			require.Len(t, outcome.result["content"], 1000)
+			continue
+		}
+		require.Equal(t, "host_byte_budget", outcome.result["skipped"])
+		require.NotContains(t, outcome.result, "content")
+	}
+
+	// Cached results cost nothing, and skipped URLs were not cached, so the next batch fetches them
+	outcomes = h.fetchAll(context.Background(), urls, fetchOptions{})
+	require.Equal(t, int32(5), atomic.LoadInt32(&calls))
+	for _, outcome := range outcomes {
+		require.Len(t, outcome.result["content"], 1000)
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// DefaultResultCacheMaxEntries bounds the result cache when no size is configured
+const DefaultResultCacheMaxEntries = 1000
+
+// cacheEntry is a cached fetch result for one URL fetched with one set of headers
+type cacheEntry struct {
+	key        string
+	result     map[string]interface{}
+	validators cacheValidators
+	fetchedAt  time.Time
+}
+
+// cacheValidators are the ETag and Last-Modified headers a cached result was served with,
+// sent back as If-None-Match and If-Modified-Since when the result is refetched
+type cacheValidators struct {
+	etag         string
+	lastModified string
+}
+
+// resultCache is a bounded LRU of fetch results keyed by resultCacheKey
+type resultCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+	refreshing map[string]bool
+}
+
+// newResultCache creates a result cache holding at most maxEntries results
+func newResultCache(maxEntries int) *resultCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultResultCacheMaxEntries
+	}
+	return &resultCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		refreshing: make(map[string]bool),
+	}
+}
+
+// get returns the cached entry for key, marking it as recently used
+func (c *resultCache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	c.order.MoveToFront(elem)
+	return *elem.Value.(*cacheEntry), true
+}
+
+// put stores a result for key, evicting the least recently used entry when full
+func (c *resultCache) put(key string, result map[string]interface{}, validators cacheValidators, fetchedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.result = result
+		entry.validators = validators
+		entry.fetchedAt = fetchedAt
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: result, validators: validators, fetchedAt: fetchedAt})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// startRefresh claims the background refresh of key, returning false if one is already running
+func (c *resultCache) startRefresh(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[key] {
+		return false
+	}
+	c.refreshing[key] = true
+	return true
+}
+
+// finishRefresh releases the background refresh of key
+func (c *resultCache) finishRefresh(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.refreshing, key)
+}
+
+// resultCacheable reports whether the result of out may be served from and stored in the
+// result cache. Results reached through an allowlist profile must not be served to requests
+// without it, and a fetch with a cookie jar depends on cookies set by earlier fetches.
+func resultCacheable(ctx context.Context, out outboundRequest) bool {
+	return allowlistProfileFrom(ctx) == nil && out.Jar == nil
+}
+
+// resultCacheKey keys the cached result of out on its URL and the headers it is sent with,
+// so a result fetched with one path's stored credentials is never served to another path
+// storing the same URL without them
+func resultCacheKey(out outboundRequest) string {
+	if len(out.Header) == 0 {
+		return out.URL
+	}
+	// Maps are encoded with sorted keys, and encoding cannot fail on a header
+	encoded, _ := json.Marshal(out.Header)
+	return out.URL + " " + string(encoded)
+}
+
+// resultCacheFor returns the handler's result cache, building it on first use
+func (h *DynamicHandler) resultCacheFor() *resultCache {
+	h.cacheOnce.Do(func() {
+		h.cache = newResultCache(h.ResultCacheMaxEntries)
+	})
+	return h.cache
+}
+
+// clock returns the current time, from the handler's fake clock in tests
+func (h *DynamicHandler) clock() time.Time {
+	if h.now != nil {
+		return h.now()
+	}
+	return time.Now()
+}
+
+// cachedFetchURL serves a URL from the result cache when enabled. Fresh entries are
+// returned as-is; stale entries within the revalidate window are returned immediately
+// while a background fetch refreshes them. Entries older than ResultCacheMaxAge are
+// never served, they are refetched before the request is answered. Results served from the
+// cache are flagged "cached": true.
+func (h *DynamicHandler) cachedFetchURL(ctx context.Context, out outboundRequest) map[string]interface{} {
+	result, _ := h.cachedFetch(ctx, out)
+	return result
+}
+
+// cachedFetch is cachedFetchURL also returning when the result was fetched from the upstream
+func (h *DynamicHandler) cachedFetch(ctx context.Context, out outboundRequest) (map[string]interface{}, time.Time) {
+	if h.ResultCacheTTL <= 0 || !resultCacheable(ctx, out) {
+		return h.fetchURL(ctx, out), h.clock()
+	}
+	cache := h.resultCacheFor()
+	key := resultCacheKey(out)
+
+	if entry, ok := cache.get(key); ok {
+		age := h.clock().Sub(entry.fetchedAt)
+		tooOld := h.ResultCacheMaxAge > 0 && age >= h.ResultCacheMaxAge
+		if age < h.ResultCacheTTL && !tooOld {
+			return cachedResult(entry), entry.fetchedAt
+		}
+		if age < h.ResultCacheTTL+h.ResultCacheStaleWhileRevalidate && !tooOld {
+			if cache.startRefresh(key) {
+				// The inbound request may finish before the refresh does, so it runs on the
+				// handler's background context instead, which Close cancels
+				started := h.background.start(func(ctx context.Context) {
+					defer cache.finishRefresh(key)
+					h.fetchAndCache(ctx, out)
+				})
+				if !started {
+					cache.finishRefresh(key)
+				}
+			}
+			return cachedResult(entry), entry.fetchedAt
+		}
+	}
+	return copyResult(h.fetchAndCache(ctx, out)), h.clock()
+}
+
+// cachedResult returns a copy of a cached entry's result, flagged as served from the cache
+func cachedResult(entry cacheEntry) map[string]interface{} {
+	result := expandResult(entry.result)
+	result["cached"] = true
+	return result
+}
+
+// fetchAndCache fetches a URL and stores successful results in the cache.
+// Failed and partial fetches are not cached so a transient error is retried on the next request,
+// nor are fetches skipped for the batch's host byte budget.
+// A URL already cached is fetched conditionally, and a 304 Not Modified answer keeps the cached
+// result, flagged "not_modified": true, instead of downloading it again.
+func (h *DynamicHandler) fetchAndCache(ctx context.Context, out outboundRequest) map[string]interface{} {
+	if !resultCacheable(ctx, out) {
+		return h.fetchURL(ctx, out)
+	}
+	cache := h.resultCacheFor()
+	key := resultCacheKey(out)
+	previous, havePrevious := cache.get(key)
+	out.Conditional = &conditionalFetch{}
+	if havePrevious {
+		out.Conditional.sent = previous.validators
+	}
+
+	result := h.fetchURL(ctx, out)
+	validators := out.Conditional.received
+	if out.Conditional.notModified {
+		// A 304 may leave out validators that did not change
+		if validators.etag == "" {
+			validators.etag = previous.validators.etag
+		}
+		if validators.lastModified == "" {
+			validators.lastModified = previous.validators.lastModified
+		}
+		cache.put(key, previous.result, validators, h.clock())
+		result = expandResult(previous.result)
+		result["not_modified"] = true
+		return result
+	}
+
+	_, failed := result["error"]
+	_, partial := result["partial"]
+	overBudget := result["skipped"] == skippedHostByteBudget
+	if !failed && !partial && !overBudget {
+		cached := result
+		if h.CompressCachedContent {
+			cached = compressResult(result)
+		}
+		cache.put(key, cached, validators, h.clock())
+	}
+	return result
+}
+
+// copyResult returns a shallow copy so callers cannot modify a cached result
+func copyResult(result map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(result))
+	for k, v := range result {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// compressedContent is a result's content held gzip-compressed in the result cache
+type compressedContent []byte
+
+// compressResult returns a copy of result with its content gzip-compressed for caching.
+// Results without content, or whose content fails to compress, are returned as-is.
+func compressResult(result map[string]interface{}) map[string]interface{} {
+	content, ok := result["content"].(string)
+	if !ok {
+		return result
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		return result
+	}
+	if err := zw.Close(); err != nil {
+		return result
+	}
+	compressed := copyResult(result)
+	compressed["content"] = compressedContent(buf.Bytes())
+	return compressed
+}
+
+// expandResult returns a copy of a cached result with compressed content restored
+func expandResult(result map[string]interface{}) map[string]interface{} {
+	expanded := copyResult(result)
+	compressed, ok := result["content"].(compressedContent)
+	if !ok {
+		return expanded
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err == nil {
+		var content []byte
+		if content, err = io.ReadAll(zr); err == nil {
+			expanded["content"] = string(content)
+			return expanded
+		}
+	}
+	delete(expanded, "content")
+	expanded["error"] = "cached content could not be decompressed: " + err.Error()
+	return expanded
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingServer answers with the number of requests it has served so far
+func countingServer(t *testing.T) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = fmt.Fprintf(w, "response %d", n)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestDynamicHandler_ResultCacheHit(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.ResultCacheTTL = time.Minute
+
+	first := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	second := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+
+	require.Equal(t, int32(1), atomic.LoadInt32(calls), "a cache hit should not reach the upstream")
+	require.Equal(t, "response 1", first["content"])
+	require.Equal(t, "response 1", second["content"])
+	require.NotContains(t, first, "cached", "a live fetch is not flagged")
+	require.Equal(t, true, second["cached"])
+
+	// The flag is added to the copy handed out, not to the cached entry
+	entry, ok := h.resultCacheFor().get(server.URL)
+	require.True(t, ok)
+	require.NotContains(t, entry.result, "cached")
+}
+
+func TestDynamicHandler_ResultCacheDisabled(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+
+	h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+
+	require.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestDynamicHandler_ResultCacheStaleWhileRevalidate(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.ResultCacheTTL = 20 * time.Millisecond
+	h.ResultCacheStaleWhileRevalidate = time.Minute
+
+	first := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "response 1", first["content"])
+
+	time.Sleep(40 * time.Millisecond)
+
+	// The stale result is served immediately and refreshed in the background
+	stale := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "response 1", stale["content"])
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(calls) == 2
+	}, time.Second, 5*time.Millisecond, "a stale entry should trigger a background refresh")
+
+	require.Eventually(t, func() bool {
+		refreshed := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+		return refreshed["content"] == "response 2"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestDynamicHandler_CloseCancelsCacheRevalidation(t *testing.T) {
+	// The first fetch is answered, revalidations hang until their request is cancelled
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > 1 {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte("first"))
+	}))
+	defer server.Close()
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	clock := time.Now()
+	h := setupTestHandler()
+	h.now = func() time.Time { return clock }
+	h.ResultCacheTTL = time.Minute
+	h.ResultCacheStaleWhileRevalidate = time.Hour
+
+	h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	clock = clock.Add(2 * time.Minute)
+	stale := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "first", stale["content"])
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, h.Close(ctx), "Close should cancel and await the revalidation")
+
+	// Once closed, stale entries are still served but not revalidated
+	stale = h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "first", stale["content"])
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestDynamicHandler_ResultCacheMaxAgeForcesRefresh(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	clock := time.Now()
+	h := setupTestHandler()
+	h.now = func() time.Time { return clock }
+	h.ResultCacheTTL = time.Minute
+	h.ResultCacheStaleWhileRevalidate = time.Hour
+	h.ResultCacheMaxAge = 10 * time.Minute
+
+	first := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "response 1", first["content"])
+
+	// Past the ceiling but well within the revalidate window the stale result is not served
+	clock = clock.Add(11 * time.Minute)
+	result := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "response 2", result["content"], "the refresh should block the request")
+	require.Equal(t, int32(2), atomic.LoadInt32(calls))
+
+	// The refreshed result is fresh again
+	again := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "response 2", again["content"])
+	require.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestDynamicHandler_ResultCacheExpired(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.ResultCacheTTL = 10 * time.Millisecond
+
+	h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	time.Sleep(20 * time.Millisecond)
+
+	// Past the TTL with no revalidate window the fetch happens inline
+	result := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, int32(2), atomic.LoadInt32(calls))
+	require.Equal(t, "response 2", result["content"])
+}
+
+func TestResultCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newResultCache(2)
+	now := time.Now()
+
+	cache.put("a", map[string]interface{}{"url": "a"}, cacheValidators{}, now)
+	cache.put("b", map[string]interface{}{"url": "b"}, cacheValidators{}, now)
+	_, ok := cache.get("a")
+	require.True(t, ok)
+	cache.put("c", map[string]interface{}{"url": "c"}, cacheValidators{}, now)
+
+	_, ok = cache.get("b")
+	require.False(t, ok, "least recently used entry should be evicted")
+	_, ok = cache.get("a")
+	require.True(t, ok)
+	_, ok = cache.get("c")
+	require.True(t, ok)
+}
+
+func TestDynamicHandler_CompressCachedContent(t *testing.T) {
+	text := strings.Repeat("compressible text ", 1000)
+	binary := make([]byte, 4096)
+	for i := range binary {
+		binary[i] = byte(i * 7)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/binary" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(binary)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(text))
+	}))
+	defer server.Close()
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.ResultCacheTTL = time.Minute
+	h.CompressCachedContent = true
+
+	for _, path := range []string{"/text", "/binary"} {
+		out := outboundRequest{URL: server.URL + path}
+		fetched := h.cachedFetchURL(context.Background(), out)
+		cached := h.cachedFetchURL(context.Background(), out)
+		require.Nil(t, cached["error"])
+		require.Equal(t, fetched["content"], cached["content"], "%s round-trips through compressed storage", path)
+
+		entry, ok := h.resultCacheFor().get(out.URL)
+		require.True(t, ok)
+		require.IsType(t, compressedContent{}, entry.result["content"], "the cache holds %s compressed", path)
+	}
+
+	entry, _ := h.resultCacheFor().get(server.URL + "/text")
+	require.Less(t, len(entry.result["content"].(compressedContent)), len(text)/10)
+
+	cached := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL + "/binary"})
+	decoded, err := base64.StdEncoding.DecodeString(cached["content"].(string))
+	require.NoError(t, err)
+	require.Equal(t, binary, decoded)
+}
+
+func TestDynamicHandler_ResultCacheRevalidatesConditionally(t *testing.T) {
+	var bodies, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		n := atomic.AddInt32(&bodies, 1)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = fmt.Fprintf(w, "response %d", n)
+	}))
+	defer server.Close()
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	clock := time.Now()
+	h := setupTestHandler()
+	h.now = func() time.Time { return clock }
+	h.ResultCacheTTL = time.Minute
+
+	first := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "response 1", first["content"])
+	require.NotContains(t, first, "not_modified")
+
+	// Past the TTL the result is revalidated instead of downloaded again
+	clock = clock.Add(2 * time.Minute)
+	second := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+	require.Equal(t, int32(1), atomic.LoadInt32(&bodies), "a 304 should not download the body again")
+	require.Equal(t, "response 1", second["content"], "the cached body should be reused")
+	require.Equal(t, http.StatusOK, second["status_code"])
+	require.Equal(t, true, second["not_modified"])
+
+	// The revalidated result is fresh again
+	third := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, true, third["cached"])
+	require.Equal(t, int32(1), atomic.LoadInt32(&notModified))
+}
+
+func TestDynamicHandler_UnconditionalWithoutValidators(t *testing.T) {
+	var conditional int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			atomic.AddInt32(&conditional, 1)
+		}
+		_, _ = w.Write([]byte("no validators"))
+	}))
+	defer server.Close()
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	clock := time.Now()
+	h := setupTestHandler()
+	h.now = func() time.Time { return clock }
+	h.ResultCacheTTL = time.Minute
+
+	h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	clock = clock.Add(2 * time.Minute)
+	result := h.cachedFetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "no validators", result["content"])
+	require.Zero(t, atomic.LoadInt32(&conditional), "a result cached without validators is refetched in full")
+}
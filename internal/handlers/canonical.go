@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// defaultPorts maps schemes to the port implied when none is given
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicalizeURL rewrites a URL into a canonical form so equivalent URLs compare equal:
+// lowercase scheme and host, no default port, an explicit root path, query parameters
+// sorted by name and no fragment
+func canonicalizeURL(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	if port := parsed.Port(); port != "" && port == defaultPorts[parsed.Scheme] {
+		parsed.Host = strings.TrimSuffix(parsed.Host, ":"+port)
+	}
+	if parsed.Path == "" && parsed.Host != "" {
+		parsed.Path = "/"
+	}
+
+	// Sort the raw pairs rather than re-encoding them, so escaping is left as the client sent it
+	if parsed.RawQuery != "" {
+		pairs := strings.Split(parsed.RawQuery, "&")
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return queryKey(pairs[i]) < queryKey(pairs[j])
+		})
+		parsed.RawQuery = strings.Join(pairs, "&")
+	}
+	parsed.ForceQuery = false
+
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	return parsed.String(), nil
+}
+
+// queryKey returns the name part of a raw query pair
+func queryKey(pair string) string {
+	key, _, _ := strings.Cut(pair, "=")
+	return key
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCanonicalizeURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		equivalent []string
+		expected   string
+	}{
+		{
+			name:       "case, default port and fragment",
+			equivalent: []string{"HTTPS://Example.COM:443/a#frag", "https://example.com/a", "https://EXAMPLE.com/a#other"},
+			expected:   "https://example.com/a",
+		},
+		{
+			name:       "empty path and default http port",
+			equivalent: []string{"http://example.com:80", "http://example.com", "http://example.com/"},
+			expected:   "http://example.com/",
+		},
+		{
+			name:       "query parameter order",
+			equivalent: []string{"https://example.com/s?b=2&a=1", "https://example.com/s?a=1&b=2", "https://example.com/s?b=2&a=1#top"},
+			expected:   "https://example.com/s?a=1&b=2",
+		},
+		{
+			name:       "non-default port is kept",
+			equivalent: []string{"http://Example.com:8080/x", "http://example.com:8080/x"},
+			expected:   "http://example.com:8080/x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, rawURL := range tt.equivalent {
+				canonical, err := canonicalizeURL(rawURL)
+				require.NoError(t, err)
+				require.Equal(t, tt.expected, canonical, rawURL)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeURL_KeepsRepeatedParameterOrder(t *testing.T) {
+	canonical, err := canonicalizeURL("https://example.com/?tag=b&id=1&tag=a")
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/?id=1&tag=b&tag=a", canonical)
+}
+
+func TestDynamicHandler_CanonicalizeURLs(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.CanonicalizeURLs = true
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	upper := strings.Replace(mockServer.URL, "http://", "HTTP://", 1)
+	body, _ := json.Marshal(map[string]interface{}{"urls": []string{
+		upper + "?b=2&a=1#section",
+		mockServer.URL + "/?a=1&b=2",
+	}})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/canonical-test", bytes.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	stored, err := h.DB.GetURLsByPath(context.Background(), "canonical-test")
+	require.NoError(t, err)
+	require.Len(t, stored, 1, "equivalent URLs are stored once")
+	require.Equal(t, mockServer.URL+"/?a=1&b=2", stored[0].URL)
+}
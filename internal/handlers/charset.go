@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"fmt"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// decodeCharset transcodes text declared in charset to UTF-8. It reports false when the
+// charset already is UTF-8 and nothing was converted.
+func decodeCharset(text []byte, charset string) ([]byte, bool, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, false, fmt.Errorf("unsupported charset %q", charset)
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return text, false, nil
+	}
+	decoded, err := enc.NewDecoder().Bytes(text)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode charset %q: %w", charset, err)
+	}
+	return decoded, true, nil
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// contentDenylistError is the error of a result whose body is on ContentHashDenylist
+const contentDenylistError = "content matches denylist"
+
+// deniedContentHash returns the hex SHA-256 of body and whether it is on ContentHashDenylist.
+// Nothing is hashed while the denylist is empty.
+func (h *DynamicHandler) deniedContentHash(body []byte) (string, bool) {
+	h.contentDenylistOnce.Do(func() {
+		h.contentDenylist = make(map[string]bool, len(h.ContentHashDenylist))
+		for _, hash := range h.ContentHashDenylist {
+			h.contentDenylist[strings.ToLower(strings.TrimSpace(hash))] = true
+		}
+	})
+	if len(h.contentDenylist) == 0 {
+		return "", false
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	return hash, h.contentDenylist[hash]
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicHandler_ContentHashDenylist(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/bad" {
+			_, _ = w.Write([]byte("known malicious payload"))
+			return
+		}
+		_, _ = w.Write([]byte("harmless"))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	sum := sha256.Sum256([]byte("known malicious payload"))
+	badHash := hex.EncodeToString(sum[:])
+
+	h := setupTestHandler()
+	// Hashes are matched case-insensitively
+	h.ContentHashDenylist = []string{strings.ToUpper(badHash)}
+
+	result := h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL + "/bad"})
+	require.Equal(t, contentDenylistError, result["error"])
+	require.Equal(t, badHash, result["content_sha256"])
+	require.NotContains(t, result, "content", "denied content must not be returned")
+
+	result = h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL + "/good"})
+	require.Equal(t, "harmless", result["content"])
+	require.NotContains(t, result, "content_sha256")
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// CookieJarScope controls which upstream fetches share cookies set by upstreams
+type CookieJarScope string
+
+const (
+	// CookieJarOff drops every cookie set by an upstream
+	CookieJarOff CookieJarScope = "off"
+	// CookieJarPerURL carries cookies across the redirect hops of a single URL fetch
+	CookieJarPerURL CookieJarScope = "url"
+	// CookieJarPerBatch shares cookies between all URLs fetched for one request
+	CookieJarPerBatch CookieJarScope = "batch"
+)
+
+// ParseCookieJarScope parses a CookieJarScope, rejecting unknown values rather than dropping
+// cookies silently. An empty value means off.
+func ParseCookieJarScope(raw string) (CookieJarScope, error) {
+	switch scope := CookieJarScope(raw); scope {
+	case "":
+		return CookieJarOff, nil
+	case CookieJarOff, CookieJarPerURL, CookieJarPerBatch:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown scope %q (use off, url or batch)", raw)
+	}
+}
+
+// newCookieJar returns an empty cookie jar
+func newCookieJar() http.CookieJar {
+	// cookiejar.New only fails on invalid options
+	jar, _ := cookiejar.New(nil)
+	return jar
+}
+
+// batchCookieJar returns the jar shared by every fetch of a batch, or nil unless CookieJarScope is per batch
+func (h *DynamicHandler) batchCookieJar() http.CookieJar {
+	if h.CookieJarScope != CookieJarPerBatch {
+		return nil
+	}
+	return newCookieJar()
+}
+
+// urlCookieJar returns the jar for a single URL fetch, reusing the batch jar when there is one
+func (h *DynamicHandler) urlCookieJar(batchJar http.CookieJar) http.CookieJar {
+	if batchJar != nil {
+		return batchJar
+	}
+	if h.CookieJarScope != CookieJarPerURL {
+		return nil
+	}
+	return newCookieJar()
+}
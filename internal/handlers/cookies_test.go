@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionServer sets a session cookie on /login before redirecting to /final, which requires it
+func sessionServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/final":
+			if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "abc" {
+				http.Error(w, "no session", http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("welcome"))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDynamicHandler_CookieJarAcrossRedirects(t *testing.T) {
+	server := sessionServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	outcomes := h.fetchAll(context.Background(), []db_model.URLRecord{{URL: server.URL + "/login"}}, fetchOptions{})
+	require.Equal(t, http.StatusUnauthorized, outcomes[0].result["status_code"], "cookies are dropped by default")
+
+	h.CookieJarScope = CookieJarPerURL
+	outcomes = h.fetchAll(context.Background(), []db_model.URLRecord{{URL: server.URL + "/login"}}, fetchOptions{})
+	require.Equal(t, http.StatusOK, outcomes[0].result["status_code"])
+	require.Equal(t, "welcome", outcomes[0].result["content"])
+}
+
+func TestDynamicHandler_CookieJarScope(t *testing.T) {
+	server := sessionServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	// A single worker fetches the URLs in storage order, so the login happens first
+	urls := []db_model.URLRecord{{URL: server.URL + "/login"}, {URL: server.URL + "/final"}}
+	h := setupTestHandler()
+	h.MaxConcurrentFetches = 1
+
+	h.CookieJarScope = CookieJarPerURL
+	outcomes := h.fetchAll(context.Background(), urls, fetchOptions{})
+	require.Equal(t, http.StatusOK, outcomes[0].result["status_code"])
+	require.Equal(t, http.StatusUnauthorized, outcomes[1].result["status_code"], "cookies must not leak to other URLs")
+
+	h.CookieJarScope = CookieJarPerBatch
+	outcomes = h.fetchAll(context.Background(), urls, fetchOptions{})
+	require.Equal(t, http.StatusOK, outcomes[0].result["status_code"])
+	require.Equal(t, http.StatusOK, outcomes[1].result["status_code"], "a batch jar shares the session")
+}
+
+func TestDynamicHandler_CookieJarBypassesResultCache(t *testing.T) {
+	server := sessionServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.ResultCacheTTL = time.Minute
+	h.MaxConcurrentFetches = 1
+
+	// Without the session /final is refused, and the refusal is cached
+	final := []db_model.URLRecord{{URL: server.URL + "/final"}}
+	outcomes := h.fetchAll(context.Background(), final, fetchOptions{})
+	require.Equal(t, http.StatusUnauthorized, outcomes[0].result["status_code"])
+
+	h.CookieJarScope = CookieJarPerBatch
+	urls := []db_model.URLRecord{{URL: server.URL + "/login"}, {URL: server.URL + "/final"}}
+	outcomes = h.fetchAll(context.Background(), urls, fetchOptions{})
+	require.Equal(t, http.StatusOK, outcomes[1].result["status_code"], "a fetch with the batch's cookies is not served from the cache")
+	require.Nil(t, outcomes[1].result["cached"])
+
+	h.CookieJarScope = CookieJarOff
+	outcomes = h.fetchAll(context.Background(), final, fetchOptions{})
+	require.Equal(t, http.StatusUnauthorized, outcomes[0].result["status_code"], "a result fetched with cookies is not cached for fetches without them")
+}
+
+func TestParseCookieJarScope(t *testing.T) {
+	for raw, want := range map[string]CookieJarScope{"": CookieJarOff, "off": CookieJarOff, "url": CookieJarPerURL, "batch": CookieJarPerBatch} {
+		scope, err := ParseCookieJarScope(raw)
+		require.NoError(t, err, raw)
+		require.Equal(t, want, scope, raw)
+	}
+	for _, raw := range []string{"URL", "per-batch", "on"} {
+		_, err := ParseCookieJarScope(raw)
+		require.Error(t, err, raw)
+	}
+}
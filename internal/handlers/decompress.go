@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultMaxDecompressionRatio is the largest decompressed-to-compressed ratio accepted by default
+	DefaultMaxDecompressionRatio = 100
+	// DefaultMaxDecompressedBytes caps the decompressed size of a response body by default
+	DefaultMaxDecompressedBytes = 1 << 20 // 1MB
+
+	// decompressionRatioFloor is how much must be decompressed before the ratio is checked,
+	// so small, highly repetitive bodies are not mistaken for bombs
+	decompressionRatioFloor = 64 << 10
+)
+
+// errDecompressionBomb aborts reading a compressed body that expands beyond the configured limits
+var errDecompressionBomb = errors.New("decompression bomb detected")
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// bombGuardReader reads decompressed output, failing once it exceeds the absolute cap
+// or expands too far relative to the compressed bytes consumed
+type bombGuardReader struct {
+	decompressed io.Reader
+	compressed   *countingReader
+	maxBytes     int64
+	maxRatio     float64
+	n            int64
+}
+
+func (b *bombGuardReader) Read(p []byte) (int, error) {
+	n, err := b.decompressed.Read(p)
+	b.n += int64(n)
+	if b.maxBytes > 0 && b.n > b.maxBytes {
+		return n, errDecompressionBomb
+	}
+	if b.maxRatio > 0 && b.n > decompressionRatioFloor && b.compressed.n > 0 &&
+		float64(b.n)/float64(b.compressed.n) > b.maxRatio {
+		return n, errDecompressionBomb
+	}
+	return n, err
+}
+
+// decodedBody returns the response body, decompressing gzip and deflate behind the bomb guard,
+// along with the Content-Encoding that was decoded. Bodies with any other Content-Encoding
+// are returned unchanged with an empty encoding.
+func (h *DynamicHandler) decodedBody(resp *http.Response) (io.Reader, string, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "deflate" {
+		return resp.Body, "", nil
+	}
+	compressed := &countingReader{r: resp.Body}
+	var decompressed io.Reader
+	var err error
+	if encoding == "gzip" {
+		decompressed, err = gzip.NewReader(compressed)
+	} else {
+		decompressed, err = newDeflateReader(compressed)
+	}
+	if errors.Is(err, io.EOF) {
+		// HEAD responses and empty bodies carry the header without any content
+		return http.NoBody, encoding, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &bombGuardReader{
+		decompressed: decompressed,
+		compressed:   compressed,
+		maxBytes:     h.MaxDecompressedBytes,
+		maxRatio:     h.MaxDecompressionRatio,
+	}, encoding, nil
+}
+
+// newDeflateReader decompresses a deflate body. HTTP defines deflate as zlib-wrapped, but some
+// servers send a raw deflate stream, so the zlib header is checked before choosing a reader.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	// A zlib header uses compression method 8 and its two bytes are a multiple of 31
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
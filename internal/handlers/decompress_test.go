@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gzipServer serves body gzip-compressed with a matching Content-Encoding
+func gzipServer(t *testing.T, body []byte) *httptest.Server {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return encodedServer(t, "gzip", buf.Bytes())
+}
+
+// encodedServer serves an already encoded body with the given Content-Encoding
+func encodedServer(t *testing.T, encoding string, encoded []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", encoding)
+		_, _ = w.Write(encoded)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDynamicHandler_DecompressesGzip(t *testing.T) {
+	server := gzipServer(t, []byte("hello, compressed world"))
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.NotContains(t, result, "error")
+	require.Equal(t, "hello, compressed world", result["content"])
+	require.Equal(t, "gzip", result["content_encoding_original"])
+}
+
+func TestDynamicHandler_DecompressesDeflate(t *testing.T) {
+	var zlibBody bytes.Buffer
+	zw := zlib.NewWriter(&zlibBody)
+	_, err := zw.Write([]byte("hello, zlib world"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	var rawBody bytes.Buffer
+	fw, err := flate.NewWriter(&rawBody, flate.DefaultCompression)
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("hello, raw deflate world"))
+	require.NoError(t, err)
+	require.NoError(t, fw.Close())
+
+	tests := []struct {
+		name    string
+		encoded []byte
+		want    string
+	}{
+		{name: "zlib wrapped", encoded: zlibBody.Bytes(), want: "hello, zlib world"},
+		{name: "raw deflate", encoded: rawBody.Bytes(), want: "hello, raw deflate world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := encodedServer(t, "deflate", tt.encoded)
+			cleanup := allowlistTestServer(t, server.URL)
+			defer cleanup()
+
+			h := setupTestHandler()
+			result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL})
+			require.NotContains(t, result, "error")
+			require.Equal(t, tt.want, result["content"])
+			require.Equal(t, "deflate", result["content_encoding_original"])
+		})
+	}
+}
+
+func TestDynamicHandler_UnsupportedEncodingPassesThrough(t *testing.T) {
+	server := encodedServer(t, "identity", []byte("plain body"))
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "plain body", result["content"])
+	require.NotContains(t, result, "content_encoding_original")
+}
+
+func TestDynamicHandler_DecompressionBombRatio(t *testing.T) {
+	// 8MB of zeros compresses to a few KB
+	server := gzipServer(t, make([]byte, 8<<20))
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.MaxDecompressionRatio = 100
+
+	result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "decompression bomb detected", result["error"])
+	require.NotContains(t, result, "content")
+}
+
+func TestDynamicHandler_DecompressionBombAbsoluteCap(t *testing.T) {
+	// Random bytes barely compress, so only the absolute cap can trip
+	body := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(body)
+	server := gzipServer(t, body)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.MaxDecompressionRatio = 0
+	h.MaxDecompressedBytes = 32 << 10
+
+	result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "decompression bomb detected", result["error"])
+
+	h.MaxDecompressedBytes = 0
+	result = h.fetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.NotContains(t, result, "error")
+}
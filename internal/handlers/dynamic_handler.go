@@ -1,314 +1,749 @@
 package handlers
 
 import (
-	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net"
+	"mime"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unicode/utf8"
-
-	"github.com/shaibs3/Guardz/internal/db_model"
 
 	"github.com/gorilla/mux"
+	"github.com/shaibs3/Guardz/internal/db_model"
 	"github.com/shaibs3/Guardz/internal/lookup"
+	"github.com/shaibs3/Guardz/internal/render"
 	"go.uber.org/zap"
 )
 
+// DefaultMaxConcurrentFetches is the number of URLs fetched in parallel for a single GET
+const DefaultMaxConcurrentFetches = 10
+
+const (
+	// minSearchQueryLength keeps /_search from matching nearly every stored URL
+	minSearchQueryLength = 3
+	// maxSearchResults bounds the matches returned by /_search
+	maxSearchResults = 100
+)
+
 // DynamicHandler handles dynamic path requests
 type DynamicHandler struct {
 	DB lookup.DbProvider
+
+	// MaxConcurrentFetches is the size of the worker pool fetching URLs for a single GET
+	MaxConcurrentFetches int
+
+	// MaxConcurrentFetchesPerHost bounds parallel fetches to a single host within one GET.
+	// Zero disables the per-host limit.
+	MaxConcurrentFetchesPerHost int
+
+	// MaxBytesPerHostPerBatch caps the body bytes read from a single host within one GET. Once a
+	// host has used it up, its remaining URLs are skipped. Zero disables the budget.
+	MaxBytesPerHostPerBatch int64
+
+	// FetchRatePerHost limits the requests per second sent to a single upstream host, across all
+	// requests. Zero disables the rate limit.
+	FetchRatePerHost float64
+
+	// FetchBurstPerHost is how many requests a host may be sent at once before FetchRatePerHost
+	// applies. Zero or less allows one.
+	FetchBurstPerHost int
+
+	// MaxGlobalFetches bounds outbound fetches in flight across all requests. Zero disables the limit.
+	MaxGlobalFetches int
+
+	// FetchQueueTimeout is how long a GET waits for the global fetch limit to free up before it is
+	// shed with 503 and a Retry-After. Zero sheds it at once while every fetch slot is taken.
+	FetchQueueTimeout time.Duration
+
+	// RetryAfterMax caps the Retry-After advertised on a shed GET, like the router's cap on 429
+	// responses. Zero leaves it uncapped.
+	RetryAfterMax time.Duration
+
+	// MaxFetchQueue bounds how many fetches may wait in line for MaxGlobalFetches; a fetch
+	// beyond it fails at once. Zero leaves the queue unbounded.
+	MaxFetchQueue int
+
+	// FetchQueueDeadline is how long a queued fetch waits for its turn before it fails. Zero
+	// waits as long as its request does.
+	FetchQueueDeadline time.Duration
+
+	// DedupeFetches fetches a URL stored several times under a path once and shares the result
+	// between its slots. Repeats only count when their per-URL settings match too.
+	DedupeFetches bool
+
+	// ResultBufferSize is the capacity of the channel carrying fetch results to the collector.
+	// Zero sizes it to the worker pool.
+	ResultBufferSize int
+
+	// TextMIMEAllowlist lists the media types that may be inlined as raw text.
+	// Text responses of any other type are base64-encoded. Empty allows all text types.
+	TextMIMEAllowlist []string
+
+	// InvalidUTF8Policy decides how text responses with invalid UTF-8 are returned
+	InvalidUTF8Policy InvalidUTF8Policy
+
+	// ReadOnly rejects every mutating request with 503 while fetching keeps working
+	ReadOnly bool
+
+	// StrictContentType rejects POST and PATCH bodies not sent as application/json with 415
+	StrictContentType bool
+
+	// ExplicitRoutes adds /_store/{path} for POST and PATCH and /_fetch/{path} for GET and HEAD
+	// alongside the method-based catch-all, which is kept for compatibility
+	ExplicitRoutes bool
+
+	// ValidationMetrics, when set, counts URLs rejected by validation per stage
+	ValidationMetrics *ValidationMetrics
+
+	// HostBreakers configures the circuit breaker kept for every upstream host, so a host that
+	// keeps failing is skipped for a while instead of being fetched again on every GET
+	HostBreakers HostBreakerSettings
+
+	// BreakerMetrics, when set, counts host circuit breaker state changes
+	BreakerMetrics *BreakerMetrics
+
+	// AdminToken is the bearer token admin endpoints require. They are not served when it is empty.
+	AdminToken string
+
+	// AuditLogger, when set, records every store, clear and add with the path, URL count and client
+	AuditLogger *zap.Logger
+
+	// MaxConcurrentStores bounds how many POST and PATCH stores may run against the database at once.
+	// Stores beyond it are rejected with 503. Zero disables the limit.
+	MaxConcurrentStores int
+
+	// CanonicalizeURLs stores URLs in canonical form so equivalent URLs dedupe and compare consistently
+	CanonicalizeURLs bool
+
+	// AllowClearOnEmptyPost lets a POST with an empty urls array clear the path instead of failing with 400
+	AllowClearOnEmptyPost bool
+
+	// AllowedOutboundMethods lists the HTTP methods that may be sent upstream. Empty allows all.
+	AllowedOutboundMethods []string
+
+	// HostPolicy restricts the hosts that may be stored and fetched. Nil allows every host.
+	HostPolicy *HostPolicy
+
+	// MetadataEndpoints lists cloud metadata host names and addresses that are never fetched,
+	// whatever an allowlist says
+	MetadataEndpoints []string
+
+	// SSRFPolicy decides which URLs may be fetched. Nil uses DefaultSSRFPolicy.
+	SSRFPolicy SSRFPolicy
+
+	// Resolver resolves outbound hosts for validation and the dialer. Nil uses net.DefaultResolver.
+	Resolver HostResolver
+
+	// FetchTimeout is the timeout of each upstream fetch stored without a timeout hint.
+	// Zero uses MaxFetchTimeout.
+	FetchTimeout time.Duration
+
+	// MaxFetchTimeout bounds every upstream fetch, including URLs stored with a longer timeout hint
+	MaxFetchTimeout time.Duration
+
+	// MaxURLLength is the longest URL accepted for storage or fetching. Zero disables the check.
+	MaxURLLength int
+
+	// MaxResponseHeaderBytes caps the size of upstream response headers
+	MaxResponseHeaderBytes int64
+
+	// OutboundSourceIP binds upstream connections to this local address. Empty lets the OS choose.
+	OutboundSourceIP string
+
+	// OutboundProxy routes every upstream fetch through an http, https or socks5 proxy, tunneling
+	// to the address each target was validated at. Nil connects to upstreams directly.
+	OutboundProxy *url.URL
+
+	// DefaultReferer and DefaultOrigin are sent upstream for URLs stored without their own.
+	// Empty sends no header.
+	DefaultReferer string
+	DefaultOrigin  string
+
+	// AllowedRedirectCodes lists the redirect status codes that may be followed, e.g. 301 and 302
+	// but not the method-preserving 307 and 308. Empty allows all.
+	AllowedRedirectCodes []int
+
+	// SuccessBodiesOnly returns content only for successful statuses. Other responses keep their
+	// status code and content type and are flagged "body_omitted": "status" without being read.
+	SuccessBodiesOnly bool
+
+	// SuccessStatuses lists the status codes SuccessBodiesOnly returns content for. Empty means every 2xx.
+	SuccessStatuses []int
+
+	// MaxRedirects is the redirect hop that fails a fetch with too many redirects, so one fewer
+	// hops are followed. One or less follows none.
+	MaxRedirects int
+
+	// CrossHostRedirectLimit caps redirect hops that move to a different host. Negative disables the cap.
+	CrossHostRedirectLimit int
+
+	// MaxOutboundBodyBytes caps the body replayed to an upstream. Zero disables the check.
+	MaxOutboundBodyBytes int64
+
+	// MaxDecompressionRatio aborts a gzip body that expands beyond this many times its compressed size.
+	// Zero disables the ratio check.
+	MaxDecompressionRatio float64
+
+	// MaxDecompressedBytes aborts a gzip body that decompresses beyond this size. Zero disables the cap.
+	MaxDecompressedBytes int64
+
+	// ReturnPartialReads returns the bytes read before an upstream dropped the connection,
+	// flagged "partial": true, instead of failing the whole result
+	ReturnPartialReads bool
+
+	// CorrelationIDHeader names the outbound header carrying the inbound request ID, so upstream
+	// logs can be correlated. Empty disables it.
+	CorrelationIDHeader string
+
+	// OutboundHeaderDenylist lists headers that are never sent to upstreams
+	OutboundHeaderDenylist []string
+
+	// MaxQueryOverrides caps the number of query parameters on a GET, counting every occurrence
+	// before the query is parsed so a flood of parameters is rejected cheaply. Zero disables the cap.
+	MaxQueryOverrides int
+
+	// AllowlistProfiles are named sets of hosts exempt from SSRF protection. A request selects one
+	// through AllowlistProfileHeader and must bear one of the profile's API keys.
+	AllowlistProfiles map[string]AllowlistProfile
+
+	// AllowlistProfileHeader names the header selecting an allowlist profile. Empty uses DefaultAllowlistProfileHeader.
+	AllowlistProfileHeader string
+
+	// CompressCachedContent keeps the content of results in the in-memory result cache
+	// gzip-compressed, trading CPU on every cache hit for memory. Persisted fetch results are
+	// stored uncompressed.
+	CompressCachedContent bool
+
+	// ResultCacheTTL is how long a fetch result is served from cache. Zero disables the cache.
+	ResultCacheTTL time.Duration
+
+	// ResultCacheStaleWhileRevalidate is how long past its TTL a result is still served
+	// while it is refreshed in the background
+	ResultCacheStaleWhileRevalidate time.Duration
+
+	// ResultCacheMaxAge is the oldest a cached result may be and still be served, even while
+	// stale-while-revalidate would allow it. Older results are refetched before answering.
+	// Zero sets no ceiling.
+	ResultCacheMaxAge time.Duration
+
+	// ResultCacheMaxEntries bounds the number of cached results
+	ResultCacheMaxEntries int
+
+	// MetadataOnlyAboveBytes answers URLs whose HEAD reports a larger Content-Length with
+	// metadata only, flagged "body_omitted": "size_threshold". Zero disables the tier.
+	MetadataOnlyAboveBytes int64
+
+	// SkipFetchAboveBytes skips URLs whose HEAD reports a larger Content-Length altogether.
+	// Zero disables the tier.
+	SkipFetchAboveBytes int64
+
+	// CookieJarScope decides whether cookies set by upstreams are kept for the redirect hops
+	// of one URL, shared across a whole batch, or dropped
+	CookieJarScope CookieJarScope
+
+	// JobTTL is how long the results of a completed refresh job are kept. Polling an expired
+	// job answers 410 Gone. Zero keeps results until the job is forgotten.
+	JobTTL time.Duration
+
+	// MaxRunningRefreshJobs bounds how many refresh jobs run at once. Starting another answers
+	// 503 until one finishes. Zero disables the limit.
+	MaxRunningRefreshJobs int
+
+	// PersistFetchResults stores the status code, content, error and time of every live fetch
+	// on the stored URL, where GET with fetch=false serves it
+	PersistFetchResults bool
+
+	// UserAgent is the User-Agent header sent with every fetch when UserAgents is empty
+	UserAgent string
+
+	// UserAgents, when set, is a pool of User-Agent headers fetches rotate through in turn
+	UserAgents []string
+
+	// ContentHashDenylist lists hex SHA-256 hashes of known-bad content. A fetched body matching
+	// one is dropped from its result, which reports the error and the hash instead.
+	ContentHashDenylist []string
+
+	transportOnce sync.Once
+	transport     *http.Transport
+
+	cacheOnce sync.Once
+	cache     *resultCache
+
+	contentDenylistOnce sync.Once
+	contentDenylist     map[string]bool
+
+	// now replaces time.Now for cache ages in tests
+	now func() time.Time
+
+	storeSlotsOnce sync.Once
+	storeSlots     chan struct{}
+
+	fetchSlotsOnce sync.Once
+	fetchSlots     *fetchQueue
+
+	breakers hostBreakers
+
+	hostRates hostRates
+
+	userAgentTurn atomic.Uint64
+
+	refreshJobs refreshJobs
+
+	refreshSlotsOnce sync.Once
+	refreshSlots     chan struct{}
+
+	background background
 }
 
 // NewDynamicHandler creates a new dynamic handler
 func NewDynamicHandler(dbProvider lookup.DbProvider) *DynamicHandler {
-	return &DynamicHandler{DB: dbProvider}
+	return &DynamicHandler{
+		DB:                   dbProvider,
+		MaxConcurrentFetches: DefaultMaxConcurrentFetches,
+		InvalidUTF8Policy:    InvalidUTF8Base64,
+		CookieJarScope:       CookieJarOff,
+		MaxURLLength:         DefaultMaxURLLength,
+		MaxQueryOverrides:    DefaultMaxQueryOverrides,
+		MetadataEndpoints:    DefaultMetadataEndpoints,
+		FetchTimeout:         DefaultFetchTimeout,
+		MaxFetchTimeout:      DefaultMaxFetchTimeout,
+		MaxRedirects:         DefaultMaxRedirects,
+		UserAgent:            DefaultUserAgent,
+
+		MaxResponseHeaderBytes: DefaultMaxResponseHeaderBytes,
+		CrossHostRedirectLimit: -1,
+		MaxOutboundBodyBytes:   DefaultMaxOutboundBodyBytes,
+		MaxDecompressionRatio:  DefaultMaxDecompressionRatio,
+		MaxDecompressedBytes:   DefaultMaxDecompressedBytes,
+		ResultCacheMaxEntries:  DefaultResultCacheMaxEntries,
+		MaxRunningRefreshJobs:  DefaultMaxRunningRefreshJobs,
+		AllowedOutboundMethods: []string{
+			http.MethodGet,
+			http.MethodHead,
+		},
+		OutboundHeaderDenylist: []string{
+			"Authorization",
+			"Cookie",
+		},
+	}
 }
 
 // RegisterRoutes registers the routes for this handler
 func (h *DynamicHandler) RegisterRoutes(router *mux.Router, logger *zap.Logger) {
-	router.HandleFunc("/{path:.*}", h.handleGetPath).Methods("GET")
-	router.HandleFunc("/{path:.*}", h.handlePostPath).Methods("POST")
-}
-
-// validateURL checks if a URL is safe to fetch
-func validateURL(urlStr string) error {
-	parsedURL, err := url.Parse(urlStr)
-	if err != nil {
-		return fmt.Errorf("invalid URL format: %w", err)
-	}
-
-	// Only allow http and https schemes
-	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return fmt.Errorf("unsupported scheme: %s (only http and https are allowed)", parsedURL.Scheme)
+	// Internal routes must be registered before the catch-all so they are not shadowed
+	router.HandleFunc("/_changes", h.handleGetChanges).Methods("GET")
+	router.HandleFunc("/_search", h.handleSearch).Methods("GET")
+	router.HandleFunc("/_paths", h.handleListPaths).Methods("GET")
+	router.HandleFunc("/_refresh/{path:.*}", h.selectAllowlistProfile(h.handlePostRefresh)).Methods("POST")
+	router.HandleFunc("/_jobs/{id}", h.handleGetJob).Methods("GET")
+	if h.HostBreakers.FailureThreshold > 0 && h.AdminToken != "" {
+		router.HandleFunc("/admin/breakers", h.requireAdminToken(h.handleGetBreakers)).Methods("GET")
 	}
 
-	// Allowlist for test servers (set in tests)
-	if allowlist := os.Getenv("GUARDZ_TEST_ALLOWLIST"); allowlist != "" {
-		allowed := strings.Split(allowlist, ",")
-		host := parsedURL.Hostname()
-		for _, a := range allowed {
-			if host == a {
-				return nil
-			}
-		}
+	// Explicit routes name the operation instead of leaving it to the method
+	if h.ExplicitRoutes {
+		router.HandleFunc("/_store/{path:.*}", h.selectAllowlistProfile(h.handlePostPath)).Methods("POST")
+		router.HandleFunc("/_store/{path:.*}", h.selectAllowlistProfile(h.handlePatchPath)).Methods("PATCH")
+		router.HandleFunc("/_store/{path:.*}", h.handleDeletePath).Methods("DELETE")
+		router.HandleFunc("/_fetch/{path:.*}", h.selectAllowlistProfile(h.handleGetPath)).Methods("GET")
+		router.HandleFunc("/_fetch/{path:.*}", h.handleHeadPath).Methods("HEAD")
 	}
 
-	// Check for private/internal IP addresses (SSRF protection)
-	host := parsedURL.Hostname()
-	if host == "localhost" || host == "127.0.0.1" || host == "::1" {
-		return fmt.Errorf("access to localhost is not allowed")
-	}
+	router.HandleFunc("/{path:.*}", h.selectAllowlistProfile(h.handleGetPath)).Methods("GET")
+	router.HandleFunc("/{path:.*}", h.handleHeadPath).Methods("HEAD")
+	router.HandleFunc("/{path:.*}", h.selectAllowlistProfile(h.handlePostPath)).Methods("POST")
+	router.HandleFunc("/{path:.*}", h.selectAllowlistProfile(h.handlePatchPath)).Methods("PATCH")
+	router.HandleFunc("/{path:.*}", h.handleDeletePath).Methods("DELETE")
+}
 
-	// Parse IP to check for private ranges
-	if ip := net.ParseIP(host); ip != nil {
-		if isPrivateIP(ip) {
-			return fmt.Errorf("access to private IP %s is not allowed", ip)
-		}
+// rejectIfReadOnly writes a 503 and returns true when the handler is in read-only mode
+func (h *DynamicHandler) rejectIfReadOnly(w http.ResponseWriter, req *http.Request) bool {
+	if !h.ReadOnly {
+		return false
 	}
-
-	return nil
+	render.Error(w, req, "service is read-only", http.StatusServiceUnavailable)
+	return true
 }
 
-// isPrivateIP checks if an IP address is in a private range
-func isPrivateIP(ip net.IP) bool {
-	privateBlocks := []string{
-		"127.0.0.0/8",    // localhost
-		"10.0.0.0/8",     // private
-		"172.16.0.0/12",  // private
-		"192.168.0.0/16", // private
-		"169.254.0.0/16", // link-local
-		"::1/128",        // localhost IPv6
-		"fe80::/10",      // link-local IPv6
-		"fc00::/7",       // unique local IPv6
-	}
-
-	for _, block := range privateBlocks {
-		_, cidr, _ := net.ParseCIDR(block)
-		if cidr.Contains(ip) {
-			return true
-		}
+// rejectUnlessJSON writes a 415 and returns true when strict content types are enforced
+// and the request body is not declared as application/json
+func (h *DynamicHandler) rejectUnlessJSON(w http.ResponseWriter, req *http.Request) bool {
+	if !h.StrictContentType {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err == nil && mediaType == "application/json" {
+		return false
 	}
-	return false
+	render.Error(w, req, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+	return true
 }
 
 // handleGetPath handles GET requests to any arbitrary path
 func (h *DynamicHandler) handleGetPath(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	path := strings.TrimPrefix(req.URL.Path, "/")
+	path := mux.Vars(req)["path"]
 	if path == "" {
 		path = "/"
 	}
 
-	urls, err := h.DB.GetURLsByPath(req.Context(), path)
-	if err != nil {
-		http.Error(w, "Failed to fetch records", http.StatusInternalServerError)
+	if err := h.checkQueryParamCount(req.URL.RawQuery); err != nil {
+		render.Error(w, req, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Create a channel to collect results
-	type urlResult struct {
-		index  int
-		result map[string]interface{}
+	query := req.URL.Query()
+	if err := h.validateQueryParams(query, getQueryParams); err != nil {
+		render.Error(w, req, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if wantsEventStream(req) {
+		for _, name := range streamIncompatibleParams {
+			if query.Has(name) {
+				render.Error(w, req, fmt.Sprintf("%s is not supported with text/event-stream", name), http.StatusBadRequest)
+				return
+			}
+		}
 	}
-	resultChan := make(chan urlResult, len(urls))
 
-	// Create a WaitGroup to wait for all goroutines to complete
-	var wg sync.WaitGroup
+	// all_or_nothing=true turns any single fetch failure into a 502 for the whole request
+	allOrNothing := false
+	if value := query.Get("all_or_nothing"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			render.Error(w, req, "all_or_nothing must be a boolean", http.StatusBadRequest)
+			return
+		}
+		allOrNothing = parsed
+	}
 
-	// Limit concurrent requests to prevent resource exhaustion
-	maxConcurrent := 10
-	semaphore := make(chan struct{}, maxConcurrent)
+	// timings=true adds a DNS/connect/TLS/TTFB breakdown to every result
+	withTimings := false
+	if value := query.Get("timings"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			render.Error(w, req, "timings must be a boolean", http.StatusBadRequest)
+			return
+		}
+		withTimings = parsed
+	}
 
-	// Fetch URLs in parallel
-	for i, urlRec := range urls {
-		wg.Add(1)
-		go func(index int, urlRec db_model.URLRecord) {
-			defer wg.Done()
+	// fetch=false lists the stored URLs without fetching them
+	fetch := true
+	if value := query.Get("fetch"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			render.Error(w, req, "fetch must be a boolean", http.StatusBadRequest)
+			return
+		}
+		fetch = parsed
+	}
 
-			// Acquire semaphore to limit concurrency
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+	// resolve_only=true follows redirects and reports only where each URL ends up
+	resolveOnly := false
+	if value := query.Get("resolve_only"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			render.Error(w, req, "resolve_only must be a boolean", http.StatusBadRequest)
+			return
+		}
+		resolveOnly = parsed
+	}
 
-			result := map[string]interface{}{
-				"url": urlRec.URL,
-			}
+	// multi_status=true answers mixed outcomes with 207 and marks every result's status
+	multiStatus := false
+	if value := query.Get("multi_status"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			render.Error(w, req, "multi_status must be a boolean", http.StatusBadRequest)
+			return
+		}
+		multiStatus = parsed
+	}
 
-			// Validate URL before making request
-			if err := validateURL(urlRec.URL); err != nil {
-				result["error"] = err.Error()
-				resultChan <- urlResult{index: index, result: result}
-				return
-			}
+	// method=head fetches only status and headers, for link checking
+	head := false
+	switch method := strings.ToUpper(query.Get("method")); method {
+	case "", http.MethodGet:
+	case http.MethodHead:
+		if !h.outboundMethodAllowed(method) {
+			render.Error(w, req, "outbound method HEAD is not allowed", http.StatusBadRequest)
+			return
+		}
+		head = true
+	default:
+		render.Error(w, req, "method must be get or head", http.StatusBadRequest)
+		return
+	}
 
-			// Create a context with timeout for the HTTP request
-			ctx, cancel := context.WithTimeout(req.Context(), 30*time.Second)
-			defer cancel()
+	// extract=meta adds the title and meta description of HTML results
+	extractMeta := false
+	switch query.Get("extract") {
+	case "":
+	case "meta":
+		extractMeta = true
+	default:
+		render.Error(w, req, "extract must be meta", http.StatusBadRequest)
+		return
+	}
 
-			// Create HTTP request with context
-			httpReq, err := http.NewRequestWithContext(ctx, "GET", urlRec.URL, nil)
-			if err != nil {
-				result["error"] = err.Error()
-				resultChan <- urlResult{index: index, result: result}
-				return
-			}
+	// sort reorders the results; storage order is kept by default
+	sortKey := query.Get("sort")
+	if sortKey != "" && !isValidSortKey(sortKey) {
+		render.Error(w, req, fmt.Sprintf("invalid sort key %q (valid keys: %s)", sortKey, strings.Join(validSortKeys, ", ")), http.StatusBadRequest)
+		return
+	}
 
-			// Set a custom User-Agent
-			httpReq.Header.Set("User-Agent", "Guardz-URL-Fetcher/1.0")
-
-			// Create a custom HTTP client that handles redirects
-			client := &http.Client{
-				Timeout: 30 * time.Second,
-				CheckRedirect: func(req *http.Request, via []*http.Request) error {
-					// Limit redirects to prevent infinite loops
-					if len(via) >= 10 {
-						return fmt.Errorf("too many redirects")
-					}
-					return nil
-				},
-			}
+	urls, err := h.DB.GetURLsByPath(req.Context(), path)
+	if err != nil {
+		render.Error(w, req, "Failed to fetch records", http.StatusInternalServerError)
+		return
+	}
+	// The version lets clients make a later POST conditional with If-Match
+	if !h.setPathETag(w, req, path) {
+		render.Error(w, req, "Failed to fetch records", http.StatusInternalServerError)
+		return
+	}
 
-			// Make the HTTP request
-			resp, err := client.Do(httpReq)
-			if err != nil {
-				result["error"] = err.Error()
-				resultChan <- urlResult{index: index, result: result}
-				return
-			}
+	if !fetch {
+		if urls == nil {
+			urls = []db_model.URLRecord{}
+		}
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"path": path,
+			"urls": urls,
+		})
+		if err != nil {
+			render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+		}
+		return
+	}
 
-			// Read response body with size limit (1MB)
-			limitedReader := io.LimitReader(resp.Body, 1<<20) // 1MB limit
-			body, err := io.ReadAll(limitedReader)
-			cerr := resp.Body.Close()
-			if err != nil {
-				result["error"] = err.Error()
-				resultChan <- urlResult{index: index, result: result}
-				return
-			}
-			if cerr != nil {
-				result["error"] = cerr.Error()
-				resultChan <- urlResult{index: index, result: result}
-				return
-			}
+	if len(urls) > 0 && !h.admitFetches(req.Context()) {
+		w.Header().Set("Retry-After", strconv.Itoa(h.fetchRetryAfter()))
+		render.Error(w, req, "too many concurrent fetches", http.StatusServiceUnavailable)
+		return
+	}
 
-			// Check if response was truncated due to size limit
-			if len(body) == 1<<20 {
-				result["warning"] = "Response truncated due to size limit (1MB)"
-			}
+	opts := fetchOptions{timings: withTimings, resolveOnly: resolveOnly, head: head, extractMeta: extractMeta}
+	// Only full fetches are persisted, a resolution or HEAD would overwrite the stored content
+	if h.PersistFetchResults && !resolveOnly && !head {
+		opts.persistPath = path
+	}
+	if wantsEventStream(req) {
+		h.streamResults(w, req, path, urls, opts)
+		return
+	}
 
-			// Debug print: log the length of the body
-			fmt.Printf("[DEBUG] URL: %s, Content-Type: %s, Body length: %d\n", urlRec.URL, resp.Header.Get("Content-Type"), len(body))
+	outcomes := h.fetchAll(req.Context(), urls, opts)
+	if sortKey != "" {
+		sortOutcomes(outcomes, sortKey)
+	}
+	results := make([]map[string]interface{}, len(outcomes))
+	for i, outcome := range outcomes {
+		results[i] = outcome.result
+	}
 
-			// Track redirect information
-			if len(resp.Request.URL.String()) != len(urlRec.URL) || resp.Request.URL.String() != urlRec.URL {
-				result["original_url"] = urlRec.URL
-				result["final_url"] = resp.Request.URL.String()
-				result["redirected"] = true
-			} else {
-				result["redirected"] = false
+	if allOrNothing {
+		var failures []map[string]interface{}
+		for _, result := range results {
+			if fetchErr, ok := result["error"]; ok {
+				failures = append(failures, map[string]interface{}{
+					"url":   result["url"],
+					"error": fetchErr,
+				})
 			}
-
-			contentType := resp.Header.Get("Content-Type")
-			result["content_type"] = contentType
-			result["status_code"] = resp.StatusCode
-
-			// If not text, encode as base64
-			if strings.HasPrefix(contentType, "text/") || strings.Contains(contentType, "json") || strings.Contains(contentType, "xml") {
-				// Truncate to 1MB if needed
-				text := body
-				if len(text) > 1<<20 {
-					text = text[:1<<20]
-				}
-				if !utf8.Valid(text) {
-					// Not valid UTF-8, encode as base64
-					result["content"] = base64.StdEncoding.EncodeToString(text)
-					result["content_encoding"] = "base64"
-				} else {
-					result["content"] = string(text)
-				}
-			} else {
-				result["content"] = base64.StdEncoding.EncodeToString(body)
+		}
+		if len(failures) > 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			err = json.NewEncoder(w).Encode(map[string]interface{}{
+				"path":     path,
+				"error":    fmt.Sprintf("%d of %d URLs failed to fetch", len(failures), len(results)),
+				"failures": failures,
+			})
+			if err != nil {
+				render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
 			}
+			return
+		}
+	}
+
+	// Mixed outcomes still answer 200 unless multi_status asks for 207, the counts tell clients
+	// whether anything failed
+	succeeded, failed := countFetchOutcomes(results)
+	response := map[string]interface{}{
+		"path":      path,
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    failed,
+	}
+	code := http.StatusOK
+	if failed > 0 && failed == len(results) {
+		code = http.StatusBadGateway
+	}
+	if multiStatus {
+		var outcome string
+		outcome, code = markMultiStatus(results)
+		response["outcome"] = outcome
+	}
+	if code != http.StatusOK {
+		w.WriteHeader(code)
+	}
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
 
-			resultChan <- urlResult{index: index, result: result}
-		}(i, urlRec)
+// countFetchOutcomes counts the results fetched without an error and those with one.
+// Results skipped without a fetch count as neither.
+func countFetchOutcomes(results []map[string]interface{}) (succeeded, failed int) {
+	for _, result := range results {
+		switch resultStatus(result) {
+		case resultFailed:
+			failed++
+		case resultSucceeded:
+			succeeded++
+		}
 	}
+	return succeeded, failed
+}
 
-	// Close the channel when all goroutines complete
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+// postedURL is one entry of a POST body: either a plain URL string or
+// an object carrying per-URL settings, e.g. {"url": "...", "timeout_ms": 5000, "referer": "..."}
+type postedURL struct {
+	URL       string            `json:"url"`
+	TimeoutMs int               `json:"timeout_ms"`
+	Referer   string            `json:"referer"`
+	Origin    string            `json:"origin"`
+	Headers   map[string]string `json:"headers"`
+}
 
-	// Collect results in order
-	results := make([]map[string]interface{}, len(urls))
-	for result := range resultChan {
-		results[result.index] = result.result
+// UnmarshalJSON accepts both the plain string and the object form
+func (p *postedURL) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &p.URL); err == nil {
+		return nil
 	}
+	type plain postedURL
+	return json.Unmarshal(data, (*plain)(p))
+}
 
-	response := map[string]interface{}{
-		"path":    path,
-		"results": results,
+// handleHeadPath reports how many URLs are stored for a path in the X-URL-Count header,
+// a cheap existence check that fetches nothing
+func (h *DynamicHandler) handleHeadPath(w http.ResponseWriter, req *http.Request) {
+	path := mux.Vars(req)["path"]
+	if path == "" {
+		path = "/"
 	}
-	err = json.NewEncoder(w).Encode(response)
+
+	urls, err := h.DB.GetURLsByPath(req.Context(), path)
 	if err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(urls) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !h.setPathETag(w, req, path) {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+
+	w.Header().Set("X-URL-Count", strconv.Itoa(len(urls)))
+	w.WriteHeader(http.StatusOK)
 }
 
 // handlePostPath handles POST requests to any arbitrary path
 func (h *DynamicHandler) handlePostPath(w http.ResponseWriter, req *http.Request) {
+	if h.rejectIfReadOnly(w, req) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	path := strings.TrimPrefix(req.URL.Path, "/")
+	if h.rejectUnlessJSON(w, req) {
+		return
+	}
+	path := mux.Vars(req)["path"]
 	if path == "" {
 		path = "/"
 	}
 	var body struct {
-		URLs []string `json:"urls"`
+		URLs *[]postedURL `json:"urls"`
 	}
 	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		render.Error(w, req, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	if len(body.URLs) == 0 {
-		http.Error(w, "No URLs provided", http.StatusBadRequest)
+	if body.URLs == nil {
+		render.Error(w, req, "urls field required", http.StatusBadRequest)
+		return
+	}
+	if len(*body.URLs) == 0 {
+		if !h.AllowClearOnEmptyPost {
+			render.Error(w, req, "at least one URL required", http.StatusBadRequest)
+			return
+		}
+		h.clearPath(w, req, path)
 		return
 	}
 
 	// Validate all URLs before storing
-	var validURLs []string
+	var validURLs []db_model.URLRecord
 	var invalidURLs []string
-	for _, urlStr := range body.URLs {
-		if err := validateURL(urlStr); err != nil {
-			invalidURLs = append(invalidURLs, fmt.Sprintf("%s: %s", urlStr, err.Error()))
+	seen := make(map[string]bool)
+	for _, posted := range *body.URLs {
+		headers, headersErr := h.normalizeURLHeaders(posted.Headers)
+		if err := h.validateURLContext(req.Context(), posted.URL); err != nil {
+			invalidURLs = append(invalidURLs, fmt.Sprintf("%s: %s", posted.URL, err.Error()))
+		} else if posted.TimeoutMs < 0 {
+			invalidURLs = append(invalidURLs, fmt.Sprintf("%s: timeout_ms must not be negative", posted.URL))
+		} else if err := validateRefererHeaders(posted.Referer, posted.Origin); err != nil {
+			invalidURLs = append(invalidURLs, fmt.Sprintf("%s: %s", posted.URL, err.Error()))
+		} else if headersErr != nil {
+			invalidURLs = append(invalidURLs, fmt.Sprintf("%s: %s", posted.URL, headersErr.Error()))
 		} else {
-			validURLs = append(validURLs, urlStr)
+			storedURL := posted.URL
+			if h.CanonicalizeURLs {
+				// Parsing cannot fail on a URL that passed validation
+				storedURL, _ = canonicalizeURL(posted.URL)
+				// Equivalent URLs collapse into the first one posted
+				if seen[storedURL] {
+					continue
+				}
+				seen[storedURL] = true
+			}
+			validURLs = append(validURLs, db_model.URLRecord{
+				URL:       storedURL,
+				TimeoutMs: posted.TimeoutMs,
+				Referer:   posted.Referer,
+				Origin:    posted.Origin,
+				Headers:   headers,
+			})
 		}
 	}
 
 	// If all URLs are invalid, return error
 	if len(validURLs) == 0 {
-		http.Error(w, fmt.Sprintf("All URLs are invalid: %v", invalidURLs), http.StatusBadRequest)
+		render.ErrorWithDetails(w, req, fmt.Sprintf("All URLs are invalid: %v", invalidURLs), http.StatusBadRequest,
+			map[string]interface{}{"invalid_urls": invalidURLs})
 		return
 	}
 
 	// Store only valid URLs
-	if err := h.DB.StoreURLsForPath(req.Context(), path, validURLs); err != nil {
-		http.Error(w, "Failed to store URLs", http.StatusInternalServerError)
+	if !h.replaceURLs(w, req, path, validURLs) {
 		return
 	}
+	h.audit(req, auditOpStore, path, len(validURLs))
 
 	response := map[string]interface{}{
-		"message": "URLs stored successfully",
-		"path":    path,
-		"count":   len(validURLs),
+		"message":      "URLs stored successfully",
+		"path":         path,
+		"count":        len(validURLs),
+		"request_hash": requestHash(path, validURLs),
 	}
 
 	// Include information about invalid URLs if any
@@ -320,6 +755,191 @@ func (h *DynamicHandler) handlePostPath(w http.ResponseWriter, req *http.Request
 	w.WriteHeader(http.StatusCreated)
 	err := json.NewEncoder(w).Encode(response)
 	if err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// clearPath removes every URL stored for path, answering a POST with an empty urls array
+func (h *DynamicHandler) clearPath(w http.ResponseWriter, req *http.Request, path string) {
+	if !h.replaceURLs(w, req, path, nil) {
+		return
+	}
+	h.audit(req, auditOpClear, path, 0)
+	response := map[string]interface{}{
+		"message":      "URLs cleared",
+		"path":         path,
+		"count":        0,
+		"request_hash": requestHash(path, nil),
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// handlePatchPath handles PATCH requests adding a single URL to any arbitrary path
+func (h *DynamicHandler) handlePatchPath(w http.ResponseWriter, req *http.Request) {
+	if h.rejectIfReadOnly(w, req) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if h.rejectUnlessJSON(w, req) {
+		return
+	}
+	path := mux.Vars(req)["path"]
+	if path == "" {
+		path = "/"
+	}
+	var body struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		render.Error(w, req, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.URL == "" {
+		render.Error(w, req, "No URL provided", http.StatusBadRequest)
+		return
+	}
+	if err := h.validateURLContext(req.Context(), body.URL); err != nil {
+		render.Error(w, req, fmt.Sprintf("URL is invalid: %s: %s", body.URL, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if h.CanonicalizeURLs {
+		body.URL, _ = canonicalizeURL(body.URL)
+	}
+
+	release := h.acquireStoreSlot(w, req)
+	if release == nil {
+		return
+	}
+	added, err := h.DB.AddURLForPath(req.Context(), path, body.URL)
+	release()
+	if err != nil {
+		render.Error(w, req, "Failed to store URL", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"path":  path,
+		"url":   body.URL,
+		"added": added,
+	}
+	status := http.StatusOK
+	if added {
+		h.audit(req, auditOpAdd, path, 1)
+		response["message"] = "URL added successfully"
+		status = http.StatusCreated
+	} else {
+		response["message"] = "URL already stored"
+	}
+
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// handleDeletePath handles DELETE requests removing every URL stored for any arbitrary path
+func (h *DynamicHandler) handleDeletePath(w http.ResponseWriter, req *http.Request) {
+	if h.rejectIfReadOnly(w, req) {
+		return
+	}
+	path := mux.Vars(req)["path"]
+	if path == "" {
+		path = "/"
+	}
+
+	release := h.acquireStoreSlot(w, req)
+	if release == nil {
+		return
+	}
+	err := h.DB.DeleteURLsForPath(req.Context(), path)
+	release()
+	if errors.Is(err, db_model.ErrPathNotFound) {
+		render.Error(w, req, "No URLs stored for path", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		render.Error(w, req, "Failed to delete URLs", http.StatusInternalServerError)
+		return
+	}
+	h.audit(req, auditOpDelete, path, 0)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSearch finds every path storing a URL that contains the q query parameter,
+// e.g. to find all references to a compromised domain
+func (h *DynamicHandler) handleSearch(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	query := strings.TrimSpace(req.URL.Query().Get("q"))
+	if len(query) < minSearchQueryLength {
+		render.Error(w, req, fmt.Sprintf("q must be at least %d characters", minSearchQueryLength), http.StatusBadRequest)
+		return
+	}
+
+	// Ask for one more than the bound to learn whether results were cut off
+	records, err := h.DB.SearchURLs(req.Context(), query, maxSearchResults+1)
+	if err != nil {
+		render.Error(w, req, "Failed to search records", http.StatusInternalServerError)
+		return
+	}
+	truncated := len(records) > maxSearchResults
+	if truncated {
+		records = records[:maxSearchResults]
+	}
+
+	matches := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		matches = append(matches, map[string]interface{}{
+			"path": record.Path,
+			"url":  record.URL,
+		})
+	}
+
+	response := map[string]interface{}{
+		"query":     query,
+		"matches":   matches,
+		"truncated": truncated,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// handleGetChanges handles GET /_changes?since=<RFC3339> for incremental sync clients
+func (h *DynamicHandler) handleGetChanges(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	sinceParam := req.URL.Query().Get("since")
+	if sinceParam == "" {
+		render.Error(w, req, "since query parameter is required", http.StatusBadRequest)
+		return
+	}
+	since, err := time.Parse(time.RFC3339Nano, sinceParam)
+	if err != nil {
+		render.Error(w, req, "since must be an RFC3339 timestamp", http.StatusBadRequest)
+		return
+	}
+
+	records, err := h.DB.GetURLsUpdatedSince(req.Context(), since)
+	if err != nil {
+		render.Error(w, req, "Failed to fetch records", http.StatusInternalServerError)
+		return
+	}
+
+	changes := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		changes = append(changes, map[string]interface{}{
+			"path":       record.Path,
+			"url":        record.URL,
+			"updated_at": record.UpdatedAt,
+		})
+	}
+
+	response := map[string]interface{}{
+		"since":   since,
+		"changes": changes,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -35,14 +39,50 @@ func allowlistTestServer(t *testing.T, serverURL string) func() {
 	}
 }
 
+// storeURLs POSTs the given URLs to path and asserts they were stored
+func storeURLs(t *testing.T, r *mux.Router, path string, urls []string) {
+	t.Helper()
+	bodyBytes, _ := json.Marshal(map[string]interface{}{"urls": urls})
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, "expected status 201")
+}
+
+// fetchResults GETs path and returns the decoded per-URL results
+func fetchResults(t *testing.T, r *mux.Router, path string) []map[string]interface{} {
+	t.Helper()
+	return fetchResultsWithStatus(t, r, path, http.StatusOK)
+}
+
+// fetchResultsWithStatus GETs path, asserts the response status and returns the decoded per-URL results
+func fetchResultsWithStatus(t *testing.T, r *mux.Router, path string, status int) []map[string]interface{} {
+	t.Helper()
+	getReq := httptest.NewRequest(http.MethodGet, path, nil)
+	getW := httptest.NewRecorder()
+	r.ServeHTTP(getW, getReq)
+	require.Equal(t, status, getW.Code)
+
+	var resp struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(getW.Body.Bytes(), &resp), "failed to decode response")
+	return resp.Results
+}
+
 func TestDynamicHandler_POST_and_GET(t *testing.T) {
+	server, _ := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
 	h := setupTestHandler()
 	r := mux.NewRouter()
 	h.RegisterRoutes(r, zap.NewNop())
 
 	// Test POST
 	postBody := map[string]interface{}{
-		"urls": []string{"https://jsonplaceholder.typicode.com/todos/1", "https://example.com"},
+		"urls": []string{server.URL + "/todos/1", server.URL},
 	}
 	bodyBytes, _ := json.Marshal(postBody)
 	req := httptest.NewRequest(http.MethodPost, "/testpath", bytes.NewReader(bodyBytes))
@@ -207,7 +247,7 @@ func TestDynamicHandler_RedirectLoopProtection(t *testing.T) {
 	getReq := httptest.NewRequest(http.MethodGet, "/loop-test", nil)
 	getW := httptest.NewRecorder()
 	r.ServeHTTP(getW, getReq)
-	require.Equal(t, http.StatusOK, getW.Code, "expected status 200")
+	require.Equal(t, http.StatusBadGateway, getW.Code, "expected status 502 when every fetch fails")
 
 	var resp map[string]interface{}
 	err := json.Unmarshal(getW.Body.Bytes(), &resp)
@@ -221,6 +261,90 @@ func TestDynamicHandler_RedirectLoopProtection(t *testing.T) {
 	require.Contains(t, result["error"], "too many redirects", "should detect redirect loop")
 }
 
+func TestDynamicHandler_RedirectChain(t *testing.T) {
+	var mockServer *httptest.Server
+	mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/hop?step=1", http.StatusFound)
+		case "/hop":
+			// Credentials in a hop must not leak into the result
+			target := strings.Replace(mockServer.URL, "http://", "http://user:secret@", 1) + "/final"
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		default:
+			_, _ = w.Write([]byte("final"))
+		}
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/chain-test", []string{mockServer.URL + "/start", mockServer.URL + "/final"})
+
+	results := fetchResults(t, r, "/chain-test")
+	require.Len(t, results, 2)
+	require.Equal(t, "final", results[0]["content"])
+	require.Equal(t, float64(2), results[0]["redirect_count"])
+	require.Equal(t, []interface{}{
+		mockServer.URL + "/start",
+		mockServer.URL + "/hop?step=1",
+		mockServer.URL + "/final",
+	}, results[0]["redirect_chain"], "the chain lists every URL traversed, without credentials")
+	require.NotContains(t, fmt.Sprint(results[0]), "secret")
+
+	require.Equal(t, float64(0), results[1]["redirect_count"])
+	require.NotContains(t, results[1], "redirect_chain", "a fetch that was not redirected has no chain")
+}
+
+func TestRedirectChain_Bounded(t *testing.T) {
+	var via []*http.Request
+	for i := 0; i < maxRedirectChain+5; i++ {
+		via = append(via, httptest.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com/%d", i), nil))
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/last", nil)
+
+	chain := redirectChain(req, via)
+	require.Len(t, chain, maxRedirectChain)
+	require.Equal(t, "http://example.com/0", chain[0])
+	require.Len(t, via, maxRedirectChain+5, "via is not modified")
+}
+
+func TestDynamicHandler_ConfiguredRedirectCapAndTimeout(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hop1":
+			http.Redirect(w, r, "/hop2", http.StatusFound)
+		case "/hop2":
+			http.Redirect(w, r, "/done", http.StatusFound)
+		case "/slow":
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+		_, _ = w.Write([]byte("done"))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.MaxRedirects = 2
+	h.FetchTimeout = 50 * time.Millisecond
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/configured", []string{mockServer.URL + "/hop2", mockServer.URL + "/hop1", mockServer.URL + "/slow"})
+
+	results := fetchResults(t, r, "/configured")
+	require.Len(t, results, 3)
+	require.Equal(t, "done", results[0]["content"], "one hop is within the cap")
+	require.Contains(t, results[1]["error"], "too many redirects")
+	require.Contains(t, results[2]["error"], "deadline exceeded")
+}
+
 func TestDynamicHandler_MultipleContentTypes(t *testing.T) {
 	// Create a mock server that returns different content types
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -678,3 +802,850 @@ func TestDynamicHandler_ConcurrentRequestLimit(t *testing.T) {
 		require.Equal(t, "response", resultMap["content"], "result %d should have expected content", i)
 	}
 }
+
+func TestDynamicHandler_WorkerPoolBoundsGoroutines(t *testing.T) {
+	var peak int64
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := int64(runtime.NumGoroutine()); n > atomic.LoadInt64(&peak) {
+			atomic.StoreInt64(&peak, n)
+		}
+		time.Sleep(time.Millisecond)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.MaxConcurrentFetches = 4
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	const urlCount = 500
+	urls := make([]string, urlCount)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/item/%d", mockServer.URL, i)
+	}
+	storeURLs(t, r, "/many-urls", urls)
+
+	baseline := runtime.NumGoroutine()
+	results := fetchResults(t, r, "/many-urls")
+	require.Len(t, results, urlCount, "expected a result for every URL")
+
+	// Each worker accounts for a handful of goroutines (worker, client and server
+	// connection loops); one goroutine per URL would blow far past this bound
+	bound := int64(baseline + h.MaxConcurrentFetches*6 + 20)
+	require.LessOrEqual(t, atomic.LoadInt64(&peak), bound, "goroutine count should stay bounded by the worker pool")
+}
+
+func TestDynamicHandler_PATCH_AddsSingleURL(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	storeURLs(t, r, "/patch-test", []string{"https://example.com"})
+
+	patch := func(body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPatch, "/patch-test", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := patch(`{"url": "https://example.org"}`)
+	require.Equal(t, http.StatusCreated, code, "first add should return 201")
+	require.Equal(t, true, resp["added"], "first add should report new")
+
+	code, resp = patch(`{"url": "https://example.org"}`)
+	require.Equal(t, http.StatusOK, code, "second add should return 200")
+	require.Equal(t, false, resp["added"], "second add should report not-new")
+
+	code, _ = patch(`{"url": "http://127.0.0.1/admin"}`)
+	require.Equal(t, http.StatusBadRequest, code, "invalid URL should be rejected")
+
+	records, err := h.DB.GetURLsByPath(context.Background(), "patch-test")
+	require.NoError(t, err)
+	require.Len(t, records, 2, "PATCH should add to the existing set")
+}
+
+func TestDynamicHandler_PersistFetchResults(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = w.Write([]byte("body of " + r.URL.Path))
+	}))
+	defer mockServer.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.PersistFetchResults = true
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/persist-test", []string{mockServer.URL + "/ok", mockServer.URL + "/missing", closed.URL + "/down"})
+
+	before := time.Now().UTC()
+	results := fetchResults(t, r, "/persist-test")
+	require.Len(t, results, 3)
+
+	records, err := h.DB.GetURLsByPath(context.Background(), "persist-test")
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, http.StatusOK, records[0].StatusCode)
+	require.Equal(t, "body of /ok", records[0].Content)
+	require.Empty(t, records[0].FetchError)
+	require.Equal(t, http.StatusNotFound, records[1].StatusCode)
+	require.Equal(t, "body of /missing", records[1].Content)
+	require.Zero(t, records[2].StatusCode)
+	require.Equal(t, results[2]["error"], records[2].FetchError)
+	for _, record := range records {
+		require.False(t, record.FetchedAt.Before(before), "every fetch is timestamped")
+	}
+
+	// The stored results are served without fetching
+	listReq := httptest.NewRequest(http.MethodGet, "/persist-test?fetch=false", nil)
+	listW := httptest.NewRecorder()
+	r.ServeHTTP(listW, listReq)
+	require.Equal(t, http.StatusOK, listW.Code)
+	require.Contains(t, listW.Body.String(), `"content":"body of /ok"`)
+	require.Contains(t, listW.Body.String(), `"status_code":404`)
+}
+
+func TestDynamicHandler_PersistFetchResultsFromCache(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	start := time.Now()
+	clock := start
+	h := setupTestHandler()
+	h.now = func() time.Time { return clock }
+	h.PersistFetchResults = true
+	h.ResultCacheTTL = time.Minute
+	h.CompressCachedContent = true
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/persist-first", []string{server.URL})
+	storeURLs(t, r, "/persist-second", []string{server.URL})
+
+	fetchResults(t, r, "/persist-first")
+	clock = start.Add(30 * time.Second)
+	results := fetchResults(t, r, "/persist-second")
+	require.Equal(t, true, results[0]["cached"])
+	require.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	// The hit is stored on the path that was served it, timestamped with the original fetch
+	records, err := h.DB.GetURLsByPath(context.Background(), "persist-second")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "response 1", records[0].Content, "persisted content is never compressed")
+	require.True(t, records[0].FetchedAt.Equal(start.UTC()))
+}
+
+func TestDynamicHandler_PersistFetchResultsReadOnly(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.PersistFetchResults = true
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/persist-read-only", []string{server.URL + "/ok"})
+
+	h.ReadOnly = true
+	results := fetchResults(t, r, "/persist-read-only")
+	require.Len(t, results, 1)
+	require.Equal(t, int32(1), atomic.LoadInt32(calls), "fetching keeps working while read-only")
+	require.NotContains(t, results[0], "persist_error")
+
+	records, err := h.DB.GetURLsByPath(context.Background(), "persist-read-only")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Zero(t, records[0].StatusCode, "a read-only instance stores no fetch results")
+	require.True(t, records[0].FetchedAt.IsZero())
+}
+
+func TestDynamicHandler_DELETE_RemovesURLs(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	storeURLs(t, r, "/delete-test", []string{"https://example.com", "https://example.org"})
+	storeURLs(t, r, "/delete-other", []string{"https://example.com"})
+
+	remove := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/delete-test", nil))
+		return w
+	}
+
+	w := remove()
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Empty(t, w.Body.String())
+	records, err := h.DB.GetURLsByPath(context.Background(), "delete-test")
+	require.NoError(t, err)
+	require.Empty(t, records)
+	records, err = h.DB.GetURLsByPath(context.Background(), "delete-other")
+	require.NoError(t, err)
+	require.Len(t, records, 1, "other paths should be untouched")
+
+	w = remove()
+	require.Equal(t, http.StatusNotFound, w.Code, "a path without URLs should return 404")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/never-stored", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDynamicHandler_ClientDisconnectCancelsFetches(t *testing.T) {
+	upstreamStarted := make(chan struct{}, 1)
+	upstreamCancelled := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamStarted <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			upstreamCancelled <- struct{}{}
+		case <-time.After(10 * time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer upstream.Close()
+
+	cleanup := allowlistTestServer(t, upstream.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/disconnect-test", []string{upstream.URL + "/slow"})
+
+	// Serve Guardz over a real connection so closing it cancels the request context
+	guardz := httptest.NewServer(r)
+	defer guardz.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientReq, err := http.NewRequestWithContext(ctx, http.MethodGet, guardz.URL+"/disconnect-test", nil)
+	require.NoError(t, err)
+
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		resp, err := http.DefaultClient.Do(clientReq)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+
+	select {
+	case <-upstreamStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream never received the outbound request")
+	}
+
+	// Client goes away mid-request
+	cancel()
+	<-clientDone
+
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("outbound fetch was not cancelled after the client disconnected")
+	}
+}
+
+func TestDynamicHandler_StrictContentType(t *testing.T) {
+	h := setupTestHandler()
+	h.StrictContentType = true
+	h.Resolver = stubResolver{addrs: []string{"93.184.216.34"}}
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	for _, tc := range []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"POST json", http.MethodPost, "application/json", `{"urls": ["https://example.com"]}`, http.StatusCreated},
+		{"POST json with charset", http.MethodPost, "application/json; charset=utf-8", `{"urls": ["https://example.com"]}`, http.StatusCreated},
+		{"POST text", http.MethodPost, "text/plain", `{"urls": ["https://example.com"]}`, http.StatusUnsupportedMediaType},
+		{"POST without content type", http.MethodPost, "", `{"urls": ["https://example.com"]}`, http.StatusUnsupportedMediaType},
+		{"PATCH form", http.MethodPatch, "application/x-www-form-urlencoded", `{"url": "https://example.com/b"}`, http.StatusUnsupportedMediaType},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/strict-test", strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			require.Equal(t, tc.want, w.Code, w.Body.String())
+			if tc.want == http.StatusUnsupportedMediaType {
+				require.Contains(t, w.Body.String(), "Content-Type must be application/json")
+			}
+		})
+	}
+}
+
+func TestDynamicHandler_ReadOnlyMode(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("still served"))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/read-only-test", []string{mockServer.URL})
+
+	h.ReadOnly = true
+
+	for _, tc := range []struct {
+		method string
+		body   string
+	}{
+		{http.MethodPost, `{"urls": ["https://example.com"]}`},
+		{http.MethodPatch, `{"url": "https://example.com"}`},
+		{http.MethodDelete, ""},
+	} {
+		t.Run(tc.method, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/read-only-test", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			require.Equal(t, http.StatusServiceUnavailable, w.Code, "mutations should be rejected")
+			require.Contains(t, w.Body.String(), "service is read-only")
+		})
+	}
+
+	// GET keeps working and the stored set is untouched
+	results := fetchResults(t, r, "/read-only-test")
+	require.Len(t, results, 1)
+	require.Equal(t, "still served", results[0]["content"])
+}
+
+func TestDynamicHandler_GetChanges(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	storeURLs(t, r, "/before", []string{"https://example.com"})
+	time.Sleep(2 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	storeURLs(t, r, "/after", []string{"https://example.org"})
+
+	req := httptest.NewRequest(http.MethodGet, "/_changes?since="+since.Format(time.RFC3339Nano), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Changes []map[string]interface{} `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Changes, 1, "only the recently stored record should be returned")
+	require.Equal(t, "after", resp.Changes[0]["path"])
+	require.Equal(t, "https://example.org", resp.Changes[0]["url"])
+
+	// since is required and must parse
+	for _, query := range []string{"", "?since=yesterday"} {
+		req := httptest.NewRequest(http.MethodGet, "/_changes"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestDynamicHandler_FetchSummary(t *testing.T) {
+	server, _ := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	// The unreachable URL passes storage validation but cannot be fetched
+	storeURLs(t, r, "/summary-mixed", []string{server.URL + "/good", "http://unreachable.invalid/"})
+	storeURLs(t, r, "/summary-good", []string{server.URL + "/a", server.URL + "/b"})
+	storeURLs(t, r, "/summary-failed", []string{"http://unreachable.invalid/a", "http://unreachable.invalid/b"})
+
+	testCases := []struct {
+		path      string
+		status    int
+		succeeded float64
+		failed    float64
+	}{
+		{path: "/summary-mixed", status: http.StatusOK, succeeded: 1, failed: 1},
+		{path: "/summary-good", status: http.StatusOK, succeeded: 2, failed: 0},
+		{path: "/summary-failed", status: http.StatusBadGateway, succeeded: 0, failed: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			require.Equal(t, tc.status, w.Code)
+
+			var resp map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Equal(t, tc.succeeded, resp["succeeded"])
+			require.Equal(t, tc.failed, resp["failed"])
+			require.Len(t, resp["results"], 2, "results are returned whatever the status")
+		})
+	}
+}
+
+func TestCountFetchOutcomes(t *testing.T) {
+	succeeded, failed := countFetchOutcomes([]map[string]interface{}{
+		{"url": "https://a.example/", "content": "ok"},
+		{"url": "https://b.example/", "status_code": 404},
+		{"url": "https://c.example/", "error": "connection refused"},
+		{"url": "https://d.example/", "skipped": skippedHostByteBudget},
+	})
+	require.Equal(t, 2, succeeded, "an upstream error status is still a successful fetch")
+	require.Equal(t, 1, failed, "skipped URLs count as neither")
+}
+
+func TestDynamicHandler_AllOrNothing(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	// The second URL passes storage validation but cannot be fetched
+	storeURLs(t, r, "/mixed", []string{mockServer.URL + "/good", "http://unreachable.invalid/"})
+	storeURLs(t, r, "/all-good", []string{mockServer.URL + "/a", mockServer.URL + "/b"})
+
+	t.Run("default mode reports failures per URL", func(t *testing.T) {
+		results := fetchResults(t, r, "/mixed")
+		require.Len(t, results, 2)
+		require.Equal(t, "ok", results[0]["content"])
+		require.Contains(t, results[1], "error")
+	})
+
+	t.Run("all_or_nothing fails the whole request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/mixed?all_or_nothing=true", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadGateway, w.Code)
+
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotContains(t, resp, "results", "no partial results should be returned")
+		failures := resp["failures"].([]interface{})
+		require.Len(t, failures, 1)
+		require.Equal(t, "http://unreachable.invalid/", failures[0].(map[string]interface{})["url"])
+	})
+
+	t.Run("all_or_nothing succeeds when every fetch succeeds", func(t *testing.T) {
+		results := fetchResults(t, r, "/all-good?all_or_nothing=true")
+		require.Len(t, results, 2)
+	})
+
+	t.Run("invalid flag value", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/mixed?all_or_nothing=maybe", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestDynamicHandler_PerURLTimeoutHint(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("slow"))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	body := fmt.Sprintf(`{"urls": [
+		{"url": "%[1]s/short", "timeout_ms": 50},
+		{"url": "%[1]s/long", "timeout_ms": 2000},
+		"%[1]s/default"
+	]}`, mockServer.URL)
+	req := httptest.NewRequest(http.MethodPost, "/timeouts", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	t.Run("hints are honored", func(t *testing.T) {
+		h.MaxFetchTimeout = 5 * time.Second
+		results := fetchResults(t, r, "/timeouts")
+		require.Len(t, results, 3)
+		require.Contains(t, results[0]["error"], "deadline exceeded", "a short hint should fail the slow upstream")
+		require.Equal(t, "slow", results[1]["content"], "a long hint should give the upstream time")
+		require.Equal(t, "slow", results[2]["content"], "URLs without a hint use the server max")
+	})
+
+	t.Run("hints are clamped to the server max", func(t *testing.T) {
+		h.MaxFetchTimeout = 50 * time.Millisecond
+		results := fetchResultsWithStatus(t, r, "/timeouts", http.StatusBadGateway)
+		require.Len(t, results, 3)
+		for _, result := range results {
+			require.Contains(t, result["error"], "deadline exceeded")
+		}
+	})
+
+	t.Run("negative hint is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/negative", strings.NewReader(
+			fmt.Sprintf(`{"urls": [{"url": "%s", "timeout_ms": -1}]}`, mockServer.URL)))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), "timeout_ms must not be negative")
+	})
+}
+
+func TestDynamicHandler_POST_MissingOrEmptyURLs(t *testing.T) {
+	post := func(r *mux.Router, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w
+	}
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	t.Run("missing urls key", func(t *testing.T) {
+		w := post(r, "/empty-test", `{}`)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), "urls field required")
+	})
+
+	t.Run("null urls", func(t *testing.T) {
+		w := post(r, "/empty-test", `{"urls": null}`)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), "urls field required")
+	})
+
+	t.Run("empty urls array", func(t *testing.T) {
+		w := post(r, "/empty-test", `{"urls": []}`)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), "at least one URL required")
+	})
+
+	t.Run("empty urls array clears the path when allowed", func(t *testing.T) {
+		h.AllowClearOnEmptyPost = true
+		defer func() { h.AllowClearOnEmptyPost = false }()
+
+		storeURLs(t, r, "/clear-test", []string{"https://example.com/a", "https://example.com/b"})
+		records, err := h.DB.GetURLsByPath(context.Background(), "clear-test")
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+
+		w := post(r, "/clear-test", `{"urls": []}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "URLs cleared")
+
+		records, err = h.DB.GetURLsByPath(context.Background(), "clear-test")
+		require.NoError(t, err)
+		require.Empty(t, records)
+	})
+}
+
+func TestDynamicHandler_HEAD_ReportsURLCount(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	storeURLs(t, r, "/head-test", []string{"https://example.com/a", "https://example.com/b"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/head-test", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "2", w.Header().Get("X-URL-Count"))
+	require.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/missing", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Empty(t, w.Header().Get("X-URL-Count"))
+}
+
+func TestDynamicHandler_GET_FetchFalseListsStoredURLs(t *testing.T) {
+	var upstreamCalls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	stored := []string{mockServer.URL + "/b?x=1", mockServer.URL + "/a"}
+	storeURLs(t, r, "/list-test", stored)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/list-test?fetch=false", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEmpty(t, w.Header().Get("ETag"))
+
+	var response struct {
+		Path string `json:"path"`
+		URLs []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, "list-test", response.Path)
+	require.Len(t, response.URLs, 2)
+	require.Equal(t, stored[0], response.URLs[0].URL, "URLs are returned verbatim in storage order")
+	require.Equal(t, stored[1], response.URLs[1].URL)
+	require.Zero(t, atomic.LoadInt32(&upstreamCalls), "listing must not fetch upstream")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing?fetch=false", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"path": "missing", "urls": []}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/list-test?fetch=maybe", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDynamicHandler_GET_ResolveOnlySkipsBody(t *testing.T) {
+	aborted := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/short":
+			http.Redirect(w, r, "/hop", http.StatusMovedPermanently)
+		case "/hop":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/final":
+			// Send the headers, then hold the body back until the client hangs up
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("first chunk"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				close(aborted)
+			case <-time.After(5 * time.Second):
+				_, _ = w.Write([]byte("rest of the body"))
+			}
+		}
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/resolve-test", []string{mockServer.URL + "/short"})
+
+	results := fetchResults(t, r, "/resolve-test?resolve_only=true")
+	require.Equal(t, []map[string]interface{}{{
+		"url":            mockServer.URL + "/short",
+		"final_url":      mockServer.URL + "/final",
+		"redirect_count": float64(2),
+		"redirect_chain": []interface{}{mockServer.URL + "/short", mockServer.URL + "/hop", mockServer.URL + "/final"},
+		"status_code":    float64(http.StatusOK),
+	}}, results)
+
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("the body download should be aborted")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/resolve-test?resolve_only=maybe", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDynamicHandler_HeadMethod(t *testing.T) {
+	var mu sync.Mutex
+	var methods []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<html>a large page</html>"))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.ResultCacheTTL = time.Minute
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/head-test", []string{mockServer.URL + "/moved"})
+
+	results := fetchResults(t, r, "/head-test?method=head")
+	require.Equal(t, []map[string]interface{}{{
+		"url":            mockServer.URL + "/moved",
+		"original_url":   mockServer.URL + "/moved",
+		"final_url":      mockServer.URL + "/page",
+		"redirected":     true,
+		"redirect_count": float64(1),
+		"redirect_chain": []interface{}{mockServer.URL + "/moved", mockServer.URL + "/page"},
+		"status_code":    float64(http.StatusOK),
+		"content_type":   "text/html",
+		"charset":        "utf-8",
+	}}, results)
+	mu.Lock()
+	require.Equal(t, []string{http.MethodHead, http.MethodHead}, methods, "redirects are followed with HEAD too")
+	mu.Unlock()
+
+	// HEAD metadata is not cached, a later GET still fetches the content
+	results = fetchResults(t, r, "/head-test")
+	require.Equal(t, "<html>a large page</html>", results[0]["content"])
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/head-test?method=post", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	h.AllowedOutboundMethods = []string{http.MethodGet}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/head-test?method=head", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code, "HEAD must be an allowed outbound method")
+}
+
+func TestDynamicHandler_ErrorsFollowAcceptHeader(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodPost, "/negotiate-test", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"), "errors default to JSON")
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "urls field required", body["error"])
+
+	req = httptest.NewRequest(http.MethodPost, "/negotiate-test", strings.NewReader(`{}`))
+	req.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), "urls field required")
+}
+
+func TestDynamicHandler_Search(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	storeURLs(t, r, "/search-one", []string{"https://bad.example.com/a", "https://fine.example.org"})
+	storeURLs(t, r, "/search-two", []string{"https://bad.example.com/b"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_search?q=bad.example.com", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Matches []struct {
+			Path string `json:"path"`
+			URL  string `json:"url"`
+		} `json:"matches"`
+		Truncated bool `json:"truncated"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.False(t, resp.Truncated)
+	require.Len(t, resp.Matches, 2)
+	require.Equal(t, "search-one", resp.Matches[0].Path)
+	require.Equal(t, "https://bad.example.com/a", resp.Matches[0].URL)
+	require.Equal(t, "search-two", resp.Matches[1].Path)
+	require.Equal(t, "https://bad.example.com/b", resp.Matches[1].URL)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_search?q=ba", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code, "short queries are rejected")
+}
+
+func TestDynamicHandler_ExplicitRoutes(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("explicit"))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.ExplicitRoutes = true
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	storeURLs(t, r, "/_store/feeds/news", []string{mockServer.URL + "/a"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/_store/feeds/news", strings.NewReader(`{"url": "`+mockServer.URL+`/b"}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	results := fetchResults(t, r, "/_fetch/feeds/news")
+	require.Len(t, results, 2)
+	require.Equal(t, "explicit", results[0]["content"])
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/_fetch/feeds/news", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "2", w.Header().Get("X-URL-Count"))
+
+	// The explicit routes share storage with the legacy ones
+	require.Len(t, fetchResults(t, r, "/feeds/news"), 2)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_store/feeds/news", nil))
+	require.Equal(t, http.StatusOK, w.Code, "methods the prefix does not serve fall through to the legacy routes")
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Equal(t, "_store/feeds/news", response["path"])
+}
+
+func TestDynamicHandler_ExplicitRoutesOffByDefault(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	storeURLs(t, r, "/_store/legacy", []string{"https://example.com/a"})
+	stored, err := h.DB.GetURLsByPath(context.Background(), "_store/legacy")
+	require.NoError(t, err)
+	require.Len(t, stored, 1, "the prefix is an ordinary path unless explicit routes are enabled")
+}
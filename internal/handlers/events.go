@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+)
+
+// streamIncompatibleParams are the GET query parameters that need every result at once, so
+// they are rejected on a stream instead of silently ignored
+var streamIncompatibleParams = []string{"all_or_nothing", "multi_status", "sort"}
+
+// streamEventWriteTimeout bounds writing a single event to the client. A stream outlives the
+// server's WriteTimeout, so the deadline is set per event and cleared between events.
+const streamEventWriteTimeout = 10 * time.Second
+
+// wantsEventStream reports whether the client accepts results as Server-Sent Events
+func wantsEventStream(req *http.Request) bool {
+	for _, accepted := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(accepted)
+		if err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// streamResults fetches urls and sends every result as a "result" event as soon as it is
+// fetched, followed by a "done" event. Each result event carries the URL's storage
+// position as its id, since results arrive in completion order.
+func (h *DynamicHandler) streamResults(w http.ResponseWriter, req *http.Request, path string, urls []db_model.URLRecord, opts fetchOptions) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	controller := http.NewResponseController(w)
+	send := func(write func()) {
+		// Writers without deadlines, such as test recorders, report ErrNotSupported
+		_ = controller.SetWriteDeadline(time.Now().Add(streamEventWriteTimeout))
+		write()
+		_ = controller.Flush()
+		_ = controller.SetWriteDeadline(time.Time{})
+	}
+	send(func() { w.WriteHeader(http.StatusOK) })
+
+	opts.onResult = func(outcome fetchOutcome) {
+		send(func() { writeEvent(w, "result", strconv.Itoa(outcome.index), outcome.result) })
+	}
+	h.fetchAll(req.Context(), urls, opts)
+
+	send(func() {
+		writeEvent(w, "done", "", map[string]interface{}{
+			"path":  path,
+			"count": len(urls),
+		})
+	})
+}
+
+// writeEvent writes one Server-Sent Event with a JSON payload. An empty id is left out.
+func writeEvent(w http.ResponseWriter, event, id string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		payload, _ = json.Marshal(map[string]string{"error": "Failed to encode event"})
+	}
+	if id != "" {
+		_, _ = fmt.Fprintf(w, "id: %s\n", id)
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// sseEvent is one parsed Server-Sent Event, or the error reading it
+type sseEvent struct {
+	id    string
+	event string
+	data  map[string]interface{}
+	err   error
+}
+
+// readEvent reads the next event from an event stream
+func readEvent(reader *bufio.Reader) sseEvent {
+	var ev sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return sseEvent{err: err}
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			return ev
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.data); err != nil {
+				return sseEvent{err: err}
+			}
+		}
+	}
+}
+
+func TestDynamicHandler_StreamsResultsAsEvents(t *testing.T) {
+	release := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/sse-test", []string{mockServer.URL + "/slow", mockServer.URL + "/fast"})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/sse-test", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan sseEvent)
+	go func() {
+		reader := bufio.NewReader(resp.Body)
+		for i := 0; i < 3; i++ {
+			events <- readEvent(reader)
+		}
+	}()
+
+	// The fast result arrives while the slow upstream is still holding its response
+	select {
+	case ev := <-events:
+		require.NoError(t, ev.err)
+		require.Equal(t, "result", ev.event)
+		require.Equal(t, "1", ev.id, "the id is the storage position")
+		require.Equal(t, "/fast", ev.data["content"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("the first result should be streamed before the slow fetch completes")
+	}
+
+	close(release)
+	ev := <-events
+	require.NoError(t, ev.err)
+	require.Equal(t, "result", ev.event)
+	require.Equal(t, "0", ev.id)
+	require.Equal(t, "/slow", ev.data["content"])
+
+	ev = <-events
+	require.NoError(t, ev.err)
+	require.Equal(t, "done", ev.event)
+	require.Equal(t, map[string]interface{}{"path": "sse-test", "count": float64(2)}, ev.data)
+}
+
+func TestDynamicHandler_StreamRejectsBatchParams(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/sse-params", []string{"https://example.com"})
+
+	for _, query := range []string{"sort=url", "all_or_nothing=true", "multi_status=false"} {
+		req := httptest.NewRequest(http.MethodGet, "/sse-params?"+query, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code, query)
+		require.Contains(t, w.Body.String(), "not supported with text/event-stream", query)
+	}
+}
+
+func TestWantsEventStream(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                  false,
+		"application/json":  false,
+		"text/event-stream": true,
+		"application/json, text/event-stream;q=0.9": true,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", accept)
+		require.Equal(t, want, wantsEventStream(req), accept)
+	}
+}
+
+func TestDynamicHandler_StreamOutlivesServerWriteTimeout(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/sse-deadline", []string{mockServer.URL + "/slow", mockServer.URL + "/fast"})
+
+	// The slow upstream answers well after the server's write deadline would have passed
+	server := httptest.NewUnstartedServer(r)
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/sse-deadline", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	reader := bufio.NewReader(resp.Body)
+	var got []string
+	for i := 0; i < 3; i++ {
+		ev := readEvent(reader)
+		require.NoError(t, ev.err, "the stream is cut off after %v", got)
+		got = append(got, ev.event+" "+ev.id)
+	}
+	require.Equal(t, []string{"result 1", "result 0", "done "}, got)
+}
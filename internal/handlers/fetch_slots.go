@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	// errFetchQueueFull is returned when MaxFetchQueue fetches are already waiting for a slot
+	errFetchQueueFull = errors.New("fetch queue is full")
+	// errFetchQueueDeadline is returned when a fetch waited FetchQueueDeadline without a slot
+	errFetchQueueDeadline = errors.New("timed out waiting for a fetch slot")
+)
+
+// fetchQueue is a counting semaphore that hands freed slots to its waiters in arrival order,
+// so an early request is not starved by later ones racing it for every slot that frees up
+type fetchQueue struct {
+	mu         sync.Mutex
+	free       int
+	maxWaiting int
+	// waiting holds a chan struct{} per waiter, closed once the slot is handed to it
+	waiting list.List
+}
+
+func newFetchQueue(slots, maxWaiting int) *fetchQueue {
+	return &fetchQueue{free: slots, maxWaiting: maxWaiting}
+}
+
+// tryAcquire takes a slot if one is free and nobody is queued ahead
+func (q *fetchQueue) tryAcquire() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.free > 0 && q.waiting.Len() == 0 {
+		q.free--
+		return true
+	}
+	return false
+}
+
+// acquire takes a slot, queueing behind earlier callers for at most wait when none is free.
+// A non-positive wait queues until ctx ends.
+func (q *fetchQueue) acquire(ctx context.Context, wait time.Duration) error {
+	q.mu.Lock()
+	if q.free > 0 && q.waiting.Len() == 0 {
+		q.free--
+		q.mu.Unlock()
+		return nil
+	}
+	if q.maxWaiting > 0 && q.waiting.Len() >= q.maxWaiting {
+		q.mu.Unlock()
+		return errFetchQueueFull
+	}
+	ready := make(chan struct{})
+	elem := q.waiting.PushBack(ready)
+	q.mu.Unlock()
+
+	var deadline <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-deadline:
+		err = errFetchQueueDeadline
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	select {
+	case <-ready:
+		// The slot was handed over while giving up; pass it on
+		q.mu.Unlock()
+		q.release()
+	default:
+		q.waiting.Remove(elem)
+		q.mu.Unlock()
+	}
+	return err
+}
+
+// release frees a slot, handing it straight to the longest waiter if there is one
+func (q *fetchQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if front := q.waiting.Front(); front != nil {
+		q.waiting.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	q.free++
+}
+
+// queued returns the number of waiters
+func (q *fetchQueue) queued() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting.Len()
+}
+
+// fetchSlotsFor returns the queue bounding outbound fetches across all requests, building it
+// on first use. It is nil when MaxGlobalFetches does not limit fetches.
+func (h *DynamicHandler) fetchSlotsFor() *fetchQueue {
+	h.fetchSlotsOnce.Do(func() {
+		if h.MaxGlobalFetches > 0 {
+			h.fetchSlots = newFetchQueue(h.MaxGlobalFetches, h.MaxFetchQueue)
+		}
+	})
+	return h.fetchSlots
+}
+
+// acquireFetchSlot waits its turn for a global fetch slot and returns the function releasing it.
+// It fails when the queue is full or FetchQueueDeadline passes first. If ctx ends first nothing
+// is held and the fetch itself fails on the same context.
+func (h *DynamicHandler) acquireFetchSlot(ctx context.Context) (func(), error) {
+	slots := h.fetchSlotsFor()
+	if slots == nil {
+		return func() {}, nil
+	}
+	err := slots.acquire(ctx, h.FetchQueueDeadline)
+	switch {
+	case err == nil:
+		return slots.release, nil
+	case ctx.Err() != nil:
+		return func() {}, nil
+	default:
+		return nil, err
+	}
+}
+
+// admitFetches reports whether a global fetch slot comes round within FetchQueueTimeout.
+// The slot is handed straight back: admission only tells a saturated server from a busy one,
+// the batch then queues for slots like any other.
+func (h *DynamicHandler) admitFetches(ctx context.Context) bool {
+	slots := h.fetchSlotsFor()
+	if slots == nil {
+		return true
+	}
+	if slots.tryAcquire() {
+		slots.release()
+		return true
+	}
+	if h.FetchQueueTimeout <= 0 {
+		return false
+	}
+	if err := slots.acquire(ctx, h.FetchQueueTimeout); err != nil {
+		return false
+	}
+	slots.release()
+	return true
+}
+
+// fetchRetryAfter is the Retry-After in whole seconds advertised when a GET is shed, capped at RetryAfterMax
+func (h *DynamicHandler) fetchRetryAfter() int {
+	delay := h.FetchQueueTimeout
+	if h.RetryAfterMax > 0 && delay > h.RetryAfterMax {
+		delay = h.RetryAfterMax
+	}
+	seconds := int(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_ShedsGETWhenFetchesSaturated(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.MaxGlobalFetches = 1
+	h.FetchQueueTimeout = 50 * time.Millisecond
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/slow-path", []string{mockServer.URL + "/slow"})
+	storeURLs(t, r, "/fast-path", []string{mockServer.URL + "/fast"})
+
+	// Hold the only fetch slot
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow-path", nil))
+		done <- w.Code
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast-path", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(release)
+	require.Equal(t, http.StatusOK, <-done)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast-path", nil))
+	require.Equal(t, http.StatusOK, w.Code, "requests are admitted again once a slot frees up")
+}
+
+func TestDynamicHandler_GETQueuesWithinFetchQueueTimeout(t *testing.T) {
+	h := setupTestHandler()
+	h.MaxGlobalFetches = 1
+	h.FetchQueueTimeout = 5 * time.Second
+
+	slots := h.fetchSlotsFor()
+	require.True(t, slots.tryAcquire())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		slots.release()
+	}()
+	require.True(t, h.admitFetches(t.Context()), "a slot freed before the timeout admits the request")
+}
+
+func TestDynamicHandler_FetchSlotsServedInArrivalOrder(t *testing.T) {
+	h := setupTestHandler()
+	h.MaxGlobalFetches = 1
+
+	holder, err := h.acquireFetchSlot(t.Context())
+	require.NoError(t, err)
+
+	// Queue the waiters one at a time so their arrival order is known
+	const waiters = 8
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := h.acquireFetchSlot(t.Context())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			release()
+		}()
+		require.Eventually(t, func() bool { return h.fetchSlotsFor().queued() == i+1 },
+			time.Second, time.Millisecond)
+	}
+
+	holder()
+	wg.Wait()
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7}, order)
+}
+
+func TestDynamicHandler_FetchQueueBounds(t *testing.T) {
+	h := setupTestHandler()
+	h.MaxGlobalFetches = 1
+	h.MaxFetchQueue = 1
+	h.FetchQueueDeadline = 50 * time.Millisecond
+
+	holder, err := h.acquireFetchSlot(t.Context())
+	require.NoError(t, err)
+	defer holder()
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := h.acquireFetchSlot(t.Context())
+		waited <- err
+	}()
+	require.Eventually(t, func() bool { return h.fetchSlotsFor().queued() == 1 }, time.Second, time.Millisecond)
+
+	_, err = h.acquireFetchSlot(t.Context())
+	require.ErrorIs(t, err, errFetchQueueFull, "a fetch beyond MaxFetchQueue fails at once")
+
+	require.ErrorIs(t, <-waited, errFetchQueueDeadline)
+	require.Zero(t, h.fetchSlotsFor().queued(), "a fetch giving up leaves the queue")
+
+	// A cancelled request leaves the queue without failing its fetch here
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	release, err := h.acquireFetchSlot(ctx)
+	require.NoError(t, err)
+	release()
+	require.Zero(t, h.fetchSlotsFor().queued())
+}
+
+func TestDynamicHandler_FetchRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		queueTimeout  time.Duration
+		retryAfterMax time.Duration
+		want          int
+	}{
+		{queueTimeout: 0, want: 1},
+		{queueTimeout: 1500 * time.Millisecond, want: 2},
+		{queueTimeout: 10 * time.Minute, want: 600},
+		{queueTimeout: 10 * time.Minute, retryAfterMax: time.Minute, want: 60},
+		{queueTimeout: 5 * time.Second, retryAfterMax: time.Minute, want: 5},
+	} {
+		h := &DynamicHandler{FetchQueueTimeout: tc.queueTimeout, RetryAfterMax: tc.retryAfterMax}
+		require.Equal(t, tc.want, h.fetchRetryAfter(), "timeout %v, max %v", tc.queueTimeout, tc.retryAfterMax)
+	}
+}
@@ -0,0 +1,654 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shaibs3/Guardz/internal/request_id"
+)
+
+// InvalidUTF8Policy controls how text responses containing invalid UTF-8 are returned
+type InvalidUTF8Policy string
+
+const (
+	// InvalidUTF8Base64 returns the body base64-encoded and flags "content_encoding":"base64"
+	InvalidUTF8Base64 InvalidUTF8Policy = "base64"
+	// InvalidUTF8Replace inlines the body with invalid bytes replaced by U+FFFD
+	InvalidUTF8Replace InvalidUTF8Policy = "replace"
+)
+
+// ParseInvalidUTF8Policy parses an InvalidUTF8Policy, rejecting unknown values rather than
+// falling back to base64. An empty value means base64.
+func ParseInvalidUTF8Policy(raw string) (InvalidUTF8Policy, error) {
+	switch policy := InvalidUTF8Policy(raw); policy {
+	case "":
+		return InvalidUTF8Base64, nil
+	case InvalidUTF8Base64, InvalidUTF8Replace:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown policy %q (use base64 or replace)", raw)
+	}
+}
+
+// DefaultMaxFetchTimeout bounds a single upstream fetch by default
+const DefaultMaxFetchTimeout = 30 * time.Second
+
+// DefaultFetchTimeout is the timeout of an upstream fetch stored without a timeout hint
+const DefaultFetchTimeout = 30 * time.Second
+
+// DefaultMaxRedirects is the redirect hop that fails a fetch by default, so nine hops are followed
+const DefaultMaxRedirects = 10
+
+// DefaultUserAgent is the User-Agent fetches send by default
+const DefaultUserAgent = "Guardz-URL-Fetcher/1.0"
+
+// DefaultMaxOutboundBodyBytes caps the body replayed to an upstream by default
+const DefaultMaxOutboundBodyBytes = 1 << 20 // 1MB
+
+// outboundRequest describes the upstream request issued for a stored URL
+type outboundRequest struct {
+	URL    string
+	Method string
+	Body   []byte
+	Header http.Header
+	// Timeout is the stored timeout hint, clamped to MaxFetchTimeout. Zero uses FetchTimeout.
+	Timeout time.Duration
+	// Timings adds a per-phase "timings" breakdown to the result
+	Timings bool
+	// Jar keeps cookies set by the upstream for later hops. Nil drops them.
+	Jar http.CookieJar
+	// ResolveOnly follows redirects and reports where they lead without downloading the body
+	ResolveOnly bool
+	// Budget, when set, skips the fetch once the URL's host has used up its bytes for the batch
+	Budget *hostByteBudget
+	// Slots, when set, takes the fetch slots the request is sent under once it is ready to go,
+	// returning the function releasing them
+	Slots func(ctx context.Context) (func(), error)
+	// Conditional, when set, makes the fetch conditional on the validators of a cached result
+	// and reports the validators of the response
+	Conditional *conditionalFetch
+}
+
+// conditionalFetch carries cache validators into a fetch and the outcome back out
+type conditionalFetch struct {
+	// sent are sent as If-None-Match and If-Modified-Since
+	sent cacheValidators
+	// received are the ETag and Last-Modified of the response
+	received cacheValidators
+	// notModified reports a 304 answer to the validators sent; the result then has no body
+	notModified bool
+}
+
+// hopByHopHeaders apply to a single connection and must never be forwarded
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// fetchURL fetches a single stored URL and builds its result entry
+func (h *DynamicHandler) fetchURL(parent context.Context, out outboundRequest) map[string]interface{} {
+	rawURL := out.URL
+	method := out.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	result := map[string]interface{}{
+		"url": rawURL,
+	}
+
+	// The inbound client may have disconnected while this URL was queued;
+	// its request context is cancelled then, so skip the outbound fetch
+	if err := parent.Err(); err != nil {
+		result["error"] = err.Error()
+		return result
+	}
+
+	// Hosts are resolved once per fetch, however many redirect hops revisit them
+	parent = withResolutionCache(parent, h.hostResolver(), h.resolutionCacheLimit())
+
+	// Validate URL before making request
+	if err := h.validateURLContext(parent, rawURL); err != nil {
+		result["error"] = err.Error()
+		return result
+	}
+
+	if !h.outboundMethodAllowed(method) {
+		result["error"] = fmt.Sprintf("outbound method %s is not allowed", method)
+		return result
+	}
+
+	// Refuse to replay an oversized body before anything is sent
+	if h.MaxOutboundBodyBytes > 0 && int64(len(out.Body)) > h.MaxOutboundBodyBytes {
+		result["error"] = fmt.Sprintf("outbound request body of %d bytes exceeds the maximum of %d bytes", len(out.Body), h.MaxOutboundBodyBytes)
+		return result
+	}
+
+	host := urlHost(rawURL)
+	if out.Budget.exhausted(host) {
+		result["skipped"] = skippedHostByteBudget
+		return result
+	}
+
+	// An open breaker would refuse the fetch anyway, so it waits for nothing and spends no
+	// rate token
+	if h.hostBreakerOpen(host) {
+		result["error"] = fmt.Sprintf("circuit breaker for host %s is open", host)
+		return result
+	}
+
+	// Requests to one host are spaced out however many stored URLs point at it. The wait comes
+	// before any fetch slot is taken, so a slow-rate host does not hold slots while idle.
+	if err := h.waitHostRate(parent, host); err != nil {
+		result["error"] = err.Error()
+		return result
+	}
+	if out.Slots != nil {
+		release, err := out.Slots(parent)
+		if err != nil {
+			result["error"] = err.Error()
+			return result
+		}
+		defer release()
+	}
+
+	// A host that keeps failing is not fetched again until its breaker lets a trial through
+	reportOutcome, err := h.allowHostFetch(rawURL)
+	if err != nil {
+		result["error"] = err.Error()
+		return result
+	}
+	// Only failures of the upstream itself count against its breaker: transport errors and
+	// server errors. A client hanging up or a fetch refused by policy says nothing of the host.
+	upstreamFailed := false
+	defer func() { reportOutcome(upstreamFailed && parent.Err() == nil) }()
+
+	// Create a context with timeout for the HTTP request
+	timeout := h.fetchTimeout(out.Timeout)
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	if out.Timings {
+		timings := newFetchTimings()
+		ctx = timings.withTrace(ctx)
+		// Reported for failed fetches too, a slow DNS or connect is often the cause
+		defer func() { result["timings"] = timings.result() }()
+	}
+
+	// Create HTTP request with context
+	var reqBody io.Reader
+	if len(out.Body) > 0 {
+		reqBody = bytes.NewReader(out.Body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, rawURL, reqBody)
+	if err != nil {
+		result["error"] = err.Error()
+		return result
+	}
+
+	for name, values := range out.Header {
+		for _, value := range values {
+			httpReq.Header.Add(name, value)
+		}
+	}
+	h.stripOutboundHeaders(httpReq.Header)
+
+	if id := request_id.FromContext(ctx); id != "" && h.CorrelationIDHeader != "" {
+		httpReq.Header.Set(h.CorrelationIDHeader, id)
+	}
+
+	httpReq.Header.Set("User-Agent", h.nextUserAgent())
+
+	// Asking for an encoding explicitly turns off the transport's transparent decompression,
+	// so the body can be decompressed behind the bomb guard instead
+	httpReq.Header.Set("Accept-Encoding", "gzip, deflate")
+
+	// Create a custom HTTP client that handles redirects, recording every hop it follows
+	var chain []string
+	redirectRefused := false
+	client := &http.Client{
+		Transport: h.outboundTransport(),
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if err := h.checkRedirect(req, via); err != nil {
+				redirectRefused = true
+				return err
+			}
+			if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+				stripStoredHeaders(req.Header, out.Header)
+			}
+			chain = redirectChain(req, via)
+			return nil
+		},
+		Jar: out.Jar,
+	}
+
+	// Large bodies may be answered from a HEAD, or not fetched at all
+	if !out.ResolveOnly && h.precheckSize(client, httpReq, result) {
+		return result
+	}
+
+	conditional := out.Conditional != nil && (out.Conditional.sent.etag != "" || out.Conditional.sent.lastModified != "")
+	if conditional {
+		if etag := out.Conditional.sent.etag; etag != "" {
+			httpReq.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := out.Conditional.sent.lastModified; lastModified != "" {
+			httpReq.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	// Make the HTTP request. A size precheck may have followed redirects of its own.
+	chain = nil
+	redirectRefused = false
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		upstreamFailed = !redirectRefused
+		result["error"] = err.Error()
+		// The hops followed before a redirect was refused show where it was heading
+		if chain != nil {
+			result["redirect_chain"] = chain
+		}
+		return result
+	}
+
+	upstreamFailed = resp.StatusCode >= http.StatusInternalServerError
+
+	if out.Conditional != nil {
+		out.Conditional.received = cacheValidators{
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+		}
+		if conditional && resp.StatusCode == http.StatusNotModified {
+			_ = resp.Body.Close()
+			out.Conditional.notModified = true
+			result["status_code"] = resp.StatusCode
+			return result
+		}
+	}
+
+	if out.ResolveOnly {
+		// Closing the unread body aborts the download
+		_ = resp.Body.Close()
+		result["final_url"] = redactURL(resp.Request.URL)
+		setRedirectChain(result, resp, chain)
+		result["status_code"] = resp.StatusCode
+		return result
+	}
+
+	if method == http.MethodHead {
+		// A HEAD response has no body, only the metadata is reported
+		_ = resp.Body.Close()
+		result["status_code"] = resp.StatusCode
+		setContentType(result, resp.Header.Get("Content-Type"))
+		setRedirectInfo(result, rawURL, resp.Request.URL)
+		setRedirectChain(result, resp, chain)
+		return result
+	}
+
+	if h.SuccessBodiesOnly && !h.successStatus(resp.StatusCode) {
+		// Closing the unread body aborts the download
+		_ = resp.Body.Close()
+		result["body_omitted"] = "status"
+		result["status_code"] = resp.StatusCode
+		setContentType(result, resp.Header.Get("Content-Type"))
+		setRedirectInfo(result, rawURL, resp.Request.URL)
+		setRedirectChain(result, resp, chain)
+		return result
+	}
+
+	bodyReader, decodedEncoding, err := h.decodedBody(resp)
+	if err != nil {
+		_ = resp.Body.Close()
+		result["error"] = err.Error()
+		return result
+	}
+
+	// Read response body with size limit (1MB)
+	limitedReader := io.LimitReader(bodyReader, 1<<20) // 1MB limit
+	body, err := io.ReadAll(limitedReader)
+	cerr := resp.Body.Close()
+	out.Budget.charge(host, int64(len(body)))
+	switch {
+	case err != nil && h.keepPartialRead(err, body):
+		// The upstream dropped the connection mid-body, keep what already arrived
+		result["partial"] = true
+		result["read_error"] = readErrorCategory(err)
+	case err != nil:
+		upstreamFailed = !errors.Is(err, errDecompressionBomb)
+		result["error"] = err.Error()
+		return result
+	case cerr != nil:
+		result["error"] = cerr.Error()
+		return result
+	}
+
+	// Check if response was truncated due to size limit
+	if len(body) == 1<<20 {
+		result["warning"] = "Response truncated due to size limit (1MB)"
+	}
+
+	// Debug print: log the length of the body
+	fmt.Printf("[DEBUG] URL: %s, Content-Type: %s, Body length: %d\n", rawURL, resp.Header.Get("Content-Type"), len(body))
+
+	setRedirectInfo(result, rawURL, resp.Request.URL)
+	setRedirectChain(result, resp, chain)
+
+	if hash, denied := h.deniedContentHash(body); denied {
+		result["error"] = contentDenylistError
+		result["content_sha256"] = hash
+		result["status_code"] = resp.StatusCode
+		return result
+	}
+
+	contentType := setContentType(result, resp.Header.Get("Content-Type"))
+	result["status_code"] = resp.StatusCode
+	if decodedEncoding != "" {
+		result["content_encoding_original"] = decodedEncoding
+	}
+
+	charset, _ := result["charset"].(string)
+	h.setContent(result, contentType, charset, body)
+	return result
+}
+
+// setRedirectInfo records in result whether the fetch of rawURL was redirected to finalURL.
+// The final URL comes from a redirect, so any credentials in it are left out.
+func setRedirectInfo(result map[string]interface{}, rawURL string, finalURL *url.URL) {
+	if finalURL.String() != rawURL {
+		result["original_url"] = rawURL
+		result["final_url"] = redactURL(finalURL)
+		result["redirected"] = true
+	} else {
+		result["redirected"] = false
+	}
+}
+
+// maxRedirectChain bounds the URLs listed in a result's redirect_chain, however many
+// redirects MaxRedirects allows
+const maxRedirectChain = 20
+
+// redirectChain lists the URLs traversed to reach req, starting with the stored URL,
+// with credentials removed and at most maxRedirectChain entries
+func redirectChain(req *http.Request, via []*http.Request) []string {
+	chain := make([]string, 0, min(len(via)+1, maxRedirectChain))
+	for _, hop := range append(via[:len(via):len(via)], req) {
+		if len(chain) == maxRedirectChain {
+			break
+		}
+		chain = append(chain, redactURL(hop.URL))
+	}
+	return chain
+}
+
+// redactURL returns u without its user information, which may hold a password or token
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	return redacted.String()
+}
+
+// setRedirectChain records in result how many redirects were followed to get resp and,
+// when there were any, the chain of URLs they went through
+func setRedirectChain(result map[string]interface{}, resp *http.Response, chain []string) {
+	count := redirectCount(resp)
+	result["redirect_count"] = count
+	if count > 0 && chain != nil {
+		result["redirect_chain"] = chain
+	}
+}
+
+// nextUserAgent returns the User-Agent for the next fetch, taking the UserAgents pool in turn
+func (h *DynamicHandler) nextUserAgent() string {
+	if len(h.UserAgents) == 0 {
+		return h.UserAgent
+	}
+	turn := h.userAgentTurn.Add(1) - 1
+	return h.UserAgents[turn%uint64(len(h.UserAgents))]
+}
+
+// redirectCount returns the number of redirect hops followed to get resp
+func redirectCount(resp *http.Response) int {
+	count := 0
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		count++
+	}
+	return count
+}
+
+// fetchTimeout applies a per-URL timeout hint, or FetchTimeout without one, bounded by MaxFetchTimeout
+func (h *DynamicHandler) fetchTimeout(hint time.Duration) time.Duration {
+	limit := h.MaxFetchTimeout
+	if limit <= 0 {
+		limit = DefaultMaxFetchTimeout
+	}
+	if hint <= 0 {
+		hint = h.FetchTimeout
+	}
+	if hint > 0 && hint < limit {
+		return hint
+	}
+	return limit
+}
+
+// keepPartialRead reports whether a body that failed mid-read should be returned as partial content
+func (h *DynamicHandler) keepPartialRead(err error, body []byte) bool {
+	// A decompression bomb is a deliberate abort, not a transport failure
+	return h.ReturnPartialReads && len(body) > 0 && !errors.Is(err, errDecompressionBomb)
+}
+
+// readErrorCategory classifies a body read error for partial results
+func readErrorCategory(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection_reset"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "unexpected_eof"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "read_error"
+	}
+}
+
+// checkRedirect decides whether the client may follow a redirect to req
+func (h *DynamicHandler) checkRedirect(req *http.Request, via []*http.Request) error {
+	// Limit redirects to prevent infinite loops; req is redirect hop number len(via)
+	if len(via) >= h.MaxRedirects {
+		return fmt.Errorf("too many redirects")
+	}
+
+	if req.Response != nil && !h.redirectCodeAllowed(req.Response.StatusCode) {
+		return fmt.Errorf("redirect status %d is not allowed", req.Response.StatusCode)
+	}
+
+	// Every hop must be as safe to fetch as the stored URL
+	if err := h.validateURLContext(req.Context(), req.URL.String()); err != nil {
+		return fmt.Errorf("redirect to disallowed host blocked: %w", err)
+	}
+
+	// Optionally cap how many hops may move to a different host
+	if h.CrossHostRedirectLimit >= 0 {
+		crossHostHops := 0
+		for i := 1; i <= len(via); i++ {
+			next := req
+			if i < len(via) {
+				next = via[i]
+			}
+			if !strings.EqualFold(next.URL.Hostname(), via[i-1].URL.Hostname()) {
+				crossHostHops++
+			}
+		}
+		if crossHostHops > h.CrossHostRedirectLimit {
+			return fmt.Errorf("too many cross-host redirects (limit %d)", h.CrossHostRedirectLimit)
+		}
+	}
+
+	// The client copies the original headers onto each redirect, strip them again
+	h.stripOutboundHeaders(req.Header)
+	return nil
+}
+
+// redirectCodeAllowed checks a redirect status code against AllowedRedirectCodes.
+// An empty list allows every code.
+func (h *DynamicHandler) redirectCodeAllowed(code int) bool {
+	if len(h.AllowedRedirectCodes) == 0 {
+		return true
+	}
+	for _, allowed := range h.AllowedRedirectCodes {
+		if allowed == code {
+			return true
+		}
+	}
+	return false
+}
+
+// successStatus checks a status code against SuccessStatuses. An empty list accepts every 2xx.
+func (h *DynamicHandler) successStatus(code int) bool {
+	if len(h.SuccessStatuses) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, status := range h.SuccessStatuses {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+// stripOutboundHeaders removes hop-by-hop headers and the OutboundHeaderDenylist from header
+func (h *DynamicHandler) stripOutboundHeaders(header http.Header) {
+	// Headers named in Connection are hop-by-hop as well
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+	for _, name := range h.OutboundHeaderDenylist {
+		header.Del(strings.TrimSpace(name))
+	}
+}
+
+// outboundMethodAllowed checks the method against AllowedOutboundMethods.
+// An empty list allows every method.
+func (h *DynamicHandler) outboundMethodAllowed(method string) bool {
+	if len(h.AllowedOutboundMethods) == 0 {
+		return true
+	}
+	for _, allowed := range h.AllowedOutboundMethods {
+		if strings.EqualFold(strings.TrimSpace(allowed), method) {
+			return true
+		}
+	}
+	return false
+}
+
+// setContent places the body into the result, inlining text and base64-encoding everything else.
+// Text declared in another charset is transcoded to UTF-8 first.
+func (h *DynamicHandler) setContent(result map[string]interface{}, contentType, charset string, body []byte) {
+	if !isTextContentType(contentType) || !h.textInlineAllowed(contentType) {
+		result["content"] = base64.StdEncoding.EncodeToString(body)
+		if isTextContentType(contentType) {
+			// Text the operator has not allowed to be inlined is flagged explicitly
+			result["content_encoding"] = "base64"
+		}
+		return
+	}
+
+	// Truncate to 1MB if needed
+	text := body
+	if len(text) > 1<<20 {
+		text = text[:1<<20]
+	}
+	if charset != "" {
+		decoded, converted, err := decodeCharset(text, charset)
+		if err != nil {
+			// Undecodable text is returned untouched rather than as mojibake
+			result["content"] = base64.StdEncoding.EncodeToString(text)
+			result["content_encoding"] = "base64"
+			result["charset_warning"] = err.Error()
+			return
+		}
+		text = decoded
+		if converted {
+			result["charset_converted"] = true
+		}
+	}
+	switch {
+	case utf8.Valid(text):
+		result["content"] = string(text)
+	case h.InvalidUTF8Policy == InvalidUTF8Replace:
+		// Declared as text but not valid UTF-8, replace the offending bytes
+		result["content"] = strings.ToValidUTF8(string(text), string(utf8.RuneError))
+		result["invalid_utf8_replaced"] = true
+	default:
+		// Not valid UTF-8, encode as base64
+		result["content"] = base64.StdEncoding.EncodeToString(text)
+		result["content_encoding"] = "base64"
+	}
+}
+
+// setContentType records the media type of a Content-Type header in result, with its charset
+// parameter kept separately, and returns the media type
+func setContentType(result map[string]interface{}, header string) string {
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		// Keep what can be read of a malformed header, the media type before any parameters
+		mediaType, _, _ = strings.Cut(header, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	}
+	result["content_type"] = mediaType
+	if charset := params["charset"]; charset != "" {
+		result["charset"] = charset
+	}
+	return mediaType
+}
+
+// isTextContentType reports whether a media type looks like text
+func isTextContentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") || strings.Contains(contentType, "json") || strings.Contains(contentType, "xml")
+}
+
+// textInlineAllowed checks the content type against the text MIME allowlist.
+// An empty allowlist allows every text type to be inlined.
+func (h *DynamicHandler) textInlineAllowed(contentType string) bool {
+	if len(h.TextMIMEAllowlist) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range h.TextMIMEAllowlist {
+		if strings.EqualFold(strings.TrimSpace(allowed), mediaType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,569 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/shaibs3/Guardz/internal/request_id"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_TextMIMEAllowlist(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"ok": true}`))
+		case "/csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			_, _ = w.Write([]byte("ssn,name\n123-45-6789,alice"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.TextMIMEAllowlist = []string{"application/json"}
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	storeURLs(t, r, "/mime-allowlist", []string{mockServer.URL + "/json", mockServer.URL + "/csv"})
+	results := fetchResults(t, r, "/mime-allowlist")
+	require.Len(t, results, 2, "expected 2 results")
+
+	// Allowlisted type is inlined as text
+	require.Equal(t, `{"ok": true}`, results[0]["content"], "allowlisted JSON should be inlined")
+	require.NotContains(t, results[0], "content_encoding", "allowlisted JSON should not be encoded")
+
+	// Non-allowlisted text type is base64-encoded instead of inlined
+	require.Equal(t, "base64", results[1]["content_encoding"], "non-allowlisted text should be flagged as base64")
+	decoded, err := base64.StdEncoding.DecodeString(results[1]["content"].(string))
+	require.NoError(t, err, "content should be valid base64")
+	require.Equal(t, "ssn,name\n123-45-6789,alice", string(decoded))
+}
+
+func TestDynamicHandler_ContentTypeParameters(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		_, _ = w.Write([]byte("<p>hello</p>"))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	tests := []struct {
+		header      string
+		mediaType   string
+		charset     string
+		base64Coded bool
+	}{
+		{header: "application/json; charset=utf-8", mediaType: "application/json", charset: "utf-8"},
+		{header: "text/html;charset=ISO-8859-1", mediaType: "text/html", charset: "ISO-8859-1"},
+		{header: "Text/Plain", mediaType: "text/plain"},
+		{header: "image/png; name=logo", mediaType: "image/png", base64Coded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			h := setupTestHandler()
+			h.TextMIMEAllowlist = []string{"application/json", "text/html", "text/plain"}
+			result := h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL + "/?type=" + url.QueryEscape(tt.header)})
+			require.Nil(t, result["error"])
+			require.Equal(t, tt.mediaType, result["content_type"])
+			if tt.charset == "" {
+				require.NotContains(t, result, "charset")
+			} else {
+				require.Equal(t, tt.charset, result["charset"])
+			}
+			if tt.base64Coded {
+				require.Equal(t, base64.StdEncoding.EncodeToString([]byte("<p>hello</p>")), result["content"])
+			} else {
+				require.Equal(t, "<p>hello</p>", result["content"], "text is inlined whatever its parameters")
+				require.NotContains(t, result, "content_encoding")
+			}
+		})
+	}
+}
+
+func TestDynamicHandler_TranscodesCharsets(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		want        string
+		converted   bool
+	}{
+		{name: "latin-1", contentType: "text/plain; charset=ISO-8859-1", body: []byte("caf\xe9 cr\xe8me br\xfbl\xe9e"), want: "café crème brûlée", converted: true},
+		{name: "shift_jis", contentType: "text/html; charset=Shift_JIS", body: []byte("\x93\xfa\x96\x7b\x8c\xea"), want: "日本語", converted: true},
+		{name: "utf-8 is left alone", contentType: "application/json; charset=utf-8", body: []byte(`{"name": "café"}`), want: `{"name": "café"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				_, _ = w.Write(tt.body)
+			}))
+			defer mockServer.Close()
+			cleanup := allowlistTestServer(t, mockServer.URL)
+			defer cleanup()
+
+			h := setupTestHandler()
+			result := h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL})
+			require.Nil(t, result["error"])
+			require.Equal(t, tt.want, result["content"])
+			require.True(t, utf8.ValidString(result["content"].(string)))
+			require.NotContains(t, result, "content_encoding")
+			if tt.converted {
+				require.Equal(t, true, result["charset_converted"])
+			} else {
+				require.NotContains(t, result, "charset_converted")
+			}
+		})
+	}
+}
+
+func TestDynamicHandler_UnknownCharsetFallsBackToBase64(t *testing.T) {
+	body := []byte("caf\xe9")
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=x-made-up")
+		_, _ = w.Write(body)
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	result := h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL})
+	require.Equal(t, base64.StdEncoding.EncodeToString(body), result["content"])
+	require.Equal(t, "base64", result["content_encoding"])
+	require.Equal(t, `unsupported charset "x-made-up"`, result["charset_warning"])
+}
+
+func TestDynamicHandler_TextMIMEAllowlist_EmptyAllowsAllText(t *testing.T) {
+	h := setupTestHandler()
+	require.True(t, h.textInlineAllowed("text/csv"))
+	require.True(t, h.textInlineAllowed("application/xml"))
+
+	h.TextMIMEAllowlist = []string{"text/plain"}
+	require.True(t, h.textInlineAllowed("text/plain; charset=utf-8"))
+	require.False(t, h.textInlineAllowed("text/html"))
+}
+
+func TestDynamicHandler_InvalidUTF8Policy(t *testing.T) {
+	invalid := []byte("caf\xe9 au lait")
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(invalid)
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	testCases := []struct {
+		name   string
+		policy InvalidUTF8Policy
+		check  func(t *testing.T, result map[string]interface{})
+	}{
+		{
+			name:   "base64",
+			policy: InvalidUTF8Base64,
+			check: func(t *testing.T, result map[string]interface{}) {
+				require.Equal(t, "base64", result["content_encoding"], "should flag base64 encoding")
+				decoded, err := base64.StdEncoding.DecodeString(result["content"].(string))
+				require.NoError(t, err)
+				require.Equal(t, invalid, decoded, "should preserve the original bytes")
+			},
+		},
+		{
+			name:   "replace",
+			policy: InvalidUTF8Replace,
+			check: func(t *testing.T, result map[string]interface{}) {
+				require.NotContains(t, result, "content_encoding", "should be inlined")
+				require.Equal(t, "caf� au lait", result["content"], "invalid bytes should be replaced")
+				require.Equal(t, true, result["invalid_utf8_replaced"])
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := setupTestHandler()
+			h.InvalidUTF8Policy = tc.policy
+			r := mux.NewRouter()
+			h.RegisterRoutes(r, zap.NewNop())
+
+			storeURLs(t, r, "/utf8-test", []string{mockServer.URL})
+			results := fetchResults(t, r, "/utf8-test")
+			require.Len(t, results, 1)
+			tc.check(t, results[0])
+		})
+	}
+}
+
+func TestParseInvalidUTF8Policy(t *testing.T) {
+	for raw, want := range map[string]InvalidUTF8Policy{"": InvalidUTF8Base64, "base64": InvalidUTF8Base64, "replace": InvalidUTF8Replace} {
+		policy, err := ParseInvalidUTF8Policy(raw)
+		require.NoError(t, err, raw)
+		require.Equal(t, want, policy, raw)
+	}
+	for _, raw := range []string{"Replace", "drop", "base-64"} {
+		_, err := ParseInvalidUTF8Policy(raw)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestDynamicHandler_AllowedOutboundMethods(t *testing.T) {
+	var hits int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.Method))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.AllowedOutboundMethods = []string{http.MethodGet}
+
+	// A replayed POST is blocked before anything is sent upstream
+	result := h.fetchURL(context.Background(), outboundRequest{
+		URL:    mockServer.URL,
+		Method: http.MethodPost,
+		Body:   []byte(`{"replay": true}`),
+	})
+	require.Equal(t, "outbound method POST is not allowed", result["error"])
+	require.Equal(t, int32(0), atomic.LoadInt32(&hits), "blocked method should not reach the upstream")
+
+	// GET is still permitted
+	result = h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL})
+	require.NotContains(t, result, "error")
+	require.Equal(t, "GET", result["content"])
+	require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	// Once allowed, the POST is replayed with its body
+	h.AllowedOutboundMethods = []string{http.MethodGet, http.MethodPost}
+	result = h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL, Method: http.MethodPost})
+	require.Equal(t, "POST", result["content"])
+}
+
+func TestDynamicHandler_CrossHostRedirectLimit(t *testing.T) {
+	var port string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			// 127.0.0.1 -> localhost is a cross-host hop
+			http.Redirect(w, r, "http://localhost:"+port+"/hop", http.StatusFound)
+		case "/hop":
+			// localhost -> 127.0.0.1 is a second cross-host hop
+			http.Redirect(w, r, "http://127.0.0.1:"+port+"/same-host", http.StatusFound)
+		case "/same-host":
+			// Same-host hop does not count
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/final":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("arrived"))
+		}
+	}))
+	defer mockServer.Close()
+	port = mockServer.URL[strings.LastIndex(mockServer.URL, ":")+1:]
+
+	require.NoError(t, os.Setenv("GUARDZ_TEST_ALLOWLIST", "127.0.0.1,localhost"))
+	defer func() { _ = os.Unsetenv("GUARDZ_TEST_ALLOWLIST") }()
+
+	testCases := []struct {
+		limit       int
+		expectedErr string
+	}{
+		{limit: -1},
+		{limit: 2},
+		{limit: 1, expectedErr: "too many cross-host redirects (limit 1)"},
+		{limit: 0, expectedErr: "too many cross-host redirects (limit 0)"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("limit %d", tc.limit), func(t *testing.T) {
+			h := setupTestHandler()
+			h.CrossHostRedirectLimit = tc.limit
+
+			result := h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL + "/start"})
+			if tc.expectedErr != "" {
+				require.Contains(t, result["error"], tc.expectedErr)
+				return
+			}
+			require.NotContains(t, result, "error")
+			require.Equal(t, "arrived", result["content"])
+		})
+	}
+}
+
+func TestDynamicHandler_OutboundHeaderDenylist(t *testing.T) {
+	var received http.Header
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.OutboundHeaderDenylist = []string{"X-Internal-Auth"}
+
+	result := h.fetchURL(context.Background(), outboundRequest{
+		URL: mockServer.URL,
+		Header: http.Header{
+			"X-Internal-Auth": []string{"secret"},
+			"X-Request-Id":    []string{"abc"},
+		},
+	})
+	require.NotContains(t, result, "error")
+	require.Empty(t, received.Get("X-Internal-Auth"), "denylisted header must not reach the upstream")
+	require.Equal(t, "abc", received.Get("X-Request-Id"))
+}
+
+func TestDynamicHandler_CheckRedirectStripsHeaders(t *testing.T) {
+	h := setupTestHandler()
+	h.OutboundHeaderDenylist = []string{"X-Internal-Auth"}
+
+	via, err := http.NewRequest(http.MethodGet, "http://example.com/start", nil)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/next", nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("X-Internal-Auth", "secret")
+	req.Header.Set("X-Request-Id", "abc")
+
+	require.NoError(t, h.checkRedirect(req, []*http.Request{via}))
+	for _, name := range []string{"Connection", "X-Hop", "Keep-Alive", "Upgrade", "X-Internal-Auth"} {
+		require.Empty(t, req.Header.Get(name), "%s should not be forwarded on redirect", name)
+	}
+	require.Equal(t, "abc", req.Header.Get("X-Request-Id"))
+}
+
+func TestDynamicHandler_MaxOutboundBodyBytes(t *testing.T) {
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.AllowedOutboundMethods = []string{http.MethodPost}
+	h.MaxOutboundBodyBytes = 16
+
+	result := h.fetchURL(context.Background(), outboundRequest{
+		URL:    mockServer.URL,
+		Method: http.MethodPost,
+		Body:   []byte(strings.Repeat("x", 17)),
+	})
+	require.Equal(t, "outbound request body of 17 bytes exceeds the maximum of 16 bytes", result["error"])
+	require.Equal(t, int32(0), atomic.LoadInt32(&calls), "oversized body must be rejected before sending")
+
+	result = h.fetchURL(context.Background(), outboundRequest{
+		URL:    mockServer.URL,
+		Method: http.MethodPost,
+		Body:   []byte(strings.Repeat("x", 16)),
+	})
+	require.NotContains(t, result, "error")
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDynamicHandler_ReturnPartialReads(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Promise more bytes than are sent, then drop the connection
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 100\r\n\r\npartial body")
+		_ = buf.Flush()
+		_ = conn.Close()
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+
+	result := h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL})
+	require.Contains(t, result["error"], "unexpected EOF", "partial reads fail by default")
+	require.NotContains(t, result, "content")
+
+	h.ReturnPartialReads = true
+	result = h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL})
+	require.NotContains(t, result, "error")
+	require.Equal(t, true, result["partial"])
+	require.Equal(t, "unexpected_eof", result["read_error"])
+	require.Equal(t, "partial body", result["content"])
+	require.Equal(t, http.StatusOK, result["status_code"])
+}
+
+func TestDynamicHandler_AllowedRedirectCodes(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/permanent":
+			http.Redirect(w, r, "/final", http.StatusPermanentRedirect)
+		case "/found":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/final":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("arrived"))
+		}
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	result := h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL + "/permanent"})
+	require.Equal(t, "arrived", result["content"], "every redirect is followed by default")
+
+	h.AllowedRedirectCodes = []int{http.StatusMovedPermanently, http.StatusFound}
+	result = h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL + "/permanent"})
+	require.Contains(t, result["error"], "redirect status 308 is not allowed")
+
+	result = h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL + "/found"})
+	require.Nil(t, result["error"])
+	require.Equal(t, "arrived", result["content"])
+}
+
+func TestDynamicHandler_BlocksRedirectToDisallowedHost(t *testing.T) {
+	var internalHits int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			atomic.AddInt32(&internalHits, 1)
+			_, _ = w.Write([]byte("secret"))
+			return
+		}
+		// Reached as the allowlisted localhost, redirect to the loopback address itself
+		http.Redirect(w, r, strings.Replace("http://"+r.Host, "localhost", "127.0.0.1", 1)+"/internal", http.StatusFound)
+	}))
+	defer mockServer.Close()
+	require.NoError(t, os.Setenv("GUARDZ_TEST_ALLOWLIST", "localhost"))
+	defer func() { _ = os.Unsetenv("GUARDZ_TEST_ALLOWLIST") }()
+
+	h := setupTestHandler()
+	publicURL := strings.Replace(mockServer.URL, "127.0.0.1", "localhost", 1)
+	result := h.fetchURL(context.Background(), outboundRequest{URL: publicURL + "/start"})
+	require.Contains(t, result["error"], "redirect to disallowed host blocked")
+	require.Nil(t, result["content"])
+	require.Zero(t, atomic.LoadInt32(&internalHits), "the redirect target must not be fetched")
+}
+
+func TestDynamicHandler_ForwardsCorrelationID(t *testing.T) {
+	received := make(chan string, 1)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-Correlation-ID")
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.CorrelationIDHeader = "X-Correlation-ID"
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/correlation-test", []string{mockServer.URL})
+
+	// The request ID middleware leaves the inbound ID on the request context
+	req := httptest.NewRequest(http.MethodGet, "/correlation-test", nil)
+	req = req.WithContext(request_id.NewContext(req.Context(), "req-42"))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "req-42", <-received)
+}
+
+func TestDynamicHandler_RotatesUserAgents(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.UserAgent()))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/agents-test", []string{mockServer.URL + "/a", mockServer.URL + "/b", mockServer.URL + "/c", mockServer.URL + "/d"})
+
+	for _, result := range fetchResults(t, r, "/agents-test") {
+		require.Equal(t, DefaultUserAgent, result["content"], "without a pool every fetch sends the default")
+	}
+
+	h.UserAgents = []string{"agent-one", "agent-two"}
+	used := map[string]int{}
+	for _, result := range fetchResults(t, r, "/agents-test") {
+		used[result["content"].(string)]++
+	}
+	require.Equal(t, map[string]int{"agent-one": 2, "agent-two": 2}, used, "fetches take the pool in turn")
+}
+
+func TestDynamicHandler_SuccessBodiesOnly(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/accepted":
+			w.WriteHeader(http.StatusAccepted)
+		}
+		_, _ = w.Write([]byte("body of " + r.URL.Path))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.SuccessBodiesOnly = true
+	fetch := func(path string) map[string]interface{} {
+		return h.fetchURL(context.Background(), outboundRequest{URL: mockServer.URL + path})
+	}
+
+	ok := fetch("/ok")
+	require.Equal(t, "body of /ok", ok["content"])
+	require.NotContains(t, ok, "body_omitted")
+
+	missing := fetch("/missing")
+	require.NotContains(t, missing, "content", "an error status returns no body")
+	require.Equal(t, "status", missing["body_omitted"])
+	require.Equal(t, http.StatusNotFound, missing["status_code"])
+	require.Equal(t, "text/plain", missing["content_type"])
+	require.NotContains(t, missing, "error")
+
+	// A configured set replaces the 2xx default
+	h.SuccessStatuses = []int{http.StatusOK, http.StatusNotFound}
+	require.Equal(t, "body of /missing", fetch("/missing")["content"])
+	require.Equal(t, "status", fetch("/accepted")["body_omitted"])
+
+	h.SuccessBodiesOnly = false
+	require.Equal(t, "body of /accepted", fetch("/accepted")["content"], "the mode is off by default")
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/render"
+	"github.com/shaibs3/Guardz/internal/telemetry"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// hostBreakerSweepInterval is how often breakers that no longer hold anything are dropped
+const hostBreakerSweepInterval = time.Minute
+
+// hostBreakerIdleTimeout is how long a breaker that is not open may go unused before it is dropped
+const hostBreakerIdleTimeout = 10 * time.Minute
+
+// HostBreakerSettings configures the circuit breaker kept for every upstream host
+type HostBreakerSettings struct {
+	// FailureThreshold is the number of consecutive failed fetches that opens a host's breaker.
+	// Zero disables the breakers.
+	FailureThreshold uint32
+
+	// MaxRequests is the number of trial fetches let through while a breaker is half-open
+	MaxRequests uint32
+
+	// Interval is how often a closed breaker clears its failure counts. Zero never clears them.
+	Interval time.Duration
+
+	// Timeout is how long a breaker stays open before it lets trial fetches through
+	Timeout time.Duration
+}
+
+// BreakerMetrics counts upstream host circuit breaker state changes
+type BreakerMetrics struct {
+	StateChanges metric.Int64Counter
+}
+
+// NewBreakerMetrics creates the breaker instruments, prefixing their names with namespace when set
+func NewBreakerMetrics(meter metric.Meter, namespace string, logger *zap.Logger) *BreakerMetrics {
+	stateChanges, err := meter.Int64Counter(
+		telemetry.MetricName(namespace, "host_breaker_state_changes_total"),
+		metric.WithDescription("Total number of upstream host circuit breaker state changes, by state"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		logger.Error("failed to create host breaker state changes metric", zap.Error(err))
+	}
+	return &BreakerMetrics{StateChanges: stateChanges}
+}
+
+// recordStateChange counts a breaker moving from one state to another. The host is left out so
+// upstreams cannot grow the metric's cardinality. A nil receiver records nothing.
+func (m *BreakerMetrics) recordStateChange(ctx context.Context, from, to gobreaker.State) {
+	if m == nil || m.StateChanges == nil {
+		return
+	}
+	m.StateChanges.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("from", from.String()),
+		attribute.String("to", to.String()),
+	))
+}
+
+// hostBreakers keeps one circuit breaker per upstream host, created on first use
+type hostBreakers struct {
+	mu        sync.Mutex
+	breakers  map[string]*hostBreakerEntry
+	lastSweep time.Time
+}
+
+// hostBreakerEntry is the breaker of one host and when it was last asked for
+type hostBreakerEntry struct {
+	breaker  *gobreaker.TwoStepCircuitBreaker
+	lastUsed time.Time
+}
+
+// sweep drops the closed breakers that either have no consecutive failures or went unused for
+// hostBreakerIdleTimeout. A new breaker behaves the same as such a breaker, or at worst forgets
+// a few failures, so hosts fetched once do not pile up. Open and half-open breakers are kept:
+// a half-open breaker's counts are reset, yet it still limits the trial fetches.
+func (b *hostBreakers) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < hostBreakerSweepInterval {
+		return
+	}
+	b.lastSweep = now
+	for host, entry := range b.breakers {
+		if entry.breaker.State() != gobreaker.StateClosed {
+			continue
+		}
+		if entry.breaker.Counts().ConsecutiveFailures == 0 || now.Sub(entry.lastUsed) >= hostBreakerIdleTimeout {
+			delete(b.breakers, host)
+		}
+	}
+}
+
+// hostBreaker returns the circuit breaker of host, or nil when the breakers are disabled
+func (h *DynamicHandler) hostBreaker(host string) *gobreaker.TwoStepCircuitBreaker {
+	if h.HostBreakers.FailureThreshold == 0 || host == "" {
+		return nil
+	}
+	now := h.clock()
+	h.breakers.mu.Lock()
+	defer h.breakers.mu.Unlock()
+	h.breakers.sweep(now)
+	if entry, ok := h.breakers.breakers[host]; ok {
+		entry.lastUsed = now
+		return entry.breaker
+	}
+	if h.breakers.breakers == nil {
+		h.breakers.breakers = make(map[string]*hostBreakerEntry)
+	}
+	threshold := h.HostBreakers.FailureThreshold
+	breaker := gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:        host,
+		MaxRequests: h.HostBreakers.MaxRequests,
+		Interval:    h.HostBreakers.Interval,
+		Timeout:     h.HostBreakers.Timeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= threshold
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			h.BreakerMetrics.recordStateChange(context.Background(), from, to)
+		},
+	})
+	h.breakers.breakers[host] = &hostBreakerEntry{breaker: breaker, lastUsed: now}
+	return breaker
+}
+
+// hostBreakerOpen reports whether the breaker of host is open, without using up a trial
+// fetch of a half-open one
+func (h *DynamicHandler) hostBreakerOpen(host string) bool {
+	breaker := h.hostBreaker(host)
+	return breaker != nil && breaker.State() == gobreaker.StateOpen
+}
+
+// allowHostFetch asks the breaker of rawURL's host whether it may be fetched. The returned
+// function reports whether the upstream failed the fetch and must be called once it is done;
+// it is a no-op when the breakers are disabled.
+func (h *DynamicHandler) allowHostFetch(rawURL string) (func(failed bool), error) {
+	host := urlHost(rawURL)
+	breaker := h.hostBreaker(host)
+	if breaker == nil {
+		return func(bool) {}, nil
+	}
+	done, err := breaker.Allow()
+	if err != nil {
+		return nil, fmt.Errorf("circuit breaker for host %s is open", host)
+	}
+	return func(failed bool) { done(!failed) }, nil
+}
+
+// hostBreakerState is one host in the /admin/breakers listing
+type hostBreakerState struct {
+	Host                string `json:"host"`
+	State               string `json:"state"`
+	ConsecutiveFailures uint32 `json:"consecutive_failures"`
+}
+
+// requireAdminToken wraps next so it is only served to requests carrying AdminToken as a bearer token
+func (h *DynamicHandler) requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			render.Error(w, req, "an admin token is required", http.StatusUnauthorized)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) != 1 {
+			render.Error(w, req, "not authorized", http.StatusForbidden)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// handleGetBreakers lists the circuit breaker state of every upstream host still tracked
+func (h *DynamicHandler) handleGetBreakers(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	h.breakers.mu.Lock()
+	states := make([]hostBreakerState, 0, len(h.breakers.breakers))
+	for host, entry := range h.breakers.breakers {
+		states = append(states, hostBreakerState{
+			Host:                host,
+			State:               entry.breaker.State().String(),
+			ConsecutiveFailures: entry.breaker.Counts().ConsecutiveFailures,
+		})
+	}
+	h.breakers.mu.Unlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].Host < states[j].Host })
+
+	err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"breakers": states,
+	})
+	if err != nil {
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
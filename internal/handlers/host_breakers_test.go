@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+)
+
+// listBreakers returns the host breaker states served by /admin/breakers
+func listBreakers(t *testing.T, r *mux.Router) map[string]string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/breakers", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Breakers []hostBreakerState `json:"breakers"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	states := make(map[string]string)
+	for _, breaker := range resp.Breakers {
+		states[breaker.Host] = breaker.State
+	}
+	return states
+}
+
+func TestDynamicHandler_HostBreakersTripIndependently(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Query().Get("fail") == "1" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	parsed, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port := parsed.Port()
+
+	_ = os.Setenv("GUARDZ_TEST_ALLOWLIST", "one.test,two.test")
+	defer func() { _ = os.Unsetenv("GUARDZ_TEST_ALLOWLIST") }()
+
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	h := setupTestHandler()
+	h.Resolver = &countingResolver{calls: make(map[string]int)}
+	h.HostBreakers = HostBreakerSettings{FailureThreshold: 2, MaxRequests: 1, Timeout: time.Minute}
+	h.BreakerMetrics = NewBreakerMetrics(meter, "", zap.NewNop())
+	h.AdminToken = "admin-secret"
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	fetch := func(host, query string) map[string]interface{} {
+		return h.fetchURL(context.Background(), outboundRequest{URL: "http://" + host + ":" + port + "/?" + query})
+	}
+
+	// Trip one.test while two.test keeps succeeding
+	fetch("one.test", "fail=1")
+	fetch("two.test", "")
+	fetch("one.test", "fail=1")
+	require.Equal(t, map[string]string{"one.test": "open", "two.test": "closed"}, listBreakers(t, r))
+
+	before := hits.Load()
+	result := fetch("one.test", "")
+	require.Equal(t, "circuit breaker for host one.test is open", result["error"])
+	require.Equal(t, before, hits.Load(), "an open breaker does not reach the upstream")
+	result = fetch("two.test", "")
+	require.Nil(t, result["error"])
+	require.Equal(t, http.StatusOK, result["status_code"])
+
+	// Trip two.test as well
+	fetch("two.test", "fail=1")
+	fetch("two.test", "fail=1")
+	require.Equal(t, map[string]string{"one.test": "open", "two.test": "open"}, listBreakers(t, r))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	changes := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "host_breaker_state_changes_total" {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				_, hasHost := point.Attributes.Value("host")
+				require.False(t, hasHost, "hosts must not become metric attributes")
+				to, _ := point.Attributes.Value("to")
+				changes[to.AsString()] = point.Value
+			}
+		}
+	}
+	require.Equal(t, map[string]int64{"open": 2}, changes)
+}
+
+func TestDynamicHandler_BreakersRouteOnlyWhenEnabled(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	// Without breakers the path is an ordinary stored path
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/breakers", nil))
+	require.NotContains(t, w.Body.String(), `"breakers"`)
+
+	// Nor is it served without an admin token
+	h = setupTestHandler()
+	h.HostBreakers = HostBreakerSettings{FailureThreshold: 1}
+	r = mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/breakers", nil))
+	require.NotContains(t, w.Body.String(), `"breakers"`)
+}
+
+func TestDynamicHandler_BreakersRouteRequiresAdminToken(t *testing.T) {
+	h := setupTestHandler()
+	h.HostBreakers = HostBreakerSettings{FailureThreshold: 1}
+	h.AdminToken = "admin-secret"
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/breakers", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/breakers", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	require.Empty(t, listBreakers(t, r))
+}
+
+func TestHostBreakers_SweepDropsIdleBreakers(t *testing.T) {
+	start := time.Now()
+	now := start
+	h := setupTestHandler()
+	h.now = func() time.Time { return now }
+	h.HostBreakers = HostBreakerSettings{FailureThreshold: 3, Timeout: time.Hour}
+
+	fail := func(host string) {
+		done, err := h.allowHostFetch("http://" + host + "/")
+		require.NoError(t, err)
+		done(true)
+	}
+	h.hostBreaker("healthy.test")
+	fail("failing.test")
+	fail("open.test")
+	fail("open.test")
+	fail("open.test")
+	require.True(t, h.hostBreakerOpen("open.test"))
+
+	// Breakers without consecutive failures are dropped on the next sweep
+	now = start.Add(hostBreakerSweepInterval)
+	h.hostBreaker("trigger.test")
+	require.NotContains(t, h.breakers.breakers, "healthy.test")
+	require.Contains(t, h.breakers.breakers, "failing.test")
+	require.Contains(t, h.breakers.breakers, "open.test")
+
+	// Idle breakers with failures go too, open ones are kept
+	now = start.Add(hostBreakerSweepInterval + hostBreakerIdleTimeout)
+	h.hostBreaker("trigger.test")
+	require.NotContains(t, h.breakers.breakers, "failing.test")
+	require.Contains(t, h.breakers.breakers, "open.test")
+}
+
+func TestDynamicHandler_HostBreakerIgnoresNonUpstreamFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/bad", http.StatusFound)
+		case "/hang":
+			<-r.Context().Done()
+		case "/fail":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte("bad"))
+		}
+	}))
+	defer server.Close()
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.HostBreakers = HostBreakerSettings{FailureThreshold: 1, Timeout: time.Minute}
+	h.MaxRedirects = 1
+	sum := sha256.Sum256([]byte("bad"))
+	h.ContentHashDenylist = []string{hex.EncodeToString(sum[:])}
+	host := urlHost(server.URL)
+
+	// Policy rejections fail the fetch without blaming the host
+	result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL + "/bad"})
+	require.Equal(t, contentDenylistError, result["error"])
+	result = h.fetchURL(context.Background(), outboundRequest{URL: server.URL + "/redirect"})
+	require.Contains(t, result["error"], "too many redirects")
+	require.False(t, h.hostBreakerOpen(host))
+
+	// So does the client hanging up
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	result = h.fetchURL(ctx, outboundRequest{URL: server.URL + "/hang"})
+	require.NotNil(t, result["error"])
+	require.False(t, h.hostBreakerOpen(host), "a cancelled request must not trip the breaker")
+
+	// A server error does
+	h.fetchURL(context.Background(), outboundRequest{URL: server.URL + "/fail"})
+	require.True(t, h.hostBreakerOpen(host))
+}
+
+func TestHostBreakers_SweepKeepsHalfOpenBreakers(t *testing.T) {
+	start := time.Now()
+	now := start
+	h := setupTestHandler()
+	h.now = func() time.Time { return now }
+	h.HostBreakers = HostBreakerSettings{FailureThreshold: 1, MaxRequests: 1, Timeout: 10 * time.Millisecond}
+
+	done, err := h.allowHostFetch("http://flaky.test/")
+	require.NoError(t, err)
+	done(true)
+	require.True(t, h.hostBreakerOpen("flaky.test"))
+
+	// Once the timeout passes the breaker is half-open, with its counts reset
+	require.Eventually(t, func() bool {
+		return h.hostBreaker("flaky.test").State() == gobreaker.StateHalfOpen
+	}, time.Second, 5*time.Millisecond)
+	require.Zero(t, h.hostBreaker("flaky.test").Counts().ConsecutiveFailures)
+
+	now = start.Add(hostBreakerSweepInterval)
+	h.hostBreaker("trigger.test")
+	require.Contains(t, h.breakers.breakers, "flaky.test", "a half-open breaker must survive the sweep")
+
+	// It still lets a single trial fetch through
+	_, err = h.allowHostFetch("http://flaky.test/")
+	require.NoError(t, err)
+	_, err = h.allowHostFetch("http://flaky.test/")
+	require.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HostPolicy decides which hosts may be stored and fetched. Patterns are exact host names or
+// wildcards such as *.example.com, which match every subdomain of example.com but not example.com itself.
+type HostPolicy struct {
+	allow []string
+	deny  []string
+}
+
+// NewHostPolicy compiles allow and deny host patterns. An empty allow list lets every host
+// through that is not denied; a denied host is rejected even when it is also allowed.
+func NewHostPolicy(allow, deny []string) *HostPolicy {
+	return &HostPolicy{
+		allow: compileHostPatterns(allow),
+		deny:  compileHostPatterns(deny),
+	}
+}
+
+// compileHostPatterns normalizes patterns for matching, dropping empty ones
+func compileHostPatterns(patterns []string) []string {
+	var compiled []string
+	for _, pattern := range patterns {
+		pattern = normalizePolicyHost(pattern)
+		if pattern != "" {
+			compiled = append(compiled, pattern)
+		}
+	}
+	return compiled
+}
+
+// normalizePolicyHost lowercases host and strips IPv6 brackets and a trailing dot
+func normalizePolicyHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.Trim(strings.TrimSpace(host), "[]")), ".")
+}
+
+// Check rejects host when it is denied, or when an allow list is set and host matches none of it.
+// A nil policy allows every host.
+func (p *HostPolicy) Check(host string) error {
+	if p == nil {
+		return nil
+	}
+	host = normalizePolicyHost(host)
+	if matchesHostPattern(p.deny, host) {
+		return fmt.Errorf("host %s is denied by the host policy", host)
+	}
+	if len(p.allow) > 0 && !matchesHostPattern(p.allow, host) {
+		return fmt.Errorf("host %s is not allowed by the host policy", host)
+	}
+	return nil
+}
+
+// matchesHostPattern reports whether host matches any of patterns
+func matchesHostPattern(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostPolicy_Check(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		host    string
+		wantErr string
+	}{
+		{name: "no patterns allow everything", host: "example.com"},
+		{name: "exact allow match", allow: []string{"api.example.com"}, host: "api.example.com"},
+		{name: "exact allow is case-insensitive", allow: []string{"API.example.com"}, host: "api.EXAMPLE.com."},
+		{name: "host outside the allowlist", allow: []string{"api.example.com"}, host: "www.example.com", wantErr: "host www.example.com is not allowed by the host policy"},
+		{name: "wildcard matches a subdomain", allow: []string{"*.example.com"}, host: "api.example.com"},
+		{name: "wildcard matches a nested subdomain", allow: []string{"*.example.com"}, host: "a.b.example.com"},
+		{name: "wildcard does not match the apex", allow: []string{"*.example.com"}, host: "example.com", wantErr: "not allowed"},
+		{name: "wildcard does not match a lookalike", allow: []string{"*.example.com"}, host: "evilexample.com", wantErr: "not allowed"},
+		{name: "exact deny", deny: []string{"evil.example.com"}, host: "evil.example.com", wantErr: "host evil.example.com is denied by the host policy"},
+		{name: "deny leaves other hosts alone", deny: []string{"evil.example.com"}, host: "good.example.com"},
+		{name: "wildcard deny", deny: []string{"*.evil.com"}, host: "cdn.evil.com", wantErr: "denied"},
+		{name: "deny takes precedence over exact allow", allow: []string{"evil.example.com"}, deny: []string{"evil.example.com"}, host: "evil.example.com", wantErr: "denied"},
+		{name: "deny takes precedence over wildcard allow", allow: []string{"*.example.com"}, deny: []string{"internal.example.com"}, host: "internal.example.com", wantErr: "denied"},
+		{name: "wildcard allow still admits the rest", allow: []string{"*.example.com"}, deny: []string{"internal.example.com"}, host: "public.example.com"},
+		{name: "IPv6 literal", allow: []string{"[2001:db8::1]"}, host: "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewHostPolicy(tt.allow, tt.deny).Check(tt.host)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestHostPolicy_NilAllowsEverything(t *testing.T) {
+	var policy *HostPolicy
+	require.NoError(t, policy.Check("anything.example.com"))
+}
+
+func TestDynamicHandler_ValidateURLAppliesHostPolicy(t *testing.T) {
+	h := setupTestHandler()
+	h.Resolver = stubResolver{addrs: []string{"93.184.216.34"}}
+	h.HostPolicy = NewHostPolicy([]string{"*.example.com"}, []string{"blocked.example.com"})
+
+	require.NoError(t, h.validateURL("https://api.example.com/data"))
+	require.ErrorContains(t, h.validateURL("https://other.org/"), "not allowed by the host policy")
+	require.ErrorContains(t, h.validateURL("https://blocked.example.com/"), "denied by the host policy")
+}
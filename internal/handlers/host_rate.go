@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// hostRateSweepInterval is how often limiters that refilled to their burst are dropped
+const hostRateSweepInterval = time.Minute
+
+// hostRates keeps one rate limiter per upstream host, created on first use. Unlike the
+// per-batch host limit, the rate is shared by every request fetching from the host.
+type hostRates struct {
+	mu        sync.Mutex
+	limiters  map[string]*rate.Limiter
+	lastSweep time.Time
+}
+
+// sweep drops the limiters that refilled to their burst. Such a limiter allows exactly what
+// a new one would, so forgetting it changes nothing, and hosts fetched once do not pile up.
+// Limiters with a waiter are never full.
+func (r *hostRates) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < hostRateSweepInterval {
+		return
+	}
+	r.lastSweep = now
+	for host, limiter := range r.limiters {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(r.limiters, host)
+		}
+	}
+}
+
+// hostRateLimiter returns the rate limiter of host, or nil when per-host rate limiting is disabled
+func (h *DynamicHandler) hostRateLimiter(host string) *rate.Limiter {
+	if h.FetchRatePerHost <= 0 || host == "" {
+		return nil
+	}
+	h.hostRates.mu.Lock()
+	defer h.hostRates.mu.Unlock()
+	h.hostRates.sweep(time.Now())
+	if limiter, ok := h.hostRates.limiters[host]; ok {
+		return limiter
+	}
+	if h.hostRates.limiters == nil {
+		h.hostRates.limiters = make(map[string]*rate.Limiter)
+	}
+	burst := h.FetchBurstPerHost
+	if burst <= 0 {
+		burst = 1
+	}
+	limiter := rate.NewLimiter(rate.Limit(h.FetchRatePerHost), burst)
+	h.hostRates.limiters[host] = limiter
+	return limiter
+}
+
+// waitHostRate blocks until host may be sent another request, or ctx is done
+func (h *DynamicHandler) waitHostRate(ctx context.Context, host string) error {
+	limiter := h.hostRateLimiter(host)
+	if limiter == nil {
+		return nil
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("waiting for the request rate of host %s: %w", host, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestDynamicHandler_FetchRateWaitHoldsNoFetchSlot(t *testing.T) {
+	server, calls := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.MaxGlobalFetches = 1
+	h.MaxConcurrentFetches = 1
+	h.FetchRatePerHost = 1
+
+	done := make(chan []fetchOutcome)
+	go func() {
+		done <- h.fetchAll(context.Background(), []db_model.URLRecord{{URL: server.URL + "/a"}, {URL: server.URL + "/b"}}, fetchOptions{})
+	}()
+
+	// The second fetch waits about a second for its host's token, without the only fetch slot
+	require.Eventually(t, func() bool { return atomic.LoadInt32(calls) == 1 }, time.Second, time.Millisecond)
+	slots := h.fetchSlotsFor()
+	require.Eventually(t, func() bool {
+		if !slots.tryAcquire() {
+			return false
+		}
+		slots.release()
+		return true
+	}, 500*time.Millisecond, 5*time.Millisecond, "a fetch waiting for its host's rate must not hold a global slot")
+
+	for _, outcome := range <-done {
+		require.NotContains(t, outcome.result, "error")
+	}
+}
+
+func TestDynamicHandler_OpenBreakerSpendsNoRateToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.HostBreakers = HostBreakerSettings{FailureThreshold: 1, MaxRequests: 1, Timeout: time.Minute}
+	h.FetchRatePerHost = 0.001
+
+	// The failure opens the breaker and uses up the host's only token for a long while
+	h.fetchURL(context.Background(), outboundRequest{URL: server.URL})
+
+	start := time.Now()
+	result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Contains(t, result["error"], "circuit breaker")
+	require.Less(t, time.Since(start), 500*time.Millisecond, "a fetch the breaker refuses must not wait for the host's rate")
+}
+
+func TestHostRates_SweepDropsFullLimiters(t *testing.T) {
+	now := time.Now()
+	busy := rate.NewLimiter(rate.Limit(0.001), 1)
+	require.True(t, busy.AllowN(now, 1))
+	rates := hostRates{limiters: map[string]*rate.Limiter{
+		"idle.example": rate.NewLimiter(rate.Limit(1), 1),
+		"busy.example": busy,
+	}, lastSweep: now}
+
+	rates.sweep(now.Add(time.Second))
+	require.Len(t, rates.limiters, 2, "sweeps run at most once per interval")
+
+	rates.sweep(now.Add(hostRateSweepInterval))
+	require.NotContains(t, rates.limiters, "idle.example", "a limiter refilled to its burst is dropped")
+	require.Contains(t, rates.limiters, "busy.example")
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// extractHTMLMeta adds the title and meta description of an HTML result's text content as
+// its "title" and "description". The content itself is left as it is.
+func extractHTMLMeta(result map[string]interface{}) {
+	if result["content_type"] != "text/html" || result["content_encoding"] == "base64" {
+		return
+	}
+	content, ok := result["content"].(string)
+	if !ok {
+		return
+	}
+	title, description := htmlMeta(content)
+	if title != "" {
+		result["title"] = title
+	}
+	if description != "" {
+		result["description"] = description
+	}
+}
+
+// htmlMeta returns the first <title> text and <meta name="description"> content of an HTML
+// document, with runs of whitespace collapsed
+func htmlMeta(content string) (title, description string) {
+	title, description = scanHTMLMeta(content)
+	return strings.Join(strings.Fields(title), " "), strings.Join(strings.Fields(description), " ")
+}
+
+// scanHTMLMeta tokenizes the head of an HTML document for its title and description.
+// Tokenizing stops at the body, where neither belongs.
+func scanHTMLMeta(content string) (title, description string) {
+	z := html.NewTokenizer(strings.NewReader(content))
+	inTitle, seenTitle, seenDescription := false, false, false
+	for !seenTitle || !seenDescription {
+		switch z.Next() {
+		case html.ErrorToken:
+			return title, description
+		case html.TextToken:
+			if inTitle {
+				title += string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				if inTitle {
+					inTitle, seenTitle = false, true
+				}
+			case atom.Head:
+				return title, description
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = !seenTitle
+			case atom.Meta:
+				if seenDescription || !hasAttr {
+					continue
+				}
+				description, seenDescription = metaDescription(z)
+			case atom.Body:
+				return title, description
+			}
+		}
+	}
+	return title, description
+}
+
+// metaDescription returns the content of the meta tag z is on if it is named description
+func metaDescription(z *html.Tokenizer) (string, bool) {
+	var isDescription bool
+	var content string
+	for {
+		key, value, more := z.TagAttr()
+		switch string(key) {
+		case "name":
+			isDescription = strings.EqualFold(strings.TrimSpace(string(value)), "description")
+		case "content":
+			content = string(value)
+		}
+		if !more {
+			if !isDescription {
+				return "", false
+			}
+			return content, true
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_ExtractMeta(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<!DOCTYPE html><html><head>
+<meta charset="utf-8">
+<meta name="keywords" content="not this">
+<title>
+  Widgets &amp; Gadgets
+</title>
+<META NAME="Description" CONTENT="Everything about   widgets.">
+</head><body><title>Not the title</title></body></html>`))
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("<title>Plain text</title>"))
+		}
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/meta-test", []string{mockServer.URL + "/page", mockServer.URL + "/plain"})
+
+	results := fetchResults(t, r, "/meta-test?extract=meta")
+	require.Len(t, results, 2)
+	require.Equal(t, "Widgets & Gadgets", results[0]["title"])
+	require.Equal(t, "Everything about widgets.", results[0]["description"])
+	require.Contains(t, results[0]["content"], "<title>", "the raw content is still returned")
+	require.NotContains(t, results[1], "title", "only HTML results are parsed")
+
+	results = fetchResults(t, r, "/meta-test")
+	require.NotContains(t, results[0], "title", "extraction is opt-in")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/meta-test?extract=links", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHTMLMeta(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		title       string
+		description string
+	}{
+		{name: "missing", content: `<html><head></head><body>hi</body></html>`},
+		{name: "no head", content: `<title>Bare</title><p>text`, title: "Bare"},
+		{name: "self-closing meta", content: `<meta name="description" content="Short" /><title>T</title>`, title: "T", description: "Short"},
+		{name: "first wins", content: `<title>One</title><title>Two</title><meta name="description" content="a"><meta name="description" content="b">`, title: "One", description: "a"},
+		{name: "unclosed title", content: `<title>  Never   closed`, title: "Never closed"},
+		{name: "body ends the head", content: `<body><title>Late</title></body>`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			title, description := htmlMeta(tc.content)
+			require.Equal(t, tc.title, title)
+			require.Equal(t, tc.description, description)
+		})
+	}
+}
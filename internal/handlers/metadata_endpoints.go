@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net"
+	"strings"
+)
+
+// DefaultMetadataEndpoints are the cloud instance metadata services fetches may never reach:
+// the AWS, GCP and Azure IPv4 address, the AWS IPv6 address, GCP's host names and Alibaba's address
+var DefaultMetadataEndpoints = []string{
+	"169.254.169.254",
+	"fd00:ec2::254",
+	"metadata.google.internal",
+	"metadata.goog",
+	"100.100.100.200",
+}
+
+// isMetadataEndpoint reports whether host, a host name or IP literal, is one of MetadataEndpoints
+func (h *DynamicHandler) isMetadataEndpoint(host string) bool {
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	ip := net.ParseIP(host)
+	for _, endpoint := range h.MetadataEndpoints {
+		if ip != nil {
+			if endpointIP := net.ParseIP(endpoint); endpointIP != nil && endpointIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(host, strings.TrimSuffix(endpoint, ".")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import "net/http"
+
+// Statuses of a single result, set on each result of a multi-status response
+const (
+	resultSucceeded = "succeeded"
+	resultFailed    = "failed"
+	resultSkipped   = "skipped"
+)
+
+// Overall outcomes of a multi-status response
+const (
+	outcomeComplete = "complete"
+	outcomePartial  = "partial"
+	outcomeFailed   = "failed"
+)
+
+// resultStatus tells a result fetched without an error from one with an error and one
+// skipped without a fetch
+func resultStatus(result map[string]interface{}) string {
+	switch {
+	case result["error"] != nil:
+		return resultFailed
+	case result["skipped"] != nil:
+		return resultSkipped
+	default:
+		return resultSucceeded
+	}
+}
+
+// markMultiStatus sets the status of every result and returns the overall outcome with the
+// HTTP status answering it: 200 when every URL succeeded, 502 when every URL failed and
+// 207 Multi-Status for anything in between.
+func markMultiStatus(results []map[string]interface{}) (string, int) {
+	counts := make(map[string]int, 3)
+	for _, result := range results {
+		status := resultStatus(result)
+		result["status"] = status
+		counts[status]++
+	}
+	switch {
+	case counts[resultSucceeded] == len(results):
+		return outcomeComplete, http.StatusOK
+	case counts[resultFailed] == len(results):
+		return outcomeFailed, http.StatusBadGateway
+	default:
+		return outcomePartial, http.StatusMultiStatus
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_MultiStatus(t *testing.T) {
+	server, _ := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	// The unreachable URLs pass storage validation but cannot be fetched
+	storeURLs(t, r, "/multi-mixed", []string{server.URL + "/good", "http://unreachable.invalid/", server.URL + "/also-good"})
+	storeURLs(t, r, "/multi-good", []string{server.URL + "/a", server.URL + "/b"})
+	storeURLs(t, r, "/multi-failed", []string{"http://unreachable.invalid/a", "http://unreachable.invalid/b"})
+
+	testCases := []struct {
+		path     string
+		status   int
+		outcome  string
+		statuses []string
+	}{
+		{path: "/multi-mixed", status: http.StatusMultiStatus, outcome: outcomePartial,
+			statuses: []string{resultSucceeded, resultFailed, resultSucceeded}},
+		{path: "/multi-good", status: http.StatusOK, outcome: outcomeComplete,
+			statuses: []string{resultSucceeded, resultSucceeded}},
+		{path: "/multi-failed", status: http.StatusBadGateway, outcome: outcomeFailed,
+			statuses: []string{resultFailed, resultFailed}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path+"?multi_status=true", nil))
+			require.Equal(t, tc.status, w.Code)
+
+			var resp struct {
+				Outcome string                   `json:"outcome"`
+				Results []map[string]interface{} `json:"results"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Equal(t, tc.outcome, resp.Outcome)
+			require.Len(t, resp.Results, len(tc.statuses))
+			for i, result := range resp.Results {
+				require.Equal(t, tc.statuses[i], result["status"], result["url"])
+			}
+		})
+	}
+
+	// Without the option mixed outcomes keep answering 200 with no statuses
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/multi-mixed", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotContains(t, w.Body.String(), `"outcome"`)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/multi-mixed?multi_status=maybe", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestMarkMultiStatus_Skipped(t *testing.T) {
+	results := []map[string]interface{}{
+		{"url": "https://a.example/", "status_code": 404},
+		{"url": "https://b.example/", "skipped": skippedHostByteBudget},
+	}
+	outcome, code := markMultiStatus(results)
+	require.Equal(t, outcomePartial, outcome, "a skipped URL makes the batch partial")
+	require.Equal(t, http.StatusMultiStatus, code)
+	require.Equal(t, resultSucceeded, results[0]["status"], "an upstream error status is still a successful fetch")
+	require.Equal(t, resultSkipped, results[1]["status"])
+
+	outcome, code = markMultiStatus(nil)
+	require.Equal(t, outcomeComplete, outcome)
+	require.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shaibs3/Guardz/internal/render"
+)
+
+// handleListPaths lists every path that has URLs stored, sorted
+func (h *DynamicHandler) handleListPaths(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	paths, err := h.DB.ListPaths(req.Context())
+	if err != nil {
+		render.Error(w, req, "Failed to list paths", http.StatusInternalServerError)
+		return
+	}
+	if paths == nil {
+		paths = []string{}
+	}
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"paths": paths}); err != nil {
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
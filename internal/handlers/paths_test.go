@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_ListPaths(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	listPaths := func() map[string]interface{} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_paths", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	require.Equal(t, map[string]interface{}{"paths": []interface{}{}}, listPaths(), "no paths are stored yet")
+
+	storeURLs(t, r, "/charlie", []string{"https://example.com"})
+	storeURLs(t, r, "/alpha", []string{"https://example.com"})
+	storeURLs(t, r, "/bravo/nested", []string{"https://example.org"})
+
+	// The catch-all would answer with fetched results instead of a path list
+	require.Equal(t, map[string]interface{}{
+		"paths": []interface{}{"alpha", "bravo/nested", "charlie"},
+	}, listPaths())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/bravo/nested", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, []interface{}{"alpha", "charlie"}, listPaths()["paths"], "a path whose URLs were deleted is not listed")
+}
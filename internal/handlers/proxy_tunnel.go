@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// contextDialer dials a network address, such as a *net.Dialer
+type contextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// proxyTunnel dials upstream addresses through OutboundProxy. It is handed the address
+// dialContext already resolved and validated, and asks the proxy for a tunnel to exactly
+// that address, so the proxy never resolves a host name of its own that could rebind to
+// an internal address.
+type proxyTunnel struct {
+	proxy   *url.URL
+	forward *net.Dialer
+}
+
+// DialContext opens a tunnel to addr, an IP address and port, through the proxy
+func (p proxyTunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch p.proxy.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if user := p.proxy.User; user != nil {
+			password, _ := user.Password()
+			auth = &proxy.Auth{User: user.Username(), Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", proxyAddr(p.proxy), auth, p.forward)
+		if err != nil {
+			return nil, err
+		}
+		// An IP address is sent to the proxy as one, with nothing left to resolve
+		return dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	default:
+		return p.connect(ctx, addr)
+	}
+}
+
+// connect asks an http or https proxy for a CONNECT tunnel to addr. Plain http upstreams
+// are tunneled too, a forwarded request would leave the proxy to resolve the host.
+func (p proxyTunnel) connect(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := p.forward.DialContext(ctx, "tcp", proxyAddr(p.proxy))
+	if err != nil {
+		return nil, err
+	}
+	if p.proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.proxy.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	// The fetch deadline also bounds the CONNECT exchange
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := p.proxy.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	// The upstream speaks only once the client has, so nothing past the response is buffered
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy refused tunnel to %s: %s", addr, resp.Status)
+	}
+	return conn, nil
+}
+
+// proxyAddr returns the host and port of a proxy URL, with the scheme's default port
+func proxyAddr(proxyURL *url.URL) string {
+	if port := proxyURL.Port(); port != "" {
+		return proxyURL.Host
+	}
+	port := map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[proxyURL.Scheme]
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// getQueryParams are the query parameters recognized by GET /{path}.
+// New per-request overrides must be added here or they are rejected as unknown.
+var getQueryParams = []string{"all_or_nothing", "extract", "fetch", "method", "multi_status", "resolve_only", "sort", "timings"}
+
+// DefaultMaxQueryOverrides is the most query parameters accepted on a GET by default
+const DefaultMaxQueryOverrides = 100
+
+// checkQueryParamCount enforces MaxQueryOverrides on a raw query string. Every occurrence of a
+// parameter counts, and the query is not parsed, so a flood of parameters is rejected cheaply.
+func (h *DynamicHandler) checkQueryParamCount(rawQuery string) error {
+	if h.MaxQueryOverrides <= 0 {
+		return nil
+	}
+	count := 0
+	for rawQuery != "" {
+		var pair string
+		pair, rawQuery, _ = strings.Cut(rawQuery, "&")
+		if pair != "" {
+			count++
+		}
+	}
+	if count > h.MaxQueryOverrides {
+		return fmt.Errorf("too many query parameters: %d (maximum %d)", count, h.MaxQueryOverrides)
+	}
+	return nil
+}
+
+// validateQueryParams rejects unknown and conflicting query parameters so typos are reported
+// instead of silently ignored
+func (h *DynamicHandler) validateQueryParams(query url.Values, known []string) error {
+	var unknown []string
+	for name, values := range query {
+		if !containsString(known, name) {
+			unknown = append(unknown, name)
+			continue
+		}
+		// The same parameter given twice with different values is ambiguous
+		for _, value := range values[1:] {
+			if value != values[0] {
+				return fmt.Errorf("conflicting values for query parameter %q", name)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown query parameters: %s (valid parameters: %s)", strings.Join(unknown, ", "), strings.Join(known, ", "))
+	}
+	return nil
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
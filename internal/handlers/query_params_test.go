@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_QueryParamValidation(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	testCases := []struct {
+		name         string
+		query        string
+		maxOverrides int
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "no parameters", query: "", expectedCode: http.StatusOK},
+		{name: "known parameters", query: "?sort=url&all_or_nothing=true", expectedCode: http.StatusOK},
+		{name: "repeated with the same value", query: "?sort=url&sort=url", expectedCode: http.StatusOK},
+		{name: "unknown parameter", query: "?sotr=url", expectedCode: http.StatusBadRequest, expectedBody: `unknown query parameters: sotr`},
+		{name: "conflicting values", query: "?sort=url&sort=latency", expectedCode: http.StatusBadRequest, expectedBody: `conflicting values for query parameter \"sort\"`},
+		{name: "within override cap", query: "?sort=url", maxOverrides: 1, expectedCode: http.StatusOK},
+		{name: "over override cap", query: "?sort=url&all_or_nothing=true", maxOverrides: 1, expectedCode: http.StatusBadRequest, expectedBody: "too many query parameters: 2 (maximum 1)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h.MaxQueryOverrides = tc.maxOverrides
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/query-test"+tc.query, nil))
+			require.Equal(t, tc.expectedCode, w.Code)
+			require.Contains(t, w.Body.String(), tc.expectedBody)
+		})
+	}
+}
+
+func TestDynamicHandler_RejectsQueryParamFlood(t *testing.T) {
+	h := setupTestHandler()
+	h.MaxQueryOverrides = 10
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	flood := make([]string, 1000)
+	for i := range flood {
+		flood[i] = fmt.Sprintf("p%d=x", i)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/query-test?"+strings.Join(flood, "&"), nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "too many query parameters: 1000 (maximum 10)")
+
+	// Repeating a known parameter counts every occurrence
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/query-test?"+strings.Repeat("sort=url&", 11), nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/query-test?sort=url&timings=true", nil))
+	require.Equal(t, http.StatusOK, w.Code, "a normal query is within the cap")
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+)
+
+// refererHeaders returns the Referer and Origin sent when fetching rec: its own values,
+// falling back to DefaultReferer and DefaultOrigin. It is nil when there are none.
+func (h *DynamicHandler) refererHeaders(rec db_model.URLRecord) http.Header {
+	referer := rec.Referer
+	if referer == "" {
+		referer = h.DefaultReferer
+	}
+	origin := rec.Origin
+	if origin == "" {
+		origin = h.DefaultOrigin
+	}
+	if referer == "" && origin == "" {
+		return nil
+	}
+
+	header := make(http.Header)
+	if referer != "" {
+		header.Set("Referer", referer)
+	}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	return header
+}
+
+// validateRefererHeaders checks per-URL Referer and Origin overrides. Empty values are allowed.
+func validateRefererHeaders(referer, origin string) error {
+	if referer != "" && !isAbsoluteHTTPURL(referer) {
+		return fmt.Errorf("referer must be an absolute http or https URL")
+	}
+	if origin != "" {
+		parsed, err := url.Parse(origin)
+		if err != nil || !isAbsoluteHTTPURL(origin) || (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+			return fmt.Errorf("origin must be a scheme and host such as https://example.com")
+		}
+	}
+	return nil
+}
+
+// isAbsoluteHTTPURL reports whether s is an absolute http or https URL with a host
+func isAbsoluteHTTPURL(s string) bool {
+	parsed, err := url.Parse(s)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
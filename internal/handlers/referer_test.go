@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_RefererAndOrigin(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.Header.Get("Referer") + " " + r.Header.Get("Origin")))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.DefaultReferer = "https://default.example.com/page"
+	h.DefaultOrigin = "https://default.example.com"
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	body, _ := json.Marshal(map[string]interface{}{"urls": []interface{}{
+		mockServer.URL + "/plain",
+		map[string]interface{}{"url": mockServer.URL + "/override", "referer": "https://site.example.com/", "origin": "https://site.example.com"},
+	}})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/referer-test", bytes.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	results := fetchResults(t, r, "/referer-test")
+	require.Len(t, results, 2)
+	require.Equal(t, "https://default.example.com/page https://default.example.com", results[0]["content"], "the configured defaults are sent")
+	require.Equal(t, "https://site.example.com/ https://site.example.com", results[1]["content"], "per-URL values override the defaults")
+}
+
+func TestDynamicHandler_RefererAndOriginKeepCachedResultsApart(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.Header.Get("Referer") + " " + r.Header.Get("Origin")))
+	}))
+	defer mockServer.Close()
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.ResultCacheTTL = time.Minute
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	// The same URL stored under two paths with different per-URL values
+	for path, site := range map[string]string{"/referer-a": "https://a.example.com", "/referer-b": "https://b.example.com"} {
+		body, _ := json.Marshal(map[string]interface{}{"urls": []interface{}{
+			map[string]interface{}{"url": mockServer.URL + "/page", "referer": site + "/", "origin": site},
+		}})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		require.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	require.Equal(t, "https://a.example.com/ https://a.example.com", fetchResults(t, r, "/referer-a")[0]["content"])
+	results := fetchResults(t, r, "/referer-b")
+	require.Equal(t, "https://b.example.com/ https://b.example.com", results[0]["content"], "a result fetched with another Referer is not served")
+	require.Nil(t, results[0]["cached"])
+	require.Equal(t, true, fetchResults(t, r, "/referer-a")[0]["cached"])
+}
+
+func TestValidateRefererHeaders(t *testing.T) {
+	require.NoError(t, validateRefererHeaders("", ""))
+	require.NoError(t, validateRefererHeaders("https://example.com/page?q=1", "https://example.com"))
+	require.Error(t, validateRefererHeaders("/relative", ""))
+	require.Error(t, validateRefererHeaders("", "https://example.com/path"))
+	require.Error(t, validateRefererHeaders("", "ftp://example.com"))
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/shaibs3/Guardz/internal/render"
+)
+
+// maxRefreshJobs bounds how many refresh jobs are remembered; the oldest are forgotten first
+const maxRefreshJobs = 1000
+
+// DefaultMaxRunningRefreshJobs is how many refresh jobs may run at once
+const DefaultMaxRunningRefreshJobs = 4
+
+// Refresh job states
+const (
+	refreshJobPending = "pending"
+	refreshJobDone    = "done"
+	refreshJobExpired = "expired"
+)
+
+// refreshJob is a background re-fetch of every URL stored for a path
+type refreshJob struct {
+	ID          string                   `json:"id"`
+	Path        string                   `json:"path"`
+	Status      string                   `json:"status"`
+	CreatedAt   time.Time                `json:"created_at"`
+	CompletedAt *time.Time               `json:"completed_at,omitempty"`
+	Results     []map[string]interface{} `json:"results,omitempty"`
+}
+
+// refreshJobs keeps the status of recent refresh jobs
+type refreshJobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*refreshJob
+	order []string
+}
+
+// add registers a new pending job for path, forgetting the oldest job when full and expiring
+// the jobs completed more than ttl before now. It returns a snapshot since the job is updated
+// concurrently once started.
+func (r *refreshJobs) add(path string, now time.Time, ttl time.Duration) (refreshJob, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return refreshJob{}, err
+	}
+	job := &refreshJob{
+		ID:        hex.EncodeToString(id),
+		Path:      path,
+		Status:    refreshJobPending,
+		CreatedAt: now.UTC(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(now, ttl)
+	if r.jobs == nil {
+		r.jobs = make(map[string]*refreshJob)
+	}
+	r.jobs[job.ID] = job
+	r.order = append(r.order, job.ID)
+	if len(r.order) > maxRefreshJobs {
+		delete(r.jobs, r.order[0])
+		r.order = r.order[1:]
+	}
+	return *job, nil
+}
+
+// complete records the results of a finished job
+func (r *refreshJobs) complete(id string, results []map[string]interface{}, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return
+	}
+	completedAt := now.UTC()
+	job.Status = refreshJobDone
+	job.CompletedAt = &completedAt
+	job.Results = results
+}
+
+// forget drops the job with id, used when it could not be started
+func (r *refreshJobs) forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.jobs, id)
+	for i, jobID := range r.order {
+		if jobID == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// get returns a snapshot of the job with id, first expiring the jobs completed more than
+// ttl before now
+func (r *refreshJobs) get(id string, now time.Time, ttl time.Duration) (refreshJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(now, ttl)
+	job, ok := r.jobs[id]
+	if !ok {
+		return refreshJob{}, false
+	}
+	return *job, true
+}
+
+// expire drops the results of every job completed more than ttl before now. The jobs are
+// kept as expired, so their ids are told apart from unknown ones until they are forgotten.
+// A ttl of zero keeps results forever. The caller holds r.mu.
+func (r *refreshJobs) expire(now time.Time, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	for _, job := range r.jobs {
+		if job.Status == refreshJobDone && now.Sub(*job.CompletedAt) >= ttl {
+			job.Status = refreshJobExpired
+			job.Results = nil
+		}
+	}
+}
+
+// handlePostRefresh starts re-fetching every URL stored for a path in the background.
+// It answers 202 with a Location header pointing at the job status endpoint.
+func (h *DynamicHandler) handlePostRefresh(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	path := mux.Vars(req)["path"]
+	if path == "" {
+		path = "/"
+	}
+
+	urls, err := h.DB.GetURLsByPath(req.Context(), path)
+	if err != nil {
+		render.Error(w, req, "Failed to fetch records", http.StatusInternalServerError)
+		return
+	}
+	if len(urls) == 0 {
+		render.Error(w, req, "No URLs stored for path", http.StatusNotFound)
+		return
+	}
+
+	release, ok := h.acquireRefreshSlot()
+	if !ok {
+		render.Error(w, req, "too many refresh jobs running", http.StatusServiceUnavailable)
+		return
+	}
+	job, err := h.refreshJobs.add(path, h.clock(), h.JobTTL)
+	if err != nil {
+		release()
+		render.Error(w, req, "Failed to create refresh job", http.StatusInternalServerError)
+		return
+	}
+	// The job outlives the request that started it, so it runs on the handler's background
+	// context and only the allowlist profile of the request is carried over
+	profile := allowlistProfileFrom(req.Context())
+	started := h.background.start(func(ctx context.Context) {
+		defer release()
+		h.runRefresh(withAllowlistProfile(ctx, profile), job.ID, path, urls)
+	})
+	if !started {
+		release()
+		h.refreshJobs.forget(job.ID)
+		render.Error(w, req, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	location := "/_jobs/" + job.ID
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusAccepted)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       job.ID,
+		"path":     path,
+		"status":   job.Status,
+		"location": location,
+	})
+	if err != nil {
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// acquireRefreshSlot takes a slot for a refresh job without waiting. It returns false when
+// MaxRunningRefreshJobs jobs are already running, otherwise the function releasing the slot.
+func (h *DynamicHandler) acquireRefreshSlot() (func(), bool) {
+	h.refreshSlotsOnce.Do(func() {
+		if h.MaxRunningRefreshJobs > 0 {
+			h.refreshSlots = make(chan struct{}, h.MaxRunningRefreshJobs)
+		}
+	})
+	if h.refreshSlots == nil {
+		return func() {}, true
+	}
+	select {
+	case h.refreshSlots <- struct{}{}:
+		return func() { <-h.refreshSlots }, true
+	default:
+		return nil, false
+	}
+}
+
+// runRefresh fetches the URLs of a refresh job and records the results
+func (h *DynamicHandler) runRefresh(ctx context.Context, id, path string, urls []db_model.URLRecord) {
+	opts := fetchOptions{refresh: true}
+	if h.PersistFetchResults {
+		opts.persistPath = path
+	}
+	outcomes := h.fetchAll(ctx, urls, opts)
+	results := make([]map[string]interface{}, len(outcomes))
+	for i, outcome := range outcomes {
+		results[i] = outcome.result
+	}
+	h.refreshJobs.complete(id, results, h.clock())
+}
+
+// handleGetJob reports the status of a refresh job, including its results once done.
+// Jobs whose results outlived JobTTL answer 410.
+func (h *DynamicHandler) handleGetJob(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	job, ok := h.refreshJobs.get(mux.Vars(req)["id"], h.clock(), h.JobTTL)
+	if !ok {
+		render.Error(w, req, "Job not found", http.StatusNotFound)
+		return
+	}
+	if job.Status == refreshJobExpired {
+		render.Error(w, req, "Job expired", http.StatusGone)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		render.Error(w, req, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_AsyncRefresh(t *testing.T) {
+	var calls int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("refreshed"))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/refresh-me", []string{mockServer.URL})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_refresh/refresh-me", nil))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	location := w.Header().Get("Location")
+	require.Regexp(t, `^/_jobs/[0-9a-f]{32}$`, location)
+
+	var job refreshJob
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+		require.Equal(t, http.StatusOK, w.Code, "Location should resolve to the job status")
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+		return job.Status == refreshJobDone
+	}, 2*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, "refresh-me", job.Path)
+	require.NotNil(t, job.CompletedAt)
+	require.Len(t, job.Results, 1)
+	require.Equal(t, "refreshed", job.Results[0]["content"])
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDynamicHandler_AsyncRefreshNotFound(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_refresh/nothing-here", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_jobs/unknown", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDynamicHandler_AsyncRefreshExpires(t *testing.T) {
+	server, _ := countingServer(t)
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	// The job completes on its own goroutine, so the fake clock is advanced atomically
+	start := time.Now()
+	var elapsed atomic.Int64
+	h := setupTestHandler()
+	h.now = func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+	h.JobTTL = time.Minute
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/expire-me", []string{server.URL})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_refresh/expire-me", nil))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	location := w.Header().Get("Location")
+
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+		var job refreshJob
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+		return job.Status == refreshJobDone
+	}, 2*time.Second, 10*time.Millisecond)
+
+	elapsed.Store(int64(59 * time.Second))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+	require.Equal(t, http.StatusOK, w.Code, "results are kept until the TTL passes")
+
+	elapsed.Store(int64(time.Minute))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+	require.Equal(t, http.StatusGone, w.Code)
+
+	// Unknown jobs are still not found
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/_jobs/unknown", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDynamicHandler_AsyncRefreshLimitAndClose(t *testing.T) {
+	// The upstream holds every fetch until the client gives up on it
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+
+	cleanup := allowlistTestServer(t, hanging.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.MaxRunningRefreshJobs = 1
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/hang", []string{hanging.URL})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_refresh/hang", nil))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	location := w.Header().Get("Location")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_refresh/hang", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code, "a second job should be shed while the first runs")
+
+	// Close cancels the running job and waits for it to record its results
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, h.Close(ctx))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+	var job refreshJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	require.Equal(t, refreshJobDone, job.Status)
+	require.Len(t, job.Results, 1)
+	require.NotEmpty(t, job.Results[0]["error"])
+
+	// The slot is free again, but no job starts once the handler is closed
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/_refresh/hang", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+)
+
+// hashedURL is the part of a stored URL that makes up a request hash
+type hashedURL struct {
+	URL       string            `json:"url"`
+	TimeoutMs int               `json:"timeout_ms"`
+	Referer   string            `json:"referer"`
+	Origin    string            `json:"origin"`
+	Headers   map[string]string `json:"headers"`
+}
+
+// requestHash returns a hex SHA-256 of path and the set of URLs stored for it. The URLs are
+// sorted and repeats dropped first, so POSTs storing the same URLs in any order hash equal.
+func requestHash(path string, records []db_model.URLRecord) string {
+	// Each URL is compared by its encoding, which sorts header names
+	urls := make([]string, 0, len(records))
+	for _, rec := range records {
+		encoded, _ := json.Marshal(hashedURL{
+			URL:       rec.URL,
+			TimeoutMs: rec.TimeoutMs,
+			Referer:   rec.Referer,
+			Origin:    rec.Origin,
+			Headers:   rec.Headers,
+		})
+		urls = append(urls, string(encoded))
+	}
+	sort.Strings(urls)
+	unique := urls[:0]
+	for i, u := range urls {
+		if i == 0 || u != urls[i-1] {
+			unique = append(unique, u)
+		}
+	}
+
+	// Encoding cannot fail on strings
+	normalized, _ := json.Marshal(struct {
+		Path string   `json:"path"`
+		URLs []string `json:"urls"`
+	}{Path: path, URLs: unique})
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// postRequestHash POSTs body to path and returns the request hash of the response
+func postRequestHash(t *testing.T, r *mux.Router, path, body string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	hash, _ := resp["request_hash"].(string)
+	require.Regexp(t, `^[0-9a-f]{64}$`, hash)
+	return hash
+}
+
+func TestDynamicHandler_RequestHash(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	first := postRequestHash(t, r, "/hash-test", `{"urls": ["https://example.com/a", "https://example.com/b"]}`)
+	reordered := postRequestHash(t, r, "/hash-test", `{"urls": ["https://example.com/b", "https://example.com/a"]}`)
+	require.Equal(t, first, reordered, "equivalent POSTs should hash equal whatever the URL order")
+
+	require.NotEqual(t, first, postRequestHash(t, r, "/other-path", `{"urls": ["https://example.com/a", "https://example.com/b"]}`))
+	require.NotEqual(t, first, postRequestHash(t, r, "/hash-test", `{"urls": ["https://example.com/a"]}`))
+	require.NotEqual(t, first, postRequestHash(t, r, "/hash-test",
+		`{"urls": ["https://example.com/a", {"url": "https://example.com/b", "timeout_ms": 500}]}`),
+		"per-URL settings are part of the request")
+	require.NotEqual(t, first, postRequestHash(t, r, "/hash-test",
+		`{"urls": ["https://example.com/a", {"url": "https://example.com/b", "headers": {"X-Foo": "bar"}}]}`),
+		"per-URL headers are part of the request")
+}
+
+func TestRequestHash_IgnoresRepeats(t *testing.T) {
+	once := requestHash("p", db_model.RecordsFromURLs([]string{"https://a.example/", "https://b.example/"}))
+	twice := requestHash("p", db_model.RecordsFromURLs([]string{"https://b.example/", "https://a.example/", "https://b.example/"}))
+	require.Equal(t, once, twice)
+}
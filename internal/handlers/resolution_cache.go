@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// resolutionCacheKey carries a per-request resolution cache on a context
+type resolutionCacheKey struct{}
+
+// resolution is the outcome of one host lookup
+type resolution struct {
+	addrs []net.IPAddr
+	err   error
+}
+
+// resolutionCache remembers host lookups for the lifetime of one fetch, so the redirect
+// validator and the dialer do not resolve the same host again on every hop
+type resolutionCache struct {
+	resolver HostResolver
+	// limit bounds the hosts remembered; lookups beyond it are still answered, just not cached
+	limit   int
+	mu      sync.Mutex
+	entries map[string]resolution
+}
+
+// withResolutionCache returns a context carrying a new resolution cache backed by resolver,
+// remembering at most limit hosts
+func withResolutionCache(ctx context.Context, resolver HostResolver, limit int) context.Context {
+	return context.WithValue(ctx, resolutionCacheKey{}, &resolutionCache{
+		resolver: resolver,
+		limit:    limit,
+		entries:  make(map[string]resolution),
+	})
+}
+
+// resolutionCacheFrom returns the resolution cache on ctx, or nil if there is none
+func resolutionCacheFrom(ctx context.Context) *resolutionCache {
+	cache, _ := ctx.Value(resolutionCacheKey{}).(*resolutionCache)
+	return cache
+}
+
+// lookup resolves host, answering repeated lookups from the cache
+func (c *resolutionCache) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	c.mu.Lock()
+	cached, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok {
+		return cached.addrs, cached.err
+	}
+
+	addrs, err := c.resolver.LookupIPAddr(ctx, host)
+	c.mu.Lock()
+	if len(c.entries) < c.limit {
+		c.entries[host] = resolution{addrs: addrs, err: err}
+	}
+	c.mu.Unlock()
+	return addrs, err
+}
+
+// resolutionCacheLimit bounds a fetch's resolution cache: the original host plus one per
+// redirect MaxRedirects allows
+func (h *DynamicHandler) resolutionCacheLimit() int {
+	return max(h.MaxRedirects+1, 1)
+}
+
+// hostResolver returns the configured resolver, falling back to net.DefaultResolver
+func (h *DynamicHandler) hostResolver() HostResolver {
+	if h.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return h.Resolver
+}
+
+// lookupHost resolves host through the request's resolution cache when ctx carries one
+func (h *DynamicHandler) lookupHost(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if cache := resolutionCacheFrom(ctx); cache != nil {
+		return cache.lookup(ctx, host)
+	}
+	return h.hostResolver().LookupIPAddr(ctx, host)
+}
+
+// dialContext dials upstream connections, resolving host names through the request's
+// resolution cache so the addresses dialed are the ones the validator already saw.
+// Every address is checked again right before it is dialed, so a host whose DNS answer
+// changed since validation (DNS rebinding) still cannot reach a metadata endpoint, nor an
+// address the SSRF policy's ValidateDial refuses.
+func (h *DynamicHandler) dialContext(dialer contextDialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		dialPolicy, _ := h.ssrfPolicy().(DialSSRFPolicy)
+
+		var addrs []net.IPAddr
+		if ip := net.ParseIP(host); ip != nil {
+			addrs = []net.IPAddr{{IP: ip}}
+		} else if addrs, err = h.lookupHost(ctx, host); err != nil {
+			return nil, err
+		}
+		dialErr := fmt.Errorf("no addresses found for host %s", host)
+		for _, ipAddr := range addrs {
+			if h.isMetadataEndpoint(ipAddr.IP.String()) {
+				dialErr = fmt.Errorf("dialing cloud metadata endpoint %s of host %s is not allowed", ipAddr.IP, host)
+				continue
+			}
+			if dialPolicy != nil {
+				if err := dialPolicy.ValidateDial(ctx, host, ipAddr.IP); err != nil {
+					dialErr = err
+					continue
+				}
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ipAddr.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = err
+		}
+		return nil, dialErr
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingResolver resolves every host to the loopback address and counts lookups per host
+type countingResolver struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *countingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[host]++
+	return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+}
+
+func TestDynamicHandler_ResolvesEachHostOncePerRequest(t *testing.T) {
+	var port string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "http://one.test:"+port+"/again", http.StatusFound)
+		case "/again":
+			http.Redirect(w, r, "http://two.test:"+port+"/end", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("done"))
+		}
+	}))
+	// Every hop dials a new connection, so the dialer resolves on each one
+	server.Config.SetKeepAlivesEnabled(false)
+	server.Start()
+	defer server.Close()
+	parsed, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port = parsed.Port()
+
+	_ = os.Setenv("GUARDZ_TEST_ALLOWLIST", "one.test,two.test")
+	defer func() { _ = os.Unsetenv("GUARDZ_TEST_ALLOWLIST") }()
+
+	resolver := &countingResolver{calls: make(map[string]int)}
+	h := setupTestHandler()
+	h.Resolver = resolver
+
+	result := h.fetchURL(context.Background(), outboundRequest{URL: "http://one.test:" + port + "/start"})
+	require.Nil(t, result["error"])
+	require.Equal(t, "done", result["content"])
+	require.Equal(t, map[string]int{"one.test": 1, "two.test": 1}, resolver.calls)
+}
+
+func TestDynamicHandler_ResolutionCacheCoversMaxRedirects(t *testing.T) {
+	// Every host redirects to itself once before moving on, so each is dialed twice
+	const lastHost = 12
+	var port string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hop, again := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/hop/"), "/again")
+		n, _ := strconv.Atoi(hop)
+		switch {
+		case !again:
+			http.Redirect(w, r, "http://h"+hop+".test:"+port+"/hop/"+hop+"/again", http.StatusFound)
+		case n < lastHost:
+			next := strconv.Itoa(n + 1)
+			http.Redirect(w, r, "http://h"+next+".test:"+port+"/hop/"+next, http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("done"))
+		}
+	}))
+	server.Config.SetKeepAlivesEnabled(false)
+	server.Start()
+	defer server.Close()
+	parsed, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port = parsed.Port()
+
+	var hosts []string
+	want := make(map[string]int)
+	for i := 0; i <= lastHost; i++ {
+		host := "h" + strconv.Itoa(i) + ".test"
+		hosts = append(hosts, host)
+		want[host] = 1
+	}
+	_ = os.Setenv("GUARDZ_TEST_ALLOWLIST", strings.Join(hosts, ","))
+	defer func() { _ = os.Unsetenv("GUARDZ_TEST_ALLOWLIST") }()
+
+	resolver := &countingResolver{calls: make(map[string]int)}
+	h := setupTestHandler()
+	h.Resolver = resolver
+	h.MaxRedirects = 30
+
+	// More hosts than DefaultMaxRedirects covers are still resolved once each
+	result := h.fetchURL(context.Background(), outboundRequest{URL: "http://h0.test:" + port + "/hop/0"})
+	require.Nil(t, result["error"])
+	require.Equal(t, "done", result["content"])
+	require.Equal(t, want, resolver.calls)
+}
+
+func TestDynamicHandler_ResolutionCacheLimit(t *testing.T) {
+	for maxRedirects, want := range map[int]int{DefaultMaxRedirects: 11, 20: 21, 1: 2, 0: 1, -1: 1} {
+		h := &DynamicHandler{MaxRedirects: maxRedirects}
+		require.Equal(t, want, h.resolutionCacheLimit(), "MaxRedirects %d", maxRedirects)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"sort"
+)
+
+// validSortKeys are the accepted values of the sort query parameter
+var validSortKeys = []string{"status_code", "url", "latency"}
+
+// isValidSortKey reports whether key is a supported sort key
+func isValidSortKey(key string) bool {
+	for _, valid := range validSortKeys {
+		if key == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// sortOutcomes orders outcomes by the given key, keeping storage order for ties
+func sortOutcomes(outcomes []fetchOutcome, key string) {
+	var less func(a, b fetchOutcome) bool
+	switch key {
+	case "status_code":
+		// Failed fetches have no status code and sort last
+		less = func(a, b fetchOutcome) bool {
+			aStatus, aOK := a.result["status_code"].(int)
+			bStatus, bOK := b.result["status_code"].(int)
+			if aOK != bOK {
+				return aOK
+			}
+			return aStatus < bStatus
+		}
+	case "url":
+		less = func(a, b fetchOutcome) bool {
+			aURL, _ := a.result["url"].(string)
+			bURL, _ := b.result["url"].(string)
+			return aURL < bURL
+		}
+	case "latency":
+		less = func(a, b fetchOutcome) bool {
+			return a.duration < b.duration
+		}
+	default:
+		return
+	}
+	sort.SliceStable(outcomes, func(i, j int) bool {
+		return less(outcomes[i], outcomes[j])
+	})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_SortResults(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.URL.Path {
+		case "/c":
+			time.Sleep(120 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		case "/a":
+			w.WriteHeader(http.StatusNotFound)
+		case "/b":
+			time.Sleep(60 * time.Millisecond)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/sort-test", []string{mockServer.URL + "/c", mockServer.URL + "/a", mockServer.URL + "/b"})
+
+	urlOrder := func(results []map[string]interface{}) []string {
+		var order []string
+		for _, result := range results {
+			order = append(order, result["url"].(string)[len(mockServer.URL):])
+		}
+		return order
+	}
+
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{query: "", expected: []string{"/c", "/a", "/b"}},
+		{query: "?sort=url", expected: []string{"/a", "/b", "/c"}},
+		{query: "?sort=status_code", expected: []string{"/c", "/a", "/b"}},
+		{query: "?sort=latency", expected: []string{"/a", "/b", "/c"}},
+	}
+	for _, tc := range testCases {
+		t.Run("order"+tc.query, func(t *testing.T) {
+			results := fetchResults(t, r, "/sort-test"+tc.query)
+			require.Equal(t, tc.expected, urlOrder(results))
+		})
+	}
+
+	t.Run("invalid sort key", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sort-test?sort=size", nil))
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), "invalid sort key")
+	})
+}
+
+func TestSortOutcomes_StatusCodeErrorsLast(t *testing.T) {
+	outcomes := []fetchOutcome{
+		{index: 0, result: map[string]interface{}{"url": "x", "error": "boom"}},
+		{index: 1, result: map[string]interface{}{"url": "y", "status_code": 503}},
+		{index: 2, result: map[string]interface{}{"url": "z", "status_code": 200}},
+	}
+	sortOutcomes(outcomes, "status_code")
+	require.Equal(t, []int{2, 1, 0}, []int{outcomes[0].index, outcomes[1].index, outcomes[2].index})
+}
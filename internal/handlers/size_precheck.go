@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// precheckSize HEADs a GET before sending it and, when the reported Content-Length is past a
+// threshold, fills result with metadata only or marks the URL skipped instead of fetching the body.
+// It reports whether the GET should not be sent. Unknown sizes and failed HEADs are fetched fully.
+func (h *DynamicHandler) precheckSize(client *http.Client, req *http.Request, result map[string]interface{}) bool {
+	if h.MetadataOnlyAboveBytes <= 0 && h.SkipFetchAboveBytes <= 0 {
+		return false
+	}
+	if req.Method != http.MethodGet || !h.outboundMethodAllowed(http.MethodHead) {
+		return false
+	}
+
+	headReq := req.Clone(req.Context())
+	headReq.Method = http.MethodHead
+	headReq.Body = nil
+	headReq.ContentLength = 0
+	resp, err := client.Do(headReq)
+	if err != nil {
+		// The GET reports the failure if there is a real one
+		return false
+	}
+	_ = resp.Body.Close()
+	size := resp.ContentLength
+	if resp.StatusCode >= http.StatusBadRequest || size < 0 {
+		return false
+	}
+
+	switch {
+	case h.SkipFetchAboveBytes > 0 && size > h.SkipFetchAboveBytes:
+		result["skipped"] = "size_limit"
+		result["content_length"] = size
+	case h.MetadataOnlyAboveBytes > 0 && size > h.MetadataOnlyAboveBytes:
+		// The HEAD already carries the metadata, there is no need for a GET
+		result["body_omitted"] = "size_threshold"
+		result["content_length"] = size
+		setContentType(result, resp.Header.Get("Content-Type"))
+		result["status_code"] = resp.StatusCode
+		setRedirectInfo(result, req.URL.String(), resp.Request.URL)
+	default:
+		return false
+	}
+	return true
+}
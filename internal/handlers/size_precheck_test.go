@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicHandler_SizePrecheckTiers(t *testing.T) {
+	bodies := map[string]string{
+		"/small":  strings.Repeat("s", 100),
+		"/medium": strings.Repeat("m", 5000),
+		"/large":  strings.Repeat("l", 50000),
+	}
+	var gets int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		// ServeContent sets Content-Length for HEAD as well
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(bodies[r.URL.Path]))
+	}))
+	defer server.Close()
+	cleanup := allowlistTestServer(t, server.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.MetadataOnlyAboveBytes = 1000
+	h.SkipFetchAboveBytes = 10000
+
+	t.Run("below the threshold is fetched fully", func(t *testing.T) {
+		atomic.StoreInt32(&gets, 0)
+		result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL + "/small"})
+		require.Equal(t, bodies["/small"], result["content"])
+		require.NotContains(t, result, "body_omitted")
+		require.Equal(t, int32(1), atomic.LoadInt32(&gets))
+	})
+
+	t.Run("above the threshold returns metadata only", func(t *testing.T) {
+		atomic.StoreInt32(&gets, 0)
+		result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL + "/medium"})
+		require.Equal(t, "size_threshold", result["body_omitted"])
+		require.Equal(t, int64(5000), result["content_length"])
+		require.Equal(t, http.StatusOK, result["status_code"])
+		require.Equal(t, "text/plain", result["content_type"])
+		require.NotContains(t, result, "content")
+		require.Zero(t, atomic.LoadInt32(&gets), "the body must not be fetched")
+	})
+
+	t.Run("above the skip limit is not fetched", func(t *testing.T) {
+		atomic.StoreInt32(&gets, 0)
+		result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL + "/large"})
+		require.Equal(t, "size_limit", result["skipped"])
+		require.Equal(t, int64(50000), result["content_length"])
+		require.NotContains(t, result, "content")
+		require.NotContains(t, result, "error")
+		require.Zero(t, atomic.LoadInt32(&gets))
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// SSRFPolicy decides whether a URL may be fetched. It runs after the URL's length, format and
+// scheme are checked, for stored URLs and for every redirect hop.
+type SSRFPolicy interface {
+	Validate(ctx context.Context, u *url.URL) error
+}
+
+// DialSSRFPolicy is an SSRFPolicy that also vets every address right before it is dialed, so a
+// host whose DNS answer changed after Validate (DNS rebinding) still cannot reach it. Without it
+// the dialer only refuses cloud metadata endpoints.
+type DialSSRFPolicy interface {
+	SSRFPolicy
+	ValidateDial(ctx context.Context, host string, ip net.IP) error
+}
+
+// SSRFPolicyFunc adapts a function to an SSRFPolicy
+type SSRFPolicyFunc func(ctx context.Context, u *url.URL) error
+
+// Validate calls f(ctx, u)
+func (f SSRFPolicyFunc) Validate(ctx context.Context, u *url.URL) error {
+	return f(ctx, u)
+}
+
+// rejectStagePolicy labels rejections by a custom SSRFPolicy
+const rejectStagePolicy = "policy"
+
+// stageError is a rejection by the default policy, labelled with the validation stage it failed
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Unwrap() error { return e.err }
+
+// ssrfPolicy returns SSRFPolicy, or the default policy when none is set
+func (h *DynamicHandler) ssrfPolicy() SSRFPolicy {
+	if h.SSRFPolicy == nil {
+		return h.DefaultSSRFPolicy()
+	}
+	return h.SSRFPolicy
+}
+
+// DefaultSSRFPolicy returns the policy used when SSRFPolicy is not set: it refuses cloud metadata
+// endpoints and hosts denied by HostPolicy, then, unless an allowlist exempts the host, localhost,
+// private IPs and names resolving to private addresses. Custom policies can wrap it to add checks.
+func (h *DynamicHandler) DefaultSSRFPolicy() DialSSRFPolicy {
+	return defaultSSRFPolicy{h: h}
+}
+
+// defaultSSRFPolicy is the built-in SSRF protection, configured by the handler's fields
+type defaultSSRFPolicy struct {
+	h *DynamicHandler
+}
+
+func (p defaultSSRFPolicy) Validate(ctx context.Context, u *url.URL) error {
+	h := p.h
+	// Metadata endpoints are refused even for hosts an allowlist exempts
+	host := u.Hostname()
+	if h.isMetadataEndpoint(host) {
+		return &stageError{rejectStageMetadata, fmt.Errorf("access to cloud metadata endpoint %s is not allowed", host)}
+	}
+	// The host policy applies to exempt hosts too, a denied host is never fetched
+	if err := h.HostPolicy.Check(host); err != nil {
+		return &stageError{rejectStageHostPolicy, err}
+	}
+	if h.hostExempt(ctx, host) {
+		return nil
+	}
+
+	// Check for private/internal IP addresses (SSRF protection)
+	if host == "localhost" || host == "127.0.0.1" || host == "::1" {
+		return &stageError{rejectStagePrivateIP, fmt.Errorf("access to localhost is not allowed")}
+	}
+
+	// Parse IP to check for private ranges
+	if ip := net.ParseIP(host); ip != nil {
+		if isPrivateIP(ip) {
+			return &stageError{rejectStagePrivateIP, fmt.Errorf("access to private IP %s is not allowed", ip)}
+		}
+		return nil
+	}
+
+	if err := h.checkResolvedHost(ctx, host); err != nil {
+		if errors.Is(err, errMetadataEndpoint) {
+			return &stageError{rejectStageMetadata, err}
+		}
+		return &stageError{rejectStageDNS, err}
+	}
+	return nil
+}
+
+func (p defaultSSRFPolicy) ValidateDial(ctx context.Context, host string, ip net.IP) error {
+	if isPrivateIP(ip) && !p.h.hostExempt(ctx, host) {
+		return fmt.Errorf("dialing private address %s of host %s is not allowed", ip, host)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSRFPolicy_CustomPolicyReplacesDefault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	// Only the loopback test server may be fetched, without any allowlist
+	h := setupTestHandler()
+	h.SSRFPolicy = SSRFPolicyFunc(func(ctx context.Context, u *url.URL) error {
+		if u.Hostname() != "127.0.0.1" {
+			return fmt.Errorf("host %s is not allowed", u.Hostname())
+		}
+		return nil
+	})
+
+	result := h.fetchURL(context.Background(), outboundRequest{URL: server.URL})
+	require.Equal(t, "internal", result["content"])
+
+	stage, err := h.checkURL(context.Background(), "https://example.com/")
+	require.EqualError(t, err, "host example.com is not allowed")
+	require.Equal(t, rejectStagePolicy, stage)
+
+	stage, err = h.checkURL(context.Background(), "ftp://127.0.0.1/")
+	require.Error(t, err, "the scheme is checked before the policy")
+	require.Equal(t, rejectStageScheme, stage)
+}
+
+func TestSSRFPolicy_WrapsDefault(t *testing.T) {
+	h := setupTestHandler()
+	h.Resolver = stubResolver{addrs: []string{"93.184.216.34"}}
+	defaults := h.DefaultSSRFPolicy()
+	h.SSRFPolicy = SSRFPolicyFunc(func(ctx context.Context, u *url.URL) error {
+		if u.Hostname() == "blocked.example.com" {
+			return fmt.Errorf("host %s is blocked", u.Hostname())
+		}
+		return defaults.Validate(ctx, u)
+	})
+
+	stage, err := h.checkURL(context.Background(), "https://blocked.example.com/")
+	require.EqualError(t, err, "host blocked.example.com is blocked")
+	require.Equal(t, rejectStagePolicy, stage)
+
+	require.NoError(t, h.validateURL("https://allowed.example.com/"))
+
+	// Rejections by the wrapped default keep their stage
+	stage, err = h.checkURL(context.Background(), "http://10.0.0.1/")
+	require.EqualError(t, err, "access to private IP 10.0.0.1 is not allowed")
+	require.Equal(t, rejectStagePrivateIP, stage)
+	stage, err = h.checkURL(context.Background(), "http://169.254.169.254/")
+	require.Error(t, err)
+	require.Equal(t, rejectStageMetadata, stage)
+}
+
+func TestSSRFPolicy_DialRefusesMetadataWithoutDialPolicy(t *testing.T) {
+	h := setupTestHandler()
+	h.SSRFPolicy = SSRFPolicyFunc(func(ctx context.Context, u *url.URL) error { return nil })
+
+	_, err := h.dialContext(&net.Dialer{})(context.Background(), "tcp", "169.254.169.254:80")
+	require.ErrorContains(t, err, "dialing cloud metadata endpoint 169.254.169.254")
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/shaibs3/Guardz/internal/render"
+)
+
+// storeSlotsFor returns the semaphore bounding concurrent stores, building it on first use.
+// It is nil when MaxConcurrentStores does not limit stores.
+func (h *DynamicHandler) storeSlotsFor() chan struct{} {
+	h.storeSlotsOnce.Do(func() {
+		if h.MaxConcurrentStores > 0 {
+			h.storeSlots = make(chan struct{}, h.MaxConcurrentStores)
+		}
+	})
+	return h.storeSlots
+}
+
+// acquireStoreSlot takes a store slot without waiting. When every slot is taken it writes a 503
+// and returns nil; otherwise it returns the function releasing the slot.
+func (h *DynamicHandler) acquireStoreSlot(w http.ResponseWriter, req *http.Request) func() {
+	slots := h.storeSlotsFor()
+	if slots == nil {
+		return func() {}
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }
+	default:
+		// Shed the write rather than queue it, a flood of stores would only pile up on the database
+		render.Error(w, req, "too many concurrent stores", http.StatusServiceUnavailable)
+		return nil
+	}
+}
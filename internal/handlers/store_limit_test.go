@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/shaibs3/Guardz/internal/lookup"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// blockingStoreProvider holds every store until release is closed, tracking how many run at once
+type blockingStoreProvider struct {
+	*lookup.InMemoryProvider
+	release  chan struct{}
+	inFlight int32
+	peak     int32
+}
+
+func (p *blockingStoreProvider) StoreURLRecordsForPath(ctx context.Context, path string, records []db_model.URLRecord) error {
+	n := atomic.AddInt32(&p.inFlight, 1)
+	defer atomic.AddInt32(&p.inFlight, -1)
+	for {
+		peak := atomic.LoadInt32(&p.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&p.peak, peak, n) {
+			break
+		}
+	}
+	<-p.release
+	return p.InMemoryProvider.StoreURLRecordsForPath(ctx, path, records)
+}
+
+func TestDynamicHandler_MaxConcurrentStores(t *testing.T) {
+	provider := &blockingStoreProvider{InMemoryProvider: lookup.NewInMemoryProvider(), release: make(chan struct{})}
+	h := NewDynamicHandler(provider)
+	h.MaxConcurrentStores = 2
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	const posts = 10
+	codes := make(chan int, posts)
+	var wg sync.WaitGroup
+	for i := 0; i < posts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/store-limit-test", strings.NewReader(`{"urls": ["https://example.com"]}`)))
+			codes <- w.Code
+		}()
+	}
+
+	// Everything past the two held stores is shed straight away
+	rejected := 0
+	for rejected < posts-2 {
+		select {
+		case code := <-codes:
+			require.Equal(t, http.StatusServiceUnavailable, code)
+			rejected++
+		case <-time.After(5 * time.Second):
+			t.Fatal("stores beyond the limit should be rejected without waiting")
+		}
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&provider.inFlight) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	close(provider.release)
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		require.Equal(t, http.StatusCreated, code)
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(&provider.peak), "no more than two stores may run at once")
+}
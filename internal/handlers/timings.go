@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// fetchTimings collects per-phase durations of an upstream fetch through httptrace.
+// Phases repeated across redirects are summed.
+type fetchTimings struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	firstByte    time.Time
+
+	dns     time.Duration
+	connect time.Duration
+	tls     time.Duration
+	sawDNS  bool
+	sawConn bool
+	sawTLS  bool
+}
+
+// newFetchTimings starts timing a fetch
+func newFetchTimings() *fetchTimings {
+	return &fetchTimings{start: time.Now()}
+}
+
+// withTrace returns ctx carrying a client trace that records into t
+func (t *fetchTimings) withTrace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dns += time.Since(t.dnsStart)
+			t.sawDNS = true
+		},
+		ConnectStart: func(network, addr string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.connectStart = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.connect += time.Since(t.connectStart)
+			t.sawConn = true
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tls += time.Since(t.tlsStart)
+			t.sawTLS = true
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = time.Now()
+		},
+	})
+}
+
+// result returns the recorded phases in milliseconds. Phases that did not happen,
+// e.g. DNS for an IP literal or TLS for plain http, are left out.
+func (t *fetchTimings) result() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := map[string]interface{}{
+		"total_ms": durationMs(time.Since(t.start)),
+	}
+	if t.sawDNS {
+		timings["dns_ms"] = durationMs(t.dns)
+	}
+	if t.sawConn {
+		timings["connect_ms"] = durationMs(t.connect)
+	}
+	if t.sawTLS {
+		timings["tls_ms"] = durationMs(t.tls)
+	}
+	if !t.firstByte.IsZero() {
+		timings["ttfb_ms"] = durationMs(t.firstByte.Sub(t.start))
+	}
+	return timings
+}
+
+// durationMs converts d to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_Timings(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+
+	// Address the server by name so the fetch includes a DNS lookup
+	serverURL := strings.Replace(mockServer.URL, "127.0.0.1", "localhost", 1)
+	require.NoError(t, os.Setenv("GUARDZ_TEST_ALLOWLIST", "localhost"))
+	defer func() { _ = os.Unsetenv("GUARDZ_TEST_ALLOWLIST") }()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+	storeURLs(t, r, "/timed", []string{serverURL})
+
+	results := fetchResults(t, r, "/timed")
+	require.Len(t, results, 1)
+	require.NotContains(t, results[0], "timings", "timings are off by default")
+
+	// Drop the pooled connection so the timed fetch dials again
+	h.outboundTransport().CloseIdleConnections()
+	results = fetchResults(t, r, "/timed?timings=true")
+	require.Len(t, results, 1)
+	require.NotContains(t, results[0], "error")
+	timings, ok := results[0]["timings"].(map[string]interface{})
+	require.True(t, ok, "timings should be an object")
+	for _, key := range []string{"dns_ms", "connect_ms", "ttfb_ms", "total_ms"} {
+		value, ok := timings[key].(float64)
+		require.True(t, ok, "%s should be present", key)
+		require.GreaterOrEqual(t, value, float64(0))
+	}
+	require.NotContains(t, timings, "tls_ms", "plain http has no TLS handshake")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/timed?timings=maybe", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
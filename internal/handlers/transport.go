@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultMaxResponseHeaderBytes caps the size of upstream response headers by default
+const DefaultMaxResponseHeaderBytes = 64 << 10 // 64KB
+
+// outboundTransport returns the transport shared by all upstream fetches, building it on first use
+func (h *DynamicHandler) outboundTransport() *http.Transport {
+	h.transportOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if h.MaxResponseHeaderBytes > 0 {
+			// Oversized headers fail the fetch instead of exhausting memory
+			transport.MaxResponseHeaderBytes = h.MaxResponseHeaderBytes
+		}
+		if h.OutboundProxy != nil {
+			// Targets are resolved and checked here even behind the proxy, which is then asked
+			// for a tunnel to the address checked rather than the host name
+			transport.Proxy = nil
+			transport.DialContext = h.dialContext(proxyTunnel{proxy: h.OutboundProxy, forward: h.outboundDialer()})
+		} else {
+			transport.DialContext = h.dialContext(h.outboundDialer())
+		}
+		h.transport = transport
+	})
+	return h.transport
+}
+
+// outboundDialer builds the dialer for upstream connections, binding it to
+// OutboundSourceIP so egress leaves through a specific interface on multi-homed hosts
+func (h *DynamicHandler) outboundDialer() *net.Dialer {
+	// Same settings as http.DefaultTransport's dialer
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if ip := net.ParseIP(h.OutboundSourceIP); ip != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return dialer
+}
+
+// ParseOutboundProxy parses an OutboundProxy URL such as http://proxy.internal:3128 or
+// socks5://proxy.internal:1080. An empty value means no proxy.
+func ParseOutboundProxy(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https, socks5 or socks5h)", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", raw)
+	}
+	return proxyURL, nil
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+)
+
+// maxURLHeaders caps the custom headers stored with a single URL
+const maxURLHeaders = 32
+
+// urlHeaders returns the headers sent when fetching rec: its stored headers, with its Referer
+// and Origin taking precedence. It is nil when there are none.
+func (h *DynamicHandler) urlHeaders(rec db_model.URLRecord) http.Header {
+	header := h.refererHeaders(rec)
+	if len(rec.Headers) == 0 {
+		return header
+	}
+	if header == nil {
+		header = make(http.Header, len(rec.Headers))
+	}
+	for name, value := range rec.Headers {
+		if header.Get(name) == "" {
+			header.Set(name, value)
+		}
+	}
+	return header
+}
+
+// stripStoredHeaders removes from a redirect hop the headers stored with its URL. They often
+// carry credentials for the stored URL's host, and the client only drops Authorization and
+// Cookie by itself when a redirect leaves it. Referer and Origin are kept, browsers send them
+// on along a redirect too.
+func stripStoredHeaders(hop, stored http.Header) {
+	for name := range stored {
+		if name != "Referer" && name != "Origin" {
+			hop.Del(name)
+		}
+	}
+}
+
+// normalizeURLHeaders validates the custom headers posted with a URL and returns them with
+// canonical names. Hop-by-hop headers, Host and the OutboundHeaderDenylist are rejected rather
+// than silently dropped at fetch time.
+func (h *DynamicHandler) normalizeURLHeaders(headers map[string]string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	if len(headers) > maxURLHeaders {
+		return nil, fmt.Errorf("at most %d headers are allowed", maxURLHeaders)
+	}
+	normalized := make(map[string]string, len(headers))
+	// Sorted so the first error reported does not depend on map order
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := headers[name]
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		if !validHeaderValue(value) {
+			return nil, fmt.Errorf("invalid value for header %s", name)
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		if !h.urlHeaderAllowed(canonical) {
+			return nil, fmt.Errorf("header %s is not allowed", canonical)
+		}
+		if _, ok := normalized[canonical]; ok {
+			return nil, fmt.Errorf("header %s is given more than once", canonical)
+		}
+		normalized[canonical] = value
+	}
+	return normalized, nil
+}
+
+// urlHeaderAllowed reports whether a stored URL may carry the header with canonical name
+func (h *DynamicHandler) urlHeaderAllowed(name string) bool {
+	if name == "Host" {
+		return false
+	}
+	for _, denied := range hopByHopHeaders {
+		if name == denied {
+			return false
+		}
+	}
+	for _, denied := range h.OutboundHeaderDenylist {
+		if strings.EqualFold(name, strings.TrimSpace(denied)) {
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderName reports whether name is a non-empty HTTP token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderValue reports whether value holds no control characters other than tab
+func validHeaderValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < ' ' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// headersKey encodes headers as a string that is equal for equal headers, for comparing them
+func headersKey(headers map[string]string) string {
+	if len(headers) == 0 {
+		return ""
+	}
+	// Maps are encoded with sorted keys, and encoding cannot fail on a map of strings
+	encoded, _ := json.Marshal(headers)
+	return string(encoded)
+}
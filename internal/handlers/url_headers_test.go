@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_CustomURLHeaders(t *testing.T) {
+	var mu sync.Mutex
+	observed := make(map[string]http.Header)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		observed[r.URL.Path] = r.Header.Clone()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.OutboundHeaderDenylist = []string{"Cookie"}
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	body := `{"urls": [
+		{"url": "` + mockServer.URL + `/custom", "headers": {"x-foo": "bar", "Authorization": "Bearer secret-token"}},
+		"` + mockServer.URL + `/plain"
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/custom-headers", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	results := fetchResults(t, r, "/custom-headers")
+	require.Len(t, results, 2)
+
+	mu.Lock()
+	custom, plain := observed["/custom"], observed["/plain"]
+	mu.Unlock()
+	require.Equal(t, "bar", custom.Get("X-Foo"))
+	require.Equal(t, "Bearer secret-token", custom.Get("Authorization"))
+	require.Empty(t, plain.Get("X-Foo"), "headers apply only to the URL they were stored with")
+
+	// Neither the fetch results nor the stored URL listing echo the headers
+	for _, path := range []string{"/custom-headers", "/custom-headers?fetch=false"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NotContains(t, w.Body.String(), "secret-token", path)
+		require.NotContains(t, w.Body.String(), "X-Foo", path)
+	}
+}
+
+func TestDynamicHandler_CustomURLHeadersRejected(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	for name, headers := range map[string]string{
+		"denylisted":  `{"Authorization": "Bearer token"}`,
+		"hop-by-hop":  `{"Connection": "close"}`,
+		"host":        `{"host": "other.example"}`,
+		"bad name":    `{"X Foo": "bar"}`,
+		"bad value":   `{"X-Foo": "bar\r\nX-Injected: 1"}`,
+		"duplicate":   `{"X-Foo": "a", "x-foo": "b"}`,
+		"not strings": `{"X-Foo": 1}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			body := `{"urls": [{"url": "https://example.com/", "headers": ` + headers + `}]}`
+			req := httptest.NewRequest(http.MethodPost, "/rejected-headers", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			require.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestDynamicHandler_CustomURLHeadersKeepCachedResultsApart(t *testing.T) {
+	var fetches atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("Authorization") == "Bearer secret-token" {
+			_, _ = w.Write([]byte("private"))
+			return
+		}
+		_, _ = w.Write([]byte("public"))
+	}))
+	defer mockServer.Close()
+
+	cleanup := allowlistTestServer(t, mockServer.URL)
+	defer cleanup()
+
+	h := setupTestHandler()
+	h.OutboundHeaderDenylist = nil
+	h.ResultCacheTTL = time.Minute
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	body := `{"urls": [{"url": "` + mockServer.URL + `/doc", "headers": {"Authorization": "Bearer secret-token"}}]}`
+	req := httptest.NewRequest(http.MethodPost, "/tenant-a", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	storeURLs(t, r, "/tenant-b", []string{mockServer.URL + "/doc"})
+
+	results := fetchResults(t, r, "/tenant-a")
+	require.Equal(t, "private", results[0]["content"])
+
+	results = fetchResults(t, r, "/tenant-b")
+	require.Equal(t, "public", results[0]["content"], "a result fetched with stored credentials is not shared")
+	require.Nil(t, results[0]["cached"])
+	require.Equal(t, int32(2), fetches.Load())
+
+	results = fetchResults(t, r, "/tenant-a")
+	require.Equal(t, "private", results[0]["content"])
+	require.Equal(t, true, results[0]["cached"], "each path still hits its own cached result")
+}
+
+func TestDynamicHandler_CustomURLHeadersNotSentAcrossHosts(t *testing.T) {
+	var mu sync.Mutex
+	observed := make(map[string]http.Header)
+	var mockServer *httptest.Server
+	mockServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		observed[r.Host+r.URL.Path] = r.Header.Clone()
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/same-host":
+			http.Redirect(w, r, "/landing", http.StatusFound)
+		case "/cross-host":
+			// 127.0.0.1 -> localhost is a different host
+			http.Redirect(w, r, strings.Replace(mockServer.URL, "127.0.0.1", "localhost", 1)+"/landing", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer mockServer.Close()
+	require.NoError(t, os.Setenv("GUARDZ_TEST_ALLOWLIST", "127.0.0.1,localhost"))
+	defer func() { _ = os.Unsetenv("GUARDZ_TEST_ALLOWLIST") }()
+
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	body := `{"urls": [
+		{"url": "` + mockServer.URL + `/same-host", "headers": {"X-Api-Key": "k1"}, "referer": "https://ref.example/"},
+		{"url": "` + mockServer.URL + `/cross-host", "headers": {"X-Api-Key": "k2"}, "referer": "https://ref.example/"}
+	]}`
+	req := httptest.NewRequest(http.MethodPost, "/redirect-headers", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, fetchResults(t, r, "/redirect-headers"), 2)
+
+	host := strings.TrimPrefix(mockServer.URL, "http://")
+	mu.Lock()
+	sameHost := observed[host+"/landing"]
+	crossHost := observed[strings.Replace(host, "127.0.0.1", "localhost", 1)+"/landing"]
+	mu.Unlock()
+	require.Equal(t, "k1", sameHost.Get("X-Api-Key"), "a same-host redirect keeps the stored headers")
+	require.NotNil(t, crossHost)
+	require.Empty(t, crossHost.Get("X-Api-Key"), "stored headers do not follow a redirect to another host")
+	require.Equal(t, "https://ref.example/", crossHost.Get("Referer"))
+}
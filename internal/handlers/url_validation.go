@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultMaxURLLength is the longest URL accepted by default
+const DefaultMaxURLLength = 2048
+
+// errMetadataEndpoint reports an address belonging to a cloud metadata endpoint
+var errMetadataEndpoint = errors.New("cloud metadata endpoint is not allowed")
+
+// hostResolveTimeout bounds the DNS lookup made to check the addresses a host resolves to
+const hostResolveTimeout = 5 * time.Second
+
+// HostResolver resolves host names to addresses; *net.Resolver satisfies it
+type HostResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// validateURL checks if a URL is safe to fetch
+func (h *DynamicHandler) validateURL(urlStr string) error {
+	return h.validateURLContext(context.Background(), urlStr)
+}
+
+// Validation stages a URL can be rejected at, the stage label of the rejection metric
+const (
+	rejectStageLength     = "length"
+	rejectStageFormat     = "format"
+	rejectStageScheme     = "scheme"
+	rejectStagePrivateIP  = "private_ip"
+	rejectStageDNS        = "dns"
+	rejectStageMetadata   = "metadata"
+	rejectStageHostPolicy = "host_policy"
+)
+
+// validateURLContext checks if a URL is safe to fetch, resolving hosts through the
+// resolution cache on ctx when there is one. Rejections are counted by stage.
+func (h *DynamicHandler) validateURLContext(ctx context.Context, urlStr string) error {
+	stage, err := h.checkURL(ctx, urlStr)
+	if err != nil {
+		h.ValidationMetrics.recordRejection(ctx, stage)
+	}
+	return err
+}
+
+// checkURL runs the validation stages in order and reports the one that rejected the URL
+func (h *DynamicHandler) checkURL(ctx context.Context, urlStr string) (string, error) {
+	// Reject oversized URLs before parsing them
+	if h.MaxURLLength > 0 && len(urlStr) > h.MaxURLLength {
+		return rejectStageLength, fmt.Errorf("URL length %d exceeds the maximum of %d characters", len(urlStr), h.MaxURLLength)
+	}
+
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return rejectStageFormat, fmt.Errorf("invalid URL format: %w", err)
+	}
+
+	// Only allow http and https schemes
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return rejectStageScheme, fmt.Errorf("unsupported scheme: %s (only http and https are allowed)", parsedURL.Scheme)
+	}
+
+	if err := h.ssrfPolicy().Validate(ctx, parsedURL); err != nil {
+		var staged *stageError
+		if errors.As(err, &staged) {
+			return staged.stage, staged.err
+		}
+		return rejectStagePolicy, err
+	}
+	return "", nil
+}
+
+// hostExempt reports whether host is exempt from SSRF protection, through the test allowlist
+// or the allowlist profile selected for the request
+func (h *DynamicHandler) hostExempt(ctx context.Context, host string) bool {
+	// Allowlist for test servers (set in tests)
+	if allowlist := os.Getenv("GUARDZ_TEST_ALLOWLIST"); allowlist != "" {
+		for _, allowed := range strings.Split(allowlist, ",") {
+			if host == allowed {
+				return true
+			}
+		}
+	}
+	profile := allowlistProfileFrom(ctx)
+	return profile != nil && profile.allows(host)
+}
+
+// checkResolvedHost resolves host and rejects it if any address is private, so a public-looking
+// name pointing at loopback, link-local or internal addresses cannot be fetched. A host resolving
+// to both public and private addresses is reported as split-horizon DNS.
+// Lookup failures are left for the fetch itself to report.
+func (h *DynamicHandler) checkResolvedHost(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, hostResolveTimeout)
+	defer cancel()
+	addrs, err := h.lookupHost(ctx, host)
+	if err != nil {
+		return nil
+	}
+
+	var public bool
+	var private net.IP
+	for _, addr := range addrs {
+		if h.isMetadataEndpoint(addr.IP.String()) {
+			return fmt.Errorf("host %s resolves to %s: %w", host, addr.IP, errMetadataEndpoint)
+		}
+		if isPrivateIP(addr.IP) {
+			private = addr.IP
+		} else {
+			public = true
+		}
+	}
+	switch {
+	case private != nil && public:
+		return fmt.Errorf("host %s resolves to both public and private addresses", host)
+	case private != nil:
+		return fmt.Errorf("host %s resolves to private address %s", host, private)
+	}
+	return nil
+}
+
+// isPrivateIP checks if an IP address is in a private range
+func isPrivateIP(ip net.IP) bool {
+	privateBlocks := []string{
+		"127.0.0.0/8",    // localhost
+		"10.0.0.0/8",     // private
+		"172.16.0.0/12",  // private
+		"192.168.0.0/16", // private
+		"169.254.0.0/16", // link-local
+		"::1/128",        // localhost IPv6
+		"fe80::/10",      // link-local IPv6
+		"fc00::/7",       // unique local IPv6
+	}
+
+	for _, block := range privateBlocks {
+		_, cidr, _ := net.ParseCIDR(block)
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateURL_MaxURLLength(t *testing.T) {
+	h := setupTestHandler()
+	h.MaxURLLength = 64
+
+	prefix := "https://example.com/"
+	atLimit := prefix + strings.Repeat("a", h.MaxURLLength-len(prefix))
+	require.Len(t, atLimit, h.MaxURLLength)
+	require.NoError(t, h.validateURL(atLimit), "URL at the limit should be accepted")
+
+	overLimit := atLimit + "a"
+	err := h.validateURL(overLimit)
+	require.Error(t, err, "URL above the limit should be rejected")
+	require.Contains(t, err.Error(), "exceeds the maximum of 64 characters")
+
+	h.MaxURLLength = 0
+	require.NoError(t, h.validateURL(prefix+strings.Repeat("a", 10000)), "zero disables the check")
+}
+
+func TestValidateURL_DefaultMaxURLLength(t *testing.T) {
+	h := setupTestHandler()
+	prefix := "https://example.com/"
+	require.NoError(t, h.validateURL(prefix+strings.Repeat("a", DefaultMaxURLLength-len(prefix))))
+	require.Error(t, h.validateURL(prefix+strings.Repeat("a", DefaultMaxURLLength)))
+}
+
+// stubResolver answers every lookup with a fixed set of addresses
+type stubResolver struct {
+	addrs []string
+}
+
+func (s stubResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs := make([]net.IPAddr, len(s.addrs))
+	for i, addr := range s.addrs {
+		addrs[i] = net.IPAddr{IP: net.ParseIP(addr)}
+	}
+	return addrs, nil
+}
+
+func TestValidateURL_RejectsHostsResolvingToPrivateAddresses(t *testing.T) {
+	h := setupTestHandler()
+
+	for _, addr := range []string{"127.0.0.1", "169.254.1.1", "10.0.0.5", "::1"} {
+		h.Resolver = stubResolver{addrs: []string{addr}}
+		err := h.validateURL("https://rebind.example.com/")
+		require.Error(t, err, "a host resolving to %s should be rejected", addr)
+		require.Contains(t, err.Error(), "resolves to private address "+net.ParseIP(addr).String())
+	}
+
+	h.Resolver = stubResolver{addrs: []string{"93.184.216.34", "10.0.0.5"}}
+	err := h.validateURL("https://split.example.com/")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "resolves to both public and private addresses")
+
+	h.Resolver = stubResolver{addrs: []string{"93.184.216.34", "2606:2800:220:1::1"}}
+	require.NoError(t, h.validateURL("https://public.example.com/"), "only public addresses is fine")
+}
+
+// flippingResolver answers the first lookup with a public address and every later one with loopback,
+// like a DNS rebinding attack with a zero TTL
+type flippingResolver struct {
+	lookups int32
+}
+
+func (f *flippingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if atomic.AddInt32(&f.lookups, 1) == 1 {
+		return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+	}
+	return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+}
+
+func TestDialContext_RevalidatesDialedAddress(t *testing.T) {
+	h := setupTestHandler()
+	h.Resolver = &flippingResolver{}
+
+	// Validated while the host still resolved to a public address, dialed after it flipped
+	require.NoError(t, h.validateURL("http://rebind.example.com/"))
+	dial := h.dialContext(&net.Dialer{})
+	_, err := dial(context.Background(), "tcp", "rebind.example.com:80")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "dialing private address 127.0.0.1 of host rebind.example.com is not allowed")
+
+	_, err = dial(context.Background(), "tcp", "127.0.0.1:80")
+	require.ErrorContains(t, err, "is not allowed", "literal private addresses are refused too")
+}
+
+func TestValidateURL_RejectsMetadataEndpoints(t *testing.T) {
+	h := setupTestHandler()
+	// Even a host the test allowlist exempts from SSRF protection
+	require.NoError(t, os.Setenv("GUARDZ_TEST_ALLOWLIST", "169.254.169.254,metadata.google.internal"))
+	defer func() { _ = os.Unsetenv("GUARDZ_TEST_ALLOWLIST") }()
+
+	testCases := []string{
+		"http://169.254.169.254/latest/meta-data/iam/security-credentials/",
+		"http://[fd00:ec2::254]/latest/meta-data/",
+		"http://metadata.google.internal/computeMetadata/v1/",
+		"http://METADATA.GOOGLE.INTERNAL./computeMetadata/v1/",
+		"http://metadata.goog/computeMetadata/v1/",
+		"http://100.100.100.200/latest/meta-data/",
+	}
+	for _, rawURL := range testCases {
+		t.Run(rawURL, func(t *testing.T) {
+			err := h.validateURL(rawURL)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "metadata endpoint")
+		})
+	}
+
+	t.Run("resolved address", func(t *testing.T) {
+		h.Resolver = stubResolver{addrs: []string{"169.254.169.254"}}
+		err := h.validateURL("http://innocent.example.com/")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "metadata endpoint")
+	})
+
+	t.Run("configurable", func(t *testing.T) {
+		h.Resolver = nil
+		h.MetadataEndpoints = []string{"metadata.internal.example.com"}
+		require.ErrorContains(t, h.validateURL("http://metadata.internal.example.com/"), "metadata endpoint")
+	})
+}
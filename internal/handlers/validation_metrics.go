@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/shaibs3/Guardz/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// ValidationMetrics counts URLs rejected by validation
+type ValidationMetrics struct {
+	Rejections metric.Int64Counter
+}
+
+// NewValidationMetrics creates the validation instruments, prefixing their names with namespace when set
+func NewValidationMetrics(meter metric.Meter, namespace string, logger *zap.Logger) *ValidationMetrics {
+	rejections, err := meter.Int64Counter(
+		telemetry.MetricName(namespace, "url_validation_rejections_total"),
+		metric.WithDescription("Total number of URLs rejected by validation, by stage"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		logger.Error("failed to create validation rejections metric", zap.Error(err))
+	}
+	return &ValidationMetrics{Rejections: rejections}
+}
+
+// recordRejection counts a URL rejected at stage. A nil receiver records nothing.
+func (m *ValidationMetrics) recordRejection(ctx context.Context, stage string) {
+	if m == nil || m.Rejections == nil {
+		return
+	}
+	m.Rejections.Add(ctx, 1, metric.WithAttributes(attribute.String("stage", stage)))
+}
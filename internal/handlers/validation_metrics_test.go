@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+)
+
+func TestDynamicHandler_CountsValidationRejectionsByStage(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	h := setupTestHandler()
+	h.MaxURLLength = 64
+	h.Resolver = stubResolver{addrs: []string{"10.0.0.5"}}
+	h.ValidationMetrics = NewValidationMetrics(meter, "", zap.NewNop())
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	body, _ := json.Marshal(map[string]interface{}{"urls": []string{
+		"https://example.com/" + strings.Repeat("a", 64),
+		"ftp://example.com/file",
+		"gopher://example.com/",
+		"http://127.0.0.1/admin",
+		"http://internal.example.com/",
+	}})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics-test", bytes.NewReader(body)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	counts := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "url_validation_rejections_total" {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				stage, _ := point.Attributes.Value("stage")
+				counts[stage.AsString()] = point.Value
+			}
+		}
+	}
+	require.Equal(t, map[string]int64{"length": 1, "scheme": 2, "private_ip": 1, "dns": 1}, counts)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/shaibs3/Guardz/internal/render"
+)
+
+// formatETag renders a path version as a strong ETag
+func formatETag(version uint64) string {
+	return fmt.Sprintf("%q", strconv.FormatUint(version, 10))
+}
+
+// parseIfMatch returns the path version named by an If-Match header.
+// It reports false when the header is absent or "*", which make the write unconditional.
+func parseIfMatch(header string) (uint64, bool, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, false, nil
+	}
+	version, err := strconv.ParseUint(strings.Trim(header, `"`), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf(`If-Match must be a path version ETag such as "3"`)
+	}
+	return version, true, nil
+}
+
+// replaceURLs stores records for path, only while the path is still at the If-Match version
+// when the request carries one. It writes the error response and returns false on failure.
+func (h *DynamicHandler) replaceURLs(w http.ResponseWriter, req *http.Request, path string, records []db_model.URLRecord) bool {
+	expected, conditional, err := parseIfMatch(req.Header.Get("If-Match"))
+	if err != nil {
+		render.Error(w, req, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	release := h.acquireStoreSlot(w, req)
+	if release == nil {
+		return false
+	}
+	defer release()
+
+	if !conditional {
+		if err := h.DB.StoreURLRecordsForPath(req.Context(), path, records); err != nil {
+			render.Error(w, req, "Failed to store URLs", http.StatusInternalServerError)
+			return false
+		}
+		return true
+	}
+
+	version, err := h.DB.ReplaceIfVersion(req.Context(), path, records, expected)
+	if errors.Is(err, db_model.ErrVersionMismatch) {
+		w.Header().Set("ETag", formatETag(version))
+		render.ErrorWithDetails(w, req, fmt.Sprintf("path was modified, current version is %d", version), http.StatusConflict,
+			map[string]interface{}{"version": version})
+		return false
+	}
+	if err != nil {
+		render.Error(w, req, "Failed to store URLs", http.StatusInternalServerError)
+		return false
+	}
+	w.Header().Set("ETag", formatETag(version))
+	return true
+}
+
+// setPathETag sets the ETag header to the current version of path, returning false if it could not be read
+func (h *DynamicHandler) setPathETag(w http.ResponseWriter, req *http.Request, path string) bool {
+	version, err := h.DB.GetPathVersion(req.Context(), path)
+	if err != nil {
+		return false
+	}
+	w.Header().Set("ETag", formatETag(version))
+	return true
+}
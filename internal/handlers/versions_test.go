@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// postIfMatch POSTs urls to path with an If-Match header
+func postIfMatch(r *mux.Router, path, body, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", ifMatch)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// pathETag GETs path without fetching its URLs and returns its ETag
+func pathETag(t *testing.T, r *mux.Router, path string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?fetch=false", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	return w.Header().Get("ETag")
+}
+
+func TestDynamicHandler_ReplaceIfVersionMatches(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	require.Equal(t, `"0"`, pathETag(t, r, "/version-test"), "a path never written is at version 0")
+	storeURLs(t, r, "/version-test", []string{"https://example.com/a"})
+	etag := pathETag(t, r, "/version-test")
+	require.Equal(t, `"1"`, etag)
+
+	w := postIfMatch(r, "/version-test", `{"urls": ["https://example.com/b"]}`, etag)
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, `"2"`, w.Header().Get("ETag"))
+	require.Equal(t, `"2"`, pathETag(t, r, "/version-test"))
+}
+
+func TestDynamicHandler_ReplaceIfVersionStale(t *testing.T) {
+	h := setupTestHandler()
+	r := mux.NewRouter()
+	h.RegisterRoutes(r, zap.NewNop())
+
+	storeURLs(t, r, "/stale-test", []string{"https://example.com/a"})
+	stale := pathETag(t, r, "/stale-test")
+
+	// Another client writes in between
+	storeURLs(t, r, "/stale-test", []string{"https://example.com/b"})
+
+	w := postIfMatch(r, "/stale-test", `{"urls": ["https://example.com/c"]}`, stale)
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Equal(t, `"2"`, w.Header().Get("ETag"), "the conflict reports the current version")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stale-test?fetch=false", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed struct {
+		URLs []db_model.URLRecord `json:"urls"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.URLs, 1)
+	require.Equal(t, "https://example.com/b", listed.URLs[0].URL, "a stale replace must not overwrite")
+
+	w = postIfMatch(r, "/stale-test", `{"urls": ["https://example.com/c"]}`, "not-a-version")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -33,3 +33,18 @@ func NewLogger(environment, logLevel string) (*zap.Logger, error) {
 
 	return logger, nil
 }
+
+// NewAuditLogger builds a JSON logger writing audit entries to destination,
+// "stdout", "stderr" or a file path. Entries are always written, whatever the log level.
+func NewAuditLogger(destination string) (*zap.Logger, error) {
+	config := zap.NewProductionConfig()
+	config.OutputPaths = []string{destination}
+	config.ErrorOutputPaths = []string{"stderr"}
+	config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	// An audit trail must not drop entries
+	config.Sampling = nil
+	config.EncoderConfig.TimeKey = ""
+	config.DisableCaller = true
+	config.DisableStacktrace = true
+	return config.Build()
+}
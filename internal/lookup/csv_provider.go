@@ -0,0 +1,350 @@
+package lookup
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+)
+
+// csvHeader names the columns of the CSV file. A path whose URLs were cleared keeps a single
+// row with an empty url so its version survives a restart. headers holds a JSON object and is
+// missing from files written before it was added.
+var csvHeader = []string{"path", "version", "url", "updated_at", "timeout_ms", "referer", "origin", "headers"}
+
+// geoIPCSVHeader names the columns of the geolocation CSV file loaded by LoadGeoIPRanges
+var geoIPCSVHeader = []string{"start_ip", "end_ip", "city", "country"}
+
+// CSVProvider keeps path to URL mappings in a CSV file. Reads are served from an in-memory copy;
+// every write rewrites the whole file through a temporary file and a rename, so a crash mid-write
+// leaves the previous file intact.
+type CSVProvider struct {
+	file string
+
+	// mu serializes writes with saving the file and guards swapping mem on a failed save
+	mu  sync.RWMutex
+	mem *InMemoryProvider
+
+	// ranges are the geolocation ranges loaded by LoadGeoIPRanges, kept apart from mem so
+	// reloading the URL file does not drop them
+	ranges []geoIPRange
+}
+
+// NewCSVProvider loads the CSV file at file, creating it when it does not exist
+func NewCSVProvider(file string) (*CSVProvider, error) {
+	if file == "" {
+		return nil, fmt.Errorf("csv_path is required for CSV provider")
+	}
+	p := &CSVProvider{file: file}
+	mem, err := p.load()
+	if errors.Is(err, os.ErrNotExist) {
+		p.mem = NewInMemoryProvider()
+		if err := p.save(); err != nil {
+			return nil, fmt.Errorf("failed to create CSV file: %w", err)
+		}
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.mem = mem
+	return p, nil
+}
+
+func (p *CSVProvider) StoreURLsForPath(ctx context.Context, path string, urls []string) error {
+	return p.StoreURLRecordsForPath(ctx, path, db_model.RecordsFromURLs(urls))
+}
+
+func (p *CSVProvider) StoreURLRecordsForPath(ctx context.Context, path string, records []db_model.URLRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.mem.StoreURLRecordsForPath(ctx, path, records); err != nil {
+		return err
+	}
+	return p.commit()
+}
+
+func (p *CSVProvider) ReplaceIfVersion(ctx context.Context, path string, records []db_model.URLRecord, version uint64) (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	newVersion, err := p.mem.ReplaceIfVersion(ctx, path, records, version)
+	if err != nil {
+		return newVersion, err
+	}
+	if err := p.commit(); err != nil {
+		return 0, err
+	}
+	return newVersion, nil
+}
+
+func (p *CSVProvider) DeleteURLsForPath(ctx context.Context, path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.mem.DeleteURLsForPath(ctx, path); err != nil {
+		return err
+	}
+	return p.commit()
+}
+
+func (p *CSVProvider) AddURLForPath(ctx context.Context, path string, url string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	added, err := p.mem.AddURLForPath(ctx, path, url)
+	if err != nil || !added {
+		return added, err
+	}
+	if err := p.commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (p *CSVProvider) GetURLsByPath(ctx context.Context, path string) ([]db_model.URLRecord, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.mem.GetURLsByPath(ctx, path)
+}
+
+func (p *CSVProvider) GetURLsUpdatedSince(ctx context.Context, since time.Time) ([]db_model.URLRecord, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.mem.GetURLsUpdatedSince(ctx, since)
+}
+
+func (p *CSVProvider) SearchURLs(ctx context.Context, substring string, limit int) ([]db_model.URLRecord, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.mem.SearchURLs(ctx, substring, limit)
+}
+
+func (p *CSVProvider) ListPaths(ctx context.Context) ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.mem.ListPaths(ctx)
+}
+
+// StoreFetchResult keeps the fetch result in memory only. Rewriting the file on every fetch
+// would cost far more than the results are worth across a restart.
+func (p *CSVProvider) StoreFetchResult(ctx context.Context, path string, record db_model.URLRecord) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.mem.StoreFetchResult(ctx, path, record)
+}
+
+func (p *CSVProvider) GetPathVersion(ctx context.Context, path string) (uint64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.mem.GetPathVersion(ctx, path)
+}
+
+func (p *CSVProvider) Lookup(ctx context.Context, ip netip.Addr) (db_model.GeoLocation, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return lookupGeoIP(p.ranges, ip)
+}
+
+// LoadGeoIPRanges replaces the ranges Lookup searches with those in the CSV file at file, whose
+// columns are start_ip, end_ip, city and country. The file is only read, never written.
+func (p *CSVProvider) LoadGeoIPRanges(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open geoip CSV file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = len(geoIPCSVHeader)
+	var ranges []geoIPRange
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read geoip CSV file %s: %w", file, err)
+		}
+		if line == 1 {
+			continue
+		}
+		rng, err := geoIPRangeFromCSV(row)
+		if err != nil {
+			return fmt.Errorf("invalid row %d in geoip CSV file %s: %w", line, file, err)
+		}
+		ranges = append(ranges, rng)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ranges = ranges
+	return nil
+}
+
+// geoIPRangeFromCSV parses one row of the geolocation CSV file
+func geoIPRangeFromCSV(row []string) (geoIPRange, error) {
+	start, err := netip.ParseAddr(row[0])
+	if err != nil {
+		return geoIPRange{}, fmt.Errorf("start_ip: %w", err)
+	}
+	end, err := netip.ParseAddr(row[1])
+	if err != nil {
+		return geoIPRange{}, fmt.Errorf("end_ip: %w", err)
+	}
+	return newGeoIPRange(start, end, db_model.GeoLocation{City: row[2], Country: row[3]})
+}
+
+// commit saves the in-memory copy. When saving fails the copy is reloaded from the file, so memory
+// never holds a write the file does not. Callers must hold the write lock.
+func (p *CSVProvider) commit() error {
+	saveErr := p.save()
+	if saveErr == nil {
+		return nil
+	}
+	if mem, err := p.load(); err == nil {
+		p.mem = mem
+	}
+	return fmt.Errorf("failed to save CSV file: %w", saveErr)
+}
+
+// save writes the in-memory copy to a temporary file next to the CSV file and renames it into place
+func (p *CSVProvider) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(p.file), filepath.Base(p.file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Removing after a successful rename fails harmlessly
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	writer := csv.NewWriter(tmp)
+	if err := writer.WriteAll(p.rows()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.file)
+}
+
+// rows returns the header and one row per stored URL, paths in the order they were created
+func (p *CSVProvider) rows() [][]string {
+	m := p.mem
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	paths := make([]string, 0, len(m.paths))
+	for path := range m.paths {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return m.paths[paths[i]] < m.paths[paths[j]] })
+
+	rows := [][]string{csvHeader}
+	for _, path := range paths {
+		id := m.paths[path]
+		version := strconv.FormatUint(m.versions[id], 10)
+		entries := m.urls[id]
+		if len(entries) == 0 {
+			rows = append(rows, []string{path, version, "", "", "", "", "", ""})
+			continue
+		}
+		for _, entry := range entries {
+			var headers string
+			if len(entry.headers) > 0 {
+				// Encoding cannot fail on a map of strings
+				encoded, _ := json.Marshal(entry.headers)
+				headers = string(encoded)
+			}
+			rows = append(rows, []string{
+				path,
+				version,
+				entry.url,
+				entry.updatedAt.UTC().Format(time.RFC3339Nano),
+				strconv.Itoa(entry.timeoutMs),
+				entry.referer,
+				entry.origin,
+				headers,
+			})
+		}
+	}
+	return rows
+}
+
+// load reads the CSV file into a new in-memory copy
+func (p *CSVProvider) load() (*InMemoryProvider, error) {
+	f, err := os.Open(p.file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := csv.NewReader(f)
+	// Files written before the headers column have one column less
+	reader.FieldsPerRecord = -1
+	mem := NewInMemoryProvider()
+	columns := 0
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return mem, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV file %s: %w", p.file, err)
+		}
+		if line == 1 {
+			columns = len(row)
+			if columns != len(csvHeader) && columns != len(csvHeader)-1 {
+				return nil, fmt.Errorf("invalid header in CSV file %s: %d columns", p.file, columns)
+			}
+			continue
+		}
+		if len(row) != columns {
+			return nil, fmt.Errorf("invalid row %d in CSV file %s: %d columns, want %d", line, p.file, len(row), columns)
+		}
+		if err := addCSVRow(mem, row); err != nil {
+			return nil, fmt.Errorf("invalid row %d in CSV file %s: %w", line, p.file, err)
+		}
+	}
+}
+
+// addCSVRow adds one row of the CSV file to mem
+func addCSVRow(mem *InMemoryProvider, row []string) error {
+	path, url := row[0], row[2]
+	version, err := strconv.ParseUint(row[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("version: %w", err)
+	}
+	id := mem.pathID(path)
+	mem.versions[id] = version
+	if url == "" {
+		return nil
+	}
+
+	entry := urlEntry{url: url, referer: row[5], origin: row[6]}
+	if entry.updatedAt, err = time.Parse(time.RFC3339Nano, row[3]); err != nil {
+		return fmt.Errorf("updated_at: %w", err)
+	}
+	if entry.timeoutMs, err = strconv.Atoi(row[4]); err != nil {
+		return fmt.Errorf("timeout_ms: %w", err)
+	}
+	if len(row) > 7 && row[7] != "" {
+		if err := json.Unmarshal([]byte(row[7]), &entry.headers); err != nil {
+			return fmt.Errorf("headers: %w", err)
+		}
+	}
+	mem.urls[id] = append(mem.urls[id], entry)
+	return nil
+}
@@ -0,0 +1,221 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVProvider_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "urls.csv")
+	p, err := NewCSVProvider(file)
+	require.NoError(t, err)
+
+	require.NoError(t, p.StoreURLRecordsForPath(ctx, "news", []db_model.URLRecord{
+		{URL: "https://a.example.com/feed?x=1,2", TimeoutMs: 500},
+		{URL: "https://b.example.com", Referer: "https://site.example.com/", Origin: "https://site.example.com",
+			Headers: map[string]string{"X-Api-Key": "secret, with comma"}},
+	}))
+	added, err := p.AddURLForPath(ctx, "news", "https://c.example.com")
+	require.NoError(t, err)
+	require.True(t, added)
+	require.NoError(t, p.StoreURLsForPath(ctx, "cleared", nil))
+
+	// A fresh provider reads back exactly what was written
+	reloaded, err := NewCSVProvider(file)
+	require.NoError(t, err)
+	for _, provider := range []*CSVProvider{p, reloaded} {
+		records, err := provider.GetURLsByPath(ctx, "news")
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		require.Equal(t, "https://a.example.com/feed?x=1,2", records[0].URL)
+		require.Equal(t, 500, records[0].TimeoutMs)
+		require.Equal(t, "https://site.example.com/", records[1].Referer)
+		require.Equal(t, "https://site.example.com", records[1].Origin)
+		require.Equal(t, map[string]string{"X-Api-Key": "secret, with comma"}, records[1].Headers)
+		require.Nil(t, records[0].Headers)
+		require.Equal(t, "https://c.example.com", records[2].URL)
+
+		version, err := provider.GetPathVersion(ctx, "news")
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), version)
+		version, err = provider.GetPathVersion(ctx, "cleared")
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), version, "a cleared path keeps its version")
+	}
+
+	records, err := reloaded.GetURLsByPath(ctx, "news")
+	require.NoError(t, err)
+	original, err := p.GetURLsByPath(ctx, "news")
+	require.NoError(t, err)
+	require.True(t, original[0].UpdatedAt.Equal(records[0].UpdatedAt), "timestamps survive a reload")
+
+	_, err = reloaded.ReplaceIfVersion(ctx, "news", nil, 1)
+	require.ErrorIs(t, err, db_model.ErrVersionMismatch)
+}
+
+func TestCSVProvider_CreatesMissingFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "missing.csv")
+	p, err := NewCSVProvider(file)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "path,version,url,updated_at,timeout_ms,referer,origin,headers\n", string(data))
+
+	records, err := p.GetURLsByPath(context.Background(), "anything")
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	_, err = NewCSVProvider("")
+	require.Error(t, err, "csv_path is required")
+}
+
+func TestCSVProvider_RejectsCorruptFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "corrupt.csv")
+	require.NoError(t, os.WriteFile(file, []byte("path,version,url,updated_at,timeout_ms,referer,origin\nnews,not-a-number,,,,,\n"), 0o600))
+
+	_, err := NewCSVProvider(file)
+	require.ErrorContains(t, err, "invalid row 2")
+}
+
+func TestCSVProvider_LoadsFileWithoutHeadersColumn(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "old.csv")
+	require.NoError(t, os.WriteFile(file, []byte("path,version,url,updated_at,timeout_ms,referer,origin\n"+
+		"news,3,https://a.example.com,2024-01-15T10:30:00Z,500,,\n"), 0o600))
+
+	p, err := NewCSVProvider(file)
+	require.NoError(t, err)
+	records, err := p.GetURLsByPath(context.Background(), "news")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, 500, records[0].TimeoutMs)
+	require.Nil(t, records[0].Headers)
+
+	// The next write upgrades the file
+	_, err = p.AddURLForPath(context.Background(), "news", "https://b.example.com")
+	require.NoError(t, err)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), "path,version,url,updated_at,timeout_ms,referer,origin,headers\n"))
+}
+
+func TestCSVProvider_ConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "urls.csv")
+	p, err := NewCSVProvider(file)
+	require.NoError(t, err)
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("path-%d", i)
+			errs <- p.StoreURLsForPath(ctx, path, []string{fmt.Sprintf("https://example.com/%d", i)})
+			_, err := p.AddURLForPath(ctx, path, "https://example.com/shared")
+			errs <- err
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := p.SearchURLs(ctx, "example", 10)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	reloaded, err := NewCSVProvider(file)
+	require.NoError(t, err)
+	for i := 0; i < writers; i++ {
+		records, err := reloaded.GetURLsByPath(ctx, fmt.Sprintf("path-%d", i))
+		require.NoError(t, err)
+		require.Len(t, records, 2, "every write must reach the file")
+	}
+	leftovers, err := filepath.Glob(file + ".tmp-*")
+	require.NoError(t, err)
+	require.Empty(t, leftovers, "temporary files are cleaned up")
+}
+
+func TestCSVProvider_DeleteURLsForPath(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "urls.csv")
+	p, err := NewCSVProvider(file)
+	require.NoError(t, err)
+	require.NoError(t, p.StoreURLsForPath(ctx, "path", []string{"https://a.example.com"}))
+	require.NoError(t, p.DeleteURLsForPath(ctx, "path"))
+	require.ErrorIs(t, p.DeleteURLsForPath(ctx, "missing"), db_model.ErrPathNotFound)
+
+	reloaded, err := NewCSVProvider(file)
+	require.NoError(t, err)
+	records, err := reloaded.GetURLsByPath(ctx, "path")
+	require.NoError(t, err)
+	require.Empty(t, records, "the delete reaches the file")
+}
+
+func TestCSVProvider_Lookup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	p, err := NewCSVProvider(filepath.Join(dir, "urls.csv"))
+	require.NoError(t, err)
+
+	_, err = p.Lookup(ctx, netip.MustParseAddr("198.51.100.130"))
+	require.ErrorIs(t, err, db_model.ErrIPNotFound, "nothing is located before ranges are loaded")
+
+	geoFile := filepath.Join(dir, "geoip.csv")
+	require.NoError(t, os.WriteFile(geoFile, []byte(strings.Join([]string{
+		"start_ip,end_ip,city,country",
+		"198.51.100.0,198.51.100.255,,ZZ",
+		`198.51.100.128,198.51.100.191,"Testville, North",ZZ`,
+		"2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,,ZZ",
+	}, "\n")+"\n"), 0o600))
+	require.NoError(t, p.LoadGeoIPRanges(geoFile))
+
+	location, err := p.Lookup(ctx, netip.MustParseAddr("198.51.100.130"))
+	require.NoError(t, err)
+	require.Equal(t, db_model.GeoLocation{City: "Testville, North", Country: "ZZ"}, location)
+
+	location, err = p.Lookup(ctx, netip.MustParseAddr("2001:db8:1::7"))
+	require.NoError(t, err)
+	require.Equal(t, db_model.GeoLocation{Country: "ZZ"}, location)
+
+	_, err = p.Lookup(ctx, netip.MustParseAddr("203.0.113.7"))
+	require.ErrorIs(t, err, db_model.ErrIPNotFound)
+
+	// Writing URLs rewrites and may reload the URL file, the ranges stay
+	require.NoError(t, p.StoreURLsForPath(ctx, "path", []string{"https://a.example.com"}))
+	_, err = p.Lookup(ctx, netip.MustParseAddr("198.51.100.7"))
+	require.NoError(t, err)
+}
+
+func TestCSVProvider_LoadGeoIPRangesRejectsInvalidRows(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewCSVProvider(filepath.Join(dir, "urls.csv"))
+	require.NoError(t, err)
+
+	for name, row := range map[string]string{
+		"bad address":    "198.51.100.x,198.51.100.255,,ZZ",
+		"reversed":       "198.51.100.255,198.51.100.0,,ZZ",
+		"mixed families": "198.51.100.0,2001:db8::1,,ZZ",
+		"short row":      "198.51.100.0,198.51.100.255,ZZ",
+	} {
+		geoFile := filepath.Join(dir, "geoip.csv")
+		require.NoError(t, os.WriteFile(geoFile, []byte("start_ip,end_ip,city,country\n"+row+"\n"), 0o600))
+		require.Error(t, p.LoadGeoIPRanges(geoFile), name)
+	}
+	require.Error(t, p.LoadGeoIPRanges(filepath.Join(dir, "missing.csv")))
+}
@@ -2,11 +2,56 @@ package lookup
 
 import (
 	"context"
+	"net/netip"
+	"time"
 
 	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/shaibs3/Guardz/internal/lookup/postgres"
 )
 
 type DbProvider interface {
 	StoreURLsForPath(ctx context.Context, path string, urls []string) error
+	// StoreURLRecordsForPath replaces the URLs for path like StoreURLsForPath,
+	// keeping per-URL settings such as TimeoutMs
+	StoreURLRecordsForPath(ctx context.Context, path string, records []db_model.URLRecord) error
 	GetURLsByPath(ctx context.Context, path string) ([]db_model.URLRecord, error)
+	// AddURLForPath adds a single URL to a path without replacing the stored set.
+	// It reports whether the URL was newly added.
+	AddURLForPath(ctx context.Context, path string, url string) (bool, error)
+	// GetURLsUpdatedSince returns URL records written after since, with their path filled in
+	GetURLsUpdatedSince(ctx context.Context, since time.Time) ([]db_model.URLRecord, error)
+	// SearchURLs returns up to limit URL records, across all paths, whose URL contains substring
+	// case-insensitively, with their path filled in
+	SearchURLs(ctx context.Context, substring string, limit int) ([]db_model.URLRecord, error)
+	// GetPathVersion returns the version of path, bumped on every write. A path never written is at version 0.
+	GetPathVersion(ctx context.Context, path string) (uint64, error)
+	// ReplaceIfVersion replaces the URLs for path like StoreURLRecordsForPath, but only while the path
+	// is still at version. It returns the new version, or db_model.ErrVersionMismatch when the path has moved on.
+	ReplaceIfVersion(ctx context.Context, path string, records []db_model.URLRecord, version uint64) (uint64, error)
+	// DeleteURLsForPath removes every URL stored for path and bumps its version, so the version
+	// keeps increasing if the path is written again. It returns db_model.ErrPathNotFound when
+	// the path has no URLs.
+	DeleteURLsForPath(ctx context.Context, path string) error
+	// ListPaths returns every path that has URLs stored, sorted
+	ListPaths(ctx context.Context) ([]string, error)
+	// StoreFetchResult records the latest fetch of record.URL on path: its StatusCode, Content,
+	// FetchError and FetchedAt. It neither bumps the path's version nor counts as a change.
+	// A URL no longer stored for the path is ignored.
+	StoreFetchResult(ctx context.Context, path string, record db_model.URLRecord) error
+	// Lookup returns the location of the narrowest stored range holding ip, or
+	// db_model.ErrIPNotFound when no range holds it
+	Lookup(ctx context.Context, ip netip.Addr) (db_model.GeoLocation, error)
 }
+
+// Pinger is implemented by providers backed by a remote database that readiness should check
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Every provider the factory can create implements the whole interface
+var (
+	_ DbProvider = (*InMemoryProvider)(nil)
+	_ DbProvider = (*CSVProvider)(nil)
+	_ DbProvider = (*postgres.PostgresProvider)(nil)
+	_ Pinger     = (*postgres.PostgresProvider)(nil)
+)
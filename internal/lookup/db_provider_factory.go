@@ -48,15 +48,31 @@ func (f *DbProviderFactory) CreateProvider(configJSON string) (DbProvider, error
 	}
 
 	var telemetryMeter metric.Meter
+	var metricsNamespace string
 
 	if f.telemetry != nil {
 		telemetryMeter = f.telemetry.Meter
+		metricsNamespace = f.telemetry.MetricsNamespace
 	} else {
 		telemetryMeter = nil
 	}
 	switch config.DbType {
 	case shared.DbTypePostgres:
-		return postgres.NewPostgresProvider(config, f.logger, telemetryMeter)
+		return postgres.NewPostgresProvider(config, f.logger, telemetryMeter, metricsNamespace)
+	case shared.DbTypeCSV:
+		csvPath, _ := config.ExtraDetails["csv_path"].(string)
+		geoIPPath, _ := config.ExtraDetails["geoip_csv_path"].(string)
+		f.logger.Info("Using CSVProvider for DB", zap.String("csv_path", csvPath), zap.String("geoip_csv_path", geoIPPath))
+		provider, err := NewCSVProvider(csvPath)
+		if err != nil {
+			return nil, err
+		}
+		if geoIPPath != "" {
+			if err := provider.LoadGeoIPRanges(geoIPPath); err != nil {
+				return nil, err
+			}
+		}
+		return provider, nil
 	case shared.DbTypeMemory:
 		f.logger.Info("Using InMemoryProvider for DB")
 		return NewInMemoryProvider(), nil
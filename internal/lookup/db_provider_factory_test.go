@@ -2,6 +2,7 @@ package lookup
 
 import (
 	"encoding/json"
+	"path/filepath"
 	"testing"
 
 	"github.com/shaibs3/Guardz/internal/telemetry"
@@ -35,3 +36,21 @@ func TestDbProviderFactory_CreateProvider_Postgres(t *testing.T) {
 	t.Skip("Skipping Postgres provider test; not needed for unit tests.")
 	// The rest of the test is intentionally skipped.
 }
+
+func TestDbProviderFactory_CreateProvider_CSV(t *testing.T) {
+	factory := NewDbProviderFactory(zap.NewNop(), nil)
+
+	config := DbProviderConfig{
+		DbType:       DbTypeCSV,
+		ExtraDetails: map[string]interface{}{"csv_path": filepath.Join(t.TempDir(), "urls.csv")},
+	}
+	configJSON, _ := json.Marshal(config)
+
+	provider, err := factory.CreateProvider(string(configJSON))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := provider.(*CSVProvider); !ok {
+		t.Fatalf("expected CSVProvider, got %T", provider)
+	}
+}
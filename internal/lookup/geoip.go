@@ -0,0 +1,55 @@
+package lookup
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+)
+
+// geoIPRange locates the addresses from start to end, inclusive
+type geoIPRange struct {
+	start    netip.Addr
+	end      netip.Addr
+	location db_model.GeoLocation
+}
+
+// newGeoIPRange validates a range. IPv4-mapped IPv6 bounds are stored as IPv4.
+func newGeoIPRange(start, end netip.Addr, location db_model.GeoLocation) (geoIPRange, error) {
+	if !start.IsValid() || !end.IsValid() {
+		return geoIPRange{}, fmt.Errorf("invalid ip range %s-%s", start, end)
+	}
+	start, end = start.Unmap(), end.Unmap()
+	if start.Is4() != end.Is4() {
+		return geoIPRange{}, fmt.Errorf("ip range %s-%s mixes address families", start, end)
+	}
+	if end.Less(start) {
+		return geoIPRange{}, fmt.Errorf("ip range %s-%s ends before it starts", start, end)
+	}
+	return geoIPRange{start: start, end: end, location: location}, nil
+}
+
+// lookupGeoIP returns the location of the narrowest range holding ip, like the Postgres
+// provider: of the ranges holding ip, the one starting latest and then ending earliest.
+// Ranges stored first win ties.
+func lookupGeoIP(ranges []geoIPRange, ip netip.Addr) (db_model.GeoLocation, error) {
+	if !ip.IsValid() {
+		return db_model.GeoLocation{}, errors.New("invalid ip address")
+	}
+	ip = ip.Unmap()
+	var best *geoIPRange
+	for i := range ranges {
+		rng := &ranges[i]
+		if ip.Less(rng.start) || rng.end.Less(ip) || rng.start.Is4() != ip.Is4() {
+			continue
+		}
+		if best == nil || best.start.Less(rng.start) || (best.start == rng.start && rng.end.Less(best.end)) {
+			best = rng
+		}
+	}
+	if best == nil {
+		return db_model.GeoLocation{}, db_model.ErrIPNotFound
+	}
+	return best.location, nil
+}
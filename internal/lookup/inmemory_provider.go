@@ -2,39 +2,189 @@ package lookup
 
 import (
 	"context"
+	"maps"
+	"net/netip"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/shaibs3/Guardz/internal/db_model"
 )
 
+// urlEntry is a stored URL together with the time it was last written
+type urlEntry struct {
+	url       string
+	updatedAt time.Time
+	timeoutMs int
+	referer   string
+	origin    string
+	headers   map[string]string
+
+	statusCode int
+	content    string
+	fetchError string
+	fetchedAt  time.Time
+}
+
+// record returns the entry as the URL record at position index of its path
+func (e urlEntry) record(index int, pathID uint64, path string) db_model.URLRecord {
+	return db_model.URLRecord{
+		ID:         uint64(index + 1), // #nosec G115
+		PathID:     pathID,
+		Path:       path,
+		URL:        e.url,
+		UpdatedAt:  e.updatedAt,
+		TimeoutMs:  e.timeoutMs,
+		Referer:    e.referer,
+		Origin:     e.origin,
+		Headers:    maps.Clone(e.headers),
+		StatusCode: e.statusCode,
+		Content:    e.content,
+		FetchError: e.fetchError,
+		FetchedAt:  e.fetchedAt,
+	}
+}
+
 type InMemoryProvider struct {
-	mu     sync.RWMutex
-	paths  map[string]uint64
-	urls   map[uint64][]string
-	nextID uint64
+	mu       sync.RWMutex
+	paths    map[string]uint64
+	urls     map[uint64][]urlEntry
+	versions map[uint64]uint64
+	nextID   uint64
+
+	// ranges are the geolocation ranges seeded with StoreIPRange
+	ranges []geoIPRange
 }
 
 func NewInMemoryProvider() *InMemoryProvider {
 	return &InMemoryProvider{
-		paths:  make(map[string]uint64),
-		urls:   make(map[uint64][]string),
-		nextID: 1,
+		paths:    make(map[string]uint64),
+		urls:     make(map[uint64][]urlEntry),
+		versions: make(map[uint64]uint64),
+		nextID:   1,
 	}
 }
 
-func (m *InMemoryProvider) StoreURLsForPath(ctx context.Context, path string, urls []string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// pathID returns the ID for path, allocating one if needed. Callers must hold the write lock.
+func (m *InMemoryProvider) pathID(path string) uint64 {
 	id, ok := m.paths[path]
 	if !ok {
 		id = m.nextID
 		m.paths[path] = id
 		m.nextID++
 	}
-	m.urls[id] = append([]string{}, urls...) // overwrite for idempotency
+	return id
+}
+
+func (m *InMemoryProvider) StoreURLsForPath(ctx context.Context, path string, urls []string) error {
+	return m.StoreURLRecordsForPath(ctx, path, db_model.RecordsFromURLs(urls))
+}
+
+func (m *InMemoryProvider) StoreURLRecordsForPath(ctx context.Context, path string, records []db_model.URLRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replace(path, records)
+	return nil
+}
+
+func (m *InMemoryProvider) ReplaceIfVersion(ctx context.Context, path string, records []db_model.URLRecord, version uint64) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if current := m.versions[m.paths[path]]; current != version {
+		return current, db_model.ErrVersionMismatch
+	}
+	return m.replace(path, records), nil
+}
+
+// replace overwrites the URLs for path and returns its new version. Callers must hold the write lock.
+func (m *InMemoryProvider) replace(path string, records []db_model.URLRecord) uint64 {
+	id := m.pathID(path)
+	now := time.Now()
+	entries := make([]urlEntry, len(records))
+	for i, record := range records {
+		entries[i] = urlEntry{
+			url:       record.URL,
+			updatedAt: now,
+			timeoutMs: record.TimeoutMs,
+			referer:   record.Referer,
+			origin:    record.Origin,
+			headers:   maps.Clone(record.Headers),
+		}
+	}
+	m.urls[id] = entries // overwrite for idempotency
+	m.versions[id]++
+	return m.versions[id]
+}
+
+func (m *InMemoryProvider) DeleteURLsForPath(ctx context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.paths[path]
+	if !ok || len(m.urls[id]) == 0 {
+		return db_model.ErrPathNotFound
+	}
+	delete(m.urls, id)
+	m.versions[id]++
+	return nil
+}
+
+func (m *InMemoryProvider) ListPaths(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	paths := make([]string, 0, len(m.paths))
+	for path, id := range m.paths {
+		if len(m.urls[id]) > 0 {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (m *InMemoryProvider) StoreFetchResult(ctx context.Context, path string, record db_model.URLRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.paths[path]
+	if !ok {
+		return nil
+	}
+	entries := m.urls[id]
+	for i := range entries {
+		if entries[i].url == record.URL {
+			entries[i].statusCode = record.StatusCode
+			entries[i].content = record.Content
+			entries[i].fetchError = record.FetchError
+			entries[i].fetchedAt = record.FetchedAt
+		}
+	}
 	return nil
 }
 
+func (m *InMemoryProvider) GetPathVersion(ctx context.Context, path string) (uint64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id, ok := m.paths[path]
+	if !ok {
+		return 0, nil
+	}
+	return m.versions[id], nil
+}
+
+func (m *InMemoryProvider) AddURLForPath(ctx context.Context, path string, url string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.pathID(path)
+	for _, existing := range m.urls[id] {
+		if existing.url == url {
+			return false, nil
+		}
+	}
+	m.urls[id] = append(m.urls[id], urlEntry{url: url, updatedAt: time.Now()})
+	m.versions[id]++
+	return true, nil
+}
+
 func (m *InMemoryProvider) GetURLsByPath(ctx context.Context, path string) ([]db_model.URLRecord, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -42,14 +192,80 @@ func (m *InMemoryProvider) GetURLsByPath(ctx context.Context, path string) ([]db
 	if !ok {
 		return nil, nil
 	}
-	urls := m.urls[id]
-	records := make([]db_model.URLRecord, 0, len(urls))
-	for i, url := range urls {
-		records = append(records, db_model.URLRecord{
-			ID:     uint64(i + 1), // #nosec G115
-			PathID: id,
-			URL:    url,
-		})
+	entries := m.urls[id]
+	records := make([]db_model.URLRecord, 0, len(entries))
+	for i, entry := range entries {
+		records = append(records, entry.record(i, id, ""))
+	}
+	return records, nil
+}
+
+func (m *InMemoryProvider) GetURLsUpdatedSince(ctx context.Context, since time.Time) ([]db_model.URLRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var records []db_model.URLRecord
+	for path, id := range m.paths {
+		for i, entry := range m.urls[id] {
+			if !entry.updatedAt.After(since) {
+				continue
+			}
+			records = append(records, entry.record(i, id, path))
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].UpdatedAt.Equal(records[j].UpdatedAt) {
+			return records[i].UpdatedAt.Before(records[j].UpdatedAt)
+		}
+		if records[i].PathID != records[j].PathID {
+			return records[i].PathID < records[j].PathID
+		}
+		return records[i].ID < records[j].ID
+	})
+	return records, nil
+}
+
+// StoreIPRange seeds the addresses from start to end, inclusive, as located at location.
+// Lookup prefers the narrowest range holding an address, so a city can be nested in a country.
+func (m *InMemoryProvider) StoreIPRange(start, end netip.Addr, location db_model.GeoLocation) error {
+	rng, err := newGeoIPRange(start, end, location)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ranges = append(m.ranges, rng)
+	return nil
+}
+
+func (m *InMemoryProvider) Lookup(ctx context.Context, ip netip.Addr) (db_model.GeoLocation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return lookupGeoIP(m.ranges, ip)
+}
+
+func (m *InMemoryProvider) SearchURLs(ctx context.Context, substring string, limit int) ([]db_model.URLRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	// Scan paths in a stable order so a bounded search always returns the same matches
+	paths := make([]string, 0, len(m.paths))
+	for path := range m.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	needle := strings.ToLower(substring)
+	var records []db_model.URLRecord
+	for _, path := range paths {
+		id := m.paths[path]
+		for i, entry := range m.urls[id] {
+			if !strings.Contains(strings.ToLower(entry.url), needle) {
+				continue
+			}
+			if len(records) == limit {
+				return records, nil
+			}
+			records = append(records, entry.record(i, id, path))
+		}
 	}
 	return records, nil
 }
@@ -0,0 +1,259 @@
+package lookup
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryProvider_AddURLForPath_Idempotent(t *testing.T) {
+	ctx := context.Background()
+	p := NewInMemoryProvider()
+	require.NoError(t, p.StoreURLsForPath(ctx, "path", []string{"https://a.example.com"}))
+
+	added, err := p.AddURLForPath(ctx, "path", "https://b.example.com")
+	require.NoError(t, err)
+	require.True(t, added, "first add should report new")
+
+	added, err = p.AddURLForPath(ctx, "path", "https://b.example.com")
+	require.NoError(t, err)
+	require.False(t, added, "second add should report not-new")
+
+	records, err := p.GetURLsByPath(ctx, "path")
+	require.NoError(t, err)
+	require.Len(t, records, 2, "add should not replace the stored set")
+	require.Equal(t, "https://a.example.com", records[0].URL)
+	require.Equal(t, "https://b.example.com", records[1].URL)
+}
+
+func TestInMemoryProvider_AddURLForPath_NewPath(t *testing.T) {
+	ctx := context.Background()
+	p := NewInMemoryProvider()
+
+	added, err := p.AddURLForPath(ctx, "fresh", "https://a.example.com")
+	require.NoError(t, err)
+	require.True(t, added)
+
+	records, err := p.GetURLsByPath(ctx, "fresh")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+}
+
+func TestInMemoryProvider_GetURLsUpdatedSince(t *testing.T) {
+	ctx := context.Background()
+	p := NewInMemoryProvider()
+	require.NoError(t, p.StoreURLsForPath(ctx, "old", []string{"https://old.example.com"}))
+
+	time.Sleep(2 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(2 * time.Millisecond)
+
+	require.NoError(t, p.StoreURLsForPath(ctx, "new", []string{"https://a.example.com", "https://b.example.com"}))
+	_, err := p.AddURLForPath(ctx, "old", "https://added.example.com")
+	require.NoError(t, err)
+
+	records, err := p.GetURLsUpdatedSince(ctx, since)
+	require.NoError(t, err)
+	require.Len(t, records, 3, "only records stored after since should be returned")
+
+	var urls []string
+	for _, record := range records {
+		require.True(t, record.UpdatedAt.After(since))
+		urls = append(urls, record.Path+" "+record.URL)
+	}
+	require.ElementsMatch(t, []string{
+		"new https://a.example.com",
+		"new https://b.example.com",
+		"old https://added.example.com",
+	}, urls)
+}
+
+func TestInMemoryProvider_StoreURLRecordsKeepsTimeoutHint(t *testing.T) {
+	ctx := context.Background()
+	provider := NewInMemoryProvider()
+
+	require.NoError(t, provider.StoreURLRecordsForPath(ctx, "p", []db_model.URLRecord{
+		{URL: "https://a.example", TimeoutMs: 1500},
+		{URL: "https://b.example"},
+	}))
+
+	records, err := provider.GetURLsByPath(ctx, "p")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, 1500, records[0].TimeoutMs)
+	require.Equal(t, 0, records[1].TimeoutMs)
+}
+
+func TestInMemoryProvider_StoreURLRecordsKeepsHeaders(t *testing.T) {
+	ctx := context.Background()
+	provider := NewInMemoryProvider()
+
+	headers := map[string]string{"X-Api-Key": "secret"}
+	require.NoError(t, provider.StoreURLRecordsForPath(ctx, "p", []db_model.URLRecord{
+		{URL: "https://a.example", Headers: headers},
+	}))
+	headers["X-Api-Key"] = "changed"
+
+	records, err := provider.GetURLsByPath(ctx, "p")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"X-Api-Key": "secret"}, records[0].Headers, "stored headers are a copy")
+
+	records[0].Headers["X-Api-Key"] = "changed"
+	records, err = provider.GetURLsByPath(ctx, "p")
+	require.NoError(t, err)
+	require.Equal(t, "secret", records[0].Headers["X-Api-Key"], "returned headers are a copy")
+}
+
+func TestInMemoryProvider_ReplaceIfVersion(t *testing.T) {
+	ctx := context.Background()
+	p := NewInMemoryProvider()
+
+	version, err := p.GetPathVersion(ctx, "path")
+	require.NoError(t, err)
+	require.Zero(t, version)
+
+	require.NoError(t, p.StoreURLsForPath(ctx, "path", []string{"https://a.example.com"}))
+	added, err := p.AddURLForPath(ctx, "path", "https://b.example.com")
+	require.NoError(t, err)
+	require.True(t, added)
+	version, err = p.GetPathVersion(ctx, "path")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), version, "every write bumps the version")
+
+	_, err = p.ReplaceIfVersion(ctx, "path", db_model.RecordsFromURLs([]string{"https://c.example.com"}), 1)
+	require.ErrorIs(t, err, db_model.ErrVersionMismatch)
+
+	version, err = p.ReplaceIfVersion(ctx, "path", db_model.RecordsFromURLs([]string{"https://c.example.com"}), 2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), version)
+	records, err := p.GetURLsByPath(ctx, "path")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "https://c.example.com", records[0].URL)
+}
+
+func TestInMemoryProvider_SearchURLs(t *testing.T) {
+	ctx := context.Background()
+	p := NewInMemoryProvider()
+	require.NoError(t, p.StoreURLsForPath(ctx, "b", []string{"https://evil.example.com/x", "https://good.example.com"}))
+	require.NoError(t, p.StoreURLsForPath(ctx, "a", []string{"https://EVIL.example.com/y"}))
+
+	records, err := p.SearchURLs(ctx, "evil.example", 10)
+	require.NoError(t, err)
+	require.Len(t, records, 2, "matches are found across paths, case-insensitively")
+	require.Equal(t, "a", records[0].Path)
+	require.Equal(t, "https://EVIL.example.com/y", records[0].URL)
+	require.Equal(t, "b", records[1].Path)
+	require.Equal(t, "https://evil.example.com/x", records[1].URL)
+
+	records, err = p.SearchURLs(ctx, "example.com", 2)
+	require.NoError(t, err)
+	require.Len(t, records, 2, "results are bounded by the limit")
+}
+
+func TestInMemoryProvider_DeleteURLsForPath(t *testing.T) {
+	ctx := context.Background()
+	p := NewInMemoryProvider()
+	require.ErrorIs(t, p.DeleteURLsForPath(ctx, "path"), db_model.ErrPathNotFound)
+
+	require.NoError(t, p.StoreURLsForPath(ctx, "path", []string{"https://a.example.com", "https://b.example.com"}))
+	require.NoError(t, p.StoreURLsForPath(ctx, "other", []string{"https://c.example.com"}))
+	require.NoError(t, p.DeleteURLsForPath(ctx, "path"))
+
+	records, err := p.GetURLsByPath(ctx, "path")
+	require.NoError(t, err)
+	require.Empty(t, records)
+	records, err = p.GetURLsByPath(ctx, "other")
+	require.NoError(t, err)
+	require.Len(t, records, 1, "other paths are untouched")
+
+	version, err := p.GetPathVersion(ctx, "path")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), version, "deleting bumps the version")
+	require.ErrorIs(t, p.DeleteURLsForPath(ctx, "path"), db_model.ErrPathNotFound, "a deleted path has no URLs left")
+}
+
+func TestInMemoryProvider_ListPaths(t *testing.T) {
+	ctx := context.Background()
+	p := NewInMemoryProvider()
+	require.NoError(t, p.StoreURLsForPath(ctx, "b", []string{"https://b.example.com"}))
+	require.NoError(t, p.StoreURLsForPath(ctx, "a", []string{"https://a.example.com"}))
+	require.NoError(t, p.StoreURLsForPath(ctx, "empty", nil))
+
+	paths, err := p.ListPaths(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, paths, "paths are sorted and only listed while they have URLs")
+}
+
+func TestInMemoryProvider_StoreFetchResult(t *testing.T) {
+	ctx := context.Background()
+	p := NewInMemoryProvider()
+	require.NoError(t, p.StoreURLsForPath(ctx, "path", []string{"https://a.example.com", "https://b.example.com"}))
+
+	fetchedAt := time.Now()
+	require.NoError(t, p.StoreFetchResult(ctx, "path", db_model.URLRecord{
+		URL: "https://b.example.com", StatusCode: 502, FetchError: "bad gateway", FetchedAt: fetchedAt,
+	}))
+	require.NoError(t, p.StoreFetchResult(ctx, "path", db_model.URLRecord{URL: "https://gone.example.com", StatusCode: 200}))
+	require.NoError(t, p.StoreFetchResult(ctx, "missing", db_model.URLRecord{URL: "https://a.example.com", StatusCode: 200}))
+
+	records, err := p.GetURLsByPath(ctx, "path")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Zero(t, records[0].StatusCode)
+	require.Equal(t, 502, records[1].StatusCode)
+	require.Equal(t, "bad gateway", records[1].FetchError)
+	require.True(t, fetchedAt.Equal(records[1].FetchedAt))
+
+	version, err := p.GetPathVersion(ctx, "path")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), version, "recording a fetch does not bump the version")
+}
+
+func TestInMemoryProvider_Lookup(t *testing.T) {
+	ctx := context.Background()
+	p := NewInMemoryProvider()
+	country := db_model.GeoLocation{Country: "ZZ"}
+	city := db_model.GeoLocation{City: "Testville", Country: "ZZ"}
+
+	// Documentation ranges, a city nested in a wider region, seeded wide first
+	require.NoError(t, p.StoreIPRange(netip.MustParseAddr("198.51.100.0"), netip.MustParseAddr("198.51.100.255"), country))
+	require.NoError(t, p.StoreIPRange(netip.MustParseAddr("198.51.100.128"), netip.MustParseAddr("198.51.100.191"), city))
+	require.NoError(t, p.StoreIPRange(netip.MustParseAddr("2001:db8::"), netip.MustParseAddr("2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"), country))
+
+	for _, tc := range []struct {
+		ip   string
+		want db_model.GeoLocation
+	}{
+		{ip: "198.51.100.130", want: city},
+		{ip: "198.51.100.191", want: city},
+		{ip: "198.51.100.192", want: country},
+		{ip: "::ffff:198.51.100.10", want: country},
+		{ip: "2001:db8:1::7", want: country},
+	} {
+		location, err := p.Lookup(ctx, netip.MustParseAddr(tc.ip))
+		require.NoError(t, err, tc.ip)
+		require.Equal(t, tc.want, location, tc.ip)
+	}
+
+	for _, ip := range []string{"203.0.113.7", "2001:db9::1", "::ffff:203.0.113.7"} {
+		_, err := p.Lookup(ctx, netip.MustParseAddr(ip))
+		require.ErrorIs(t, err, db_model.ErrIPNotFound, ip)
+	}
+}
+
+func TestInMemoryProvider_StoreIPRangeRejectsInvalidRanges(t *testing.T) {
+	p := NewInMemoryProvider()
+	for _, tc := range []struct{ start, end string }{
+		{start: "198.51.100.255", end: "198.51.100.0"},
+		{start: "198.51.100.0", end: "2001:db8::1"},
+	} {
+		err := p.StoreIPRange(netip.MustParseAddr(tc.start), netip.MustParseAddr(tc.end), db_model.GeoLocation{})
+		require.Error(t, err, "%s-%s", tc.start, tc.end)
+	}
+	require.Error(t, p.StoreIPRange(netip.Addr{}, netip.MustParseAddr("198.51.100.0"), db_model.GeoLocation{}))
+}
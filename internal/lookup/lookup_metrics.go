@@ -2,8 +2,10 @@ package lookup
 
 import (
 	"context"
-	"go.opentelemetry.io/otel/metric"
 	"sync"
+
+	"github.com/shaibs3/Guardz/internal/telemetry"
+	"go.opentelemetry.io/otel/metric"
 )
 
 var (
@@ -12,14 +14,14 @@ var (
 	metricsInit    sync.Once
 )
 
-func InitLookupMetrics(meter metric.Meter) {
+func InitLookupMetrics(meter metric.Meter, namespace string) {
 	metricsInit.Do(func() {
 		lookupDuration, _ = meter.Float64Histogram(
-			"ip_lookup_duration_seconds",
+			telemetry.MetricName(namespace, "ip_lookup_duration_seconds"),
 			metric.WithDescription("Duration of IP lookup in seconds"),
 		)
 		lookupErrors, _ = meter.Int64Counter(
-			"ip_lookup_errors_total",
+			telemetry.MetricName(namespace, "ip_lookup_errors_total"),
 			metric.WithDescription("Total number of IP lookup errors"),
 		)
 	})
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// GormGeoIPRange locates the addresses from StartIP to EndIP, inclusive, in a city
+type GormGeoIPRange struct {
+	ID      uint64 `gorm:"primaryKey"`
+	StartIP string `gorm:"type:inet;not null;index:idx_geoip_ranges_bounds,priority:1"`
+	EndIP   string `gorm:"type:inet;not null;index:idx_geoip_ranges_bounds,priority:2"`
+	City    string `gorm:"not null;default:''"`
+	Country string `gorm:"not null;default:''"`
+}
+
+func (GormGeoIPRange) TableName(namer schema.Namer) string {
+	return namer.TableName("geoip_range")
+}
+
+// Lookup returns the location of the narrowest stored range holding ip, or db_model.ErrIPNotFound
+func (p *PostgresProvider) Lookup(ctx context.Context, ip netip.Addr) (db_model.GeoLocation, error) {
+	if !ip.IsValid() {
+		return db_model.GeoLocation{}, errors.New("invalid ip address")
+	}
+	var rng GormGeoIPRange
+	notFound := false
+	err := p.execute(ctx, "lookup", func() error {
+		found := geoIPRangeQuery(p.gormDB.WithContext(ctx), ip).Find(&rng)
+		notFound = found.Error == nil && found.RowsAffected == 0
+		return found.Error
+	})
+	if err != nil {
+		return db_model.GeoLocation{}, err
+	}
+	if notFound {
+		// Reported outside the breaker, an unknown address is not a database failure
+		return db_model.GeoLocation{}, db_model.ErrIPNotFound
+	}
+	return db_model.GeoLocation{City: rng.City, Country: rng.Country}, nil
+}
+
+// geoIPRangeQuery selects the narrowest range holding ip, so a city range nested in a
+// country-wide one wins. Of the ranges holding ip, a nested one starts no earlier and ends
+// no later than the ranges around it; comparing the bounds avoids end_ip - start_ip, which
+// overflows bigint for IPv6 ranges wider than 2^63 addresses. IPv4-mapped IPv6 addresses
+// are matched against IPv4 ranges.
+func geoIPRangeQuery(db *gorm.DB, ip netip.Addr) *gorm.DB {
+	return db.Model(&GormGeoIPRange{}).
+		Where("CAST(? AS inet) BETWEEN start_ip AND end_ip", ip.Unmap().String()).
+		Order("start_ip DESC, end_ip, id").
+		Limit(1)
+}
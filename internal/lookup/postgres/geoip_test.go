@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestGeoIPRangeQuery(t *testing.T) {
+	db := dryRunDB(t, "")
+	for _, tc := range []struct {
+		ip   string
+		want string
+	}{
+		{ip: "198.51.100.7", want: "198.51.100.7"},
+		{ip: "::ffff:198.51.100.7", want: "198.51.100.7"},
+		{ip: "2001:db8::1", want: "2001:db8::1"},
+	} {
+		sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			return geoIPRangeQuery(tx, netip.MustParseAddr(tc.ip)).Find(&GormGeoIPRange{})
+		})
+		require.Contains(t, sql, `FROM "geoip_ranges" WHERE CAST('`+tc.want+`' AS inet) BETWEEN start_ip AND end_ip`)
+		require.Contains(t, sql, "ORDER BY start_ip DESC, end_ip, id LIMIT 1", "the narrowest range wins")
+	}
+}
+
+func TestSchema_GeoIPRanges(t *testing.T) {
+	sql, err := Schema("guardz_")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"id", "start_ip", "end_ip", "city", "country"}, createTableColumns(t, sql, "guardz_geoip_ranges"))
+	require.Contains(t, sql, `"start_ip" inet NOT NULL`)
+	require.Contains(t, sql, `CREATE INDEX IF NOT EXISTS "idx_geoip_ranges_bounds" ON "guardz_geoip_ranges" ("start_ip","end_ip")`)
+}
+
+func TestPostgresProvider_Lookup(t *testing.T) {
+	provider := newTestProvider(t)
+	ctx := context.Background()
+
+	// Documentation ranges, a city nested in a wider region
+	ranges := []GormGeoIPRange{
+		{StartIP: "198.51.100.0", EndIP: "198.51.100.255", City: "", Country: "ZZ"},
+		{StartIP: "198.51.100.128", EndIP: "198.51.100.191", City: "Testville", Country: "ZZ"},
+		// A /32 spans 2^96 addresses, far more than end_ip - start_ip fits in a bigint
+		{StartIP: "2001:db8::", EndIP: "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", City: "", Country: "ZZ"},
+		{StartIP: "2001:db8:1::", EndIP: "2001:db8:1:ffff:ffff:ffff:ffff:ffff", City: "Testburg", Country: "ZZ"},
+	}
+	require.NoError(t, provider.gormDB.WithContext(ctx).Create(&ranges).Error)
+	t.Cleanup(func() { provider.gormDB.Delete(&ranges) })
+
+	location, err := provider.Lookup(ctx, netip.MustParseAddr("198.51.100.130"))
+	require.NoError(t, err)
+	require.Equal(t, db_model.GeoLocation{City: "Testville", Country: "ZZ"}, location)
+
+	location, err = provider.Lookup(ctx, netip.MustParseAddr("::ffff:198.51.100.10"))
+	require.NoError(t, err)
+	require.Equal(t, db_model.GeoLocation{Country: "ZZ"}, location)
+
+	location, err = provider.Lookup(ctx, netip.MustParseAddr("2001:db8:1::7"))
+	require.NoError(t, err)
+	require.Equal(t, db_model.GeoLocation{City: "Testburg", Country: "ZZ"}, location)
+
+	location, err = provider.Lookup(ctx, netip.MustParseAddr("2001:db8:2::7"))
+	require.NoError(t, err)
+	require.Equal(t, db_model.GeoLocation{Country: "ZZ"}, location)
+
+	_, err = provider.Lookup(ctx, netip.MustParseAddr("203.0.113.7"))
+	require.ErrorIs(t, err, db_model.ErrIPNotFound)
+}
@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/zap"
+)
+
+// dbMetrics records latency and outcome of database operations
+type dbMetrics struct {
+	operationDuration metric.Float64Histogram
+	operations        metric.Int64Counter
+}
+
+func newDBMetrics(meter metric.Meter, namespace string, logger *zap.Logger) *dbMetrics {
+	if meter == nil {
+		meter = noop.NewMeterProvider().Meter("guardz")
+	}
+
+	operationDuration, err := meter.Float64Histogram(
+		telemetry.MetricName(namespace, "db_operation_duration_seconds"),
+		metric.WithDescription("Duration of database operations in seconds"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		logger.Error("failed to create db operation duration metric", zap.Error(err))
+	}
+
+	operations, err := meter.Int64Counter(
+		telemetry.MetricName(namespace, "db_operations_total"),
+		metric.WithDescription("Total number of database operations by outcome"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		logger.Error("failed to create db operations metric", zap.Error(err))
+	}
+
+	return &dbMetrics{
+		operationDuration: operationDuration,
+		operations:        operations,
+	}
+}
+
+// record records the duration and outcome of a single operation
+func (m *dbMetrics) record(ctx context.Context, operation string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.String("outcome", outcome),
+	)
+
+	if m.operationDuration != nil {
+		m.operationDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+	}
+	if m.operations != nil {
+		m.operations.Add(ctx, 1, attrs)
+	}
+}
+
+// DefaultPoolStatsInterval is how often connection pool stats are sampled
+const DefaultPoolStatsInterval = 15 * time.Second
+
+// poolStatsSource is implemented by *sql.DB
+type poolStatsSource interface {
+	Stats() sql.DBStats
+}
+
+// poolMetrics periodically records connection pool stats so pool exhaustion is visible
+type poolMetrics struct {
+	inUse        metric.Int64Gauge
+	idle         metric.Int64Gauge
+	waitCount    metric.Int64Gauge
+	waitDuration metric.Float64Gauge
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	done     chan struct{}
+}
+
+func newPoolMetrics(meter metric.Meter, namespace string, logger *zap.Logger) *poolMetrics {
+	if meter == nil {
+		meter = noop.NewMeterProvider().Meter("guardz")
+	}
+
+	inUse, err := meter.Int64Gauge(
+		telemetry.MetricName(namespace, "db_pool_connections_in_use"),
+		metric.WithDescription("Number of database connections currently in use"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		logger.Error("failed to create db pool in use metric", zap.Error(err))
+	}
+
+	idle, err := meter.Int64Gauge(
+		telemetry.MetricName(namespace, "db_pool_connections_idle"),
+		metric.WithDescription("Number of idle database connections"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		logger.Error("failed to create db pool idle metric", zap.Error(err))
+	}
+
+	waitCount, err := meter.Int64Gauge(
+		telemetry.MetricName(namespace, "db_pool_wait_count"),
+		metric.WithDescription("Total number of connections waited for"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		logger.Error("failed to create db pool wait count metric", zap.Error(err))
+	}
+
+	waitDuration, err := meter.Float64Gauge(
+		telemetry.MetricName(namespace, "db_pool_wait_duration_seconds"),
+		metric.WithDescription("Total time blocked waiting for a new connection in seconds"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		logger.Error("failed to create db pool wait duration metric", zap.Error(err))
+	}
+
+	return &poolMetrics{
+		inUse:        inUse,
+		idle:         idle,
+		waitCount:    waitCount,
+		waitDuration: waitDuration,
+		stopCh:       make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// record records a single sample of pool stats
+func (m *poolMetrics) record(ctx context.Context, stats sql.DBStats) {
+	if m.inUse != nil {
+		m.inUse.Record(ctx, int64(stats.InUse))
+	}
+	if m.idle != nil {
+		m.idle.Record(ctx, int64(stats.Idle))
+	}
+	if m.waitCount != nil {
+		m.waitCount.Record(ctx, stats.WaitCount)
+	}
+	if m.waitDuration != nil {
+		m.waitDuration.Record(ctx, stats.WaitDuration.Seconds())
+	}
+}
+
+// start samples the pool every interval in the background until stop is called
+func (m *poolMetrics) start(db poolStatsSource, interval time.Duration) {
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		m.record(context.Background(), db.Stats())
+		for {
+			select {
+			case <-ticker.C:
+				m.record(context.Background(), db.Stats())
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stop ends background sampling and waits for it to finish
+func (m *poolMetrics) stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+	})
+	<-m.done
+}
@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+)
+
+func TestPostgresProvider_ExecuteRecordsMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	p := &PostgresProvider{
+		logger:  zap.NewNop(),
+		cb:      newCircuitBreaker(),
+		metrics: newDBMetrics(meter, "", zap.NewNop()),
+	}
+
+	ctx := context.Background()
+	require.NoError(t, p.execute(ctx, "store_urls_for_path", func() error { return nil }))
+	require.NoError(t, p.execute(ctx, "get_urls_by_path", func() error { return nil }))
+	require.Error(t, p.execute(ctx, "get_urls_by_path", func() error { return errors.New("boom") }))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+
+	samples := map[string]uint64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "db_operation_duration_seconds" {
+				continue
+			}
+			hist, ok := m.Data.(metricdata.Histogram[float64])
+			require.True(t, ok, "duration should be a histogram")
+			for _, dp := range hist.DataPoints {
+				op, _ := dp.Attributes.Value(attribute.Key("operation"))
+				outcome, _ := dp.Attributes.Value(attribute.Key("outcome"))
+				samples[op.AsString()+"/"+outcome.AsString()] += dp.Count
+			}
+		}
+	}
+
+	require.Equal(t, uint64(1), samples["store_urls_for_path/success"])
+	require.Equal(t, uint64(1), samples["get_urls_by_path/success"])
+	require.Equal(t, uint64(1), samples["get_urls_by_path/failure"])
+}
+
+type fakePoolStats struct {
+	stats sql.DBStats
+}
+
+func (f fakePoolStats) Stats() sql.DBStats {
+	return f.stats
+}
+
+func TestPoolMetrics_RecordsPoolStats(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	m := newPoolMetrics(meter, "", zap.NewNop())
+	m.start(fakePoolStats{stats: sql.DBStats{InUse: 3, Idle: 2, WaitCount: 7, WaitDuration: 1500 * time.Millisecond}}, time.Hour)
+	// The first sample is taken as soon as sampling starts
+	require.Eventually(t, func() bool {
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+		return len(rm.ScopeMetrics) > 0
+	}, time.Second, 5*time.Millisecond)
+	m.stop()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	values := map[string]float64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, metric := range sm.Metrics {
+			switch data := metric.Data.(type) {
+			case metricdata.Gauge[int64]:
+				require.Len(t, data.DataPoints, 1)
+				values[metric.Name] = float64(data.DataPoints[0].Value)
+			case metricdata.Gauge[float64]:
+				require.Len(t, data.DataPoints, 1)
+				values[metric.Name] = data.DataPoints[0].Value
+			}
+		}
+	}
+
+	for _, name := range []string{
+		"db_pool_connections_in_use",
+		"db_pool_connections_idle",
+		"db_pool_wait_count",
+		"db_pool_wait_duration_seconds",
+	} {
+		value, ok := values[name]
+		require.True(t, ok, "%s should be registered", name)
+		require.GreaterOrEqual(t, value, float64(0), "%s should be non-negative", name)
+	}
+	require.Equal(t, float64(3), values["db_pool_connections_in_use"])
+	require.Equal(t, float64(2), values["db_pool_connections_idle"])
+	require.Equal(t, float64(7), values["db_pool_wait_count"])
+	require.Equal(t, 1.5, values["db_pool_wait_duration_seconds"])
+}
+
+func TestPoolMetrics_StopIsIdempotent(t *testing.T) {
+	m := newPoolMetrics(nil, "", zap.NewNop())
+	m.start(fakePoolStats{}, time.Millisecond)
+	m.stop()
+	m.stop()
+}
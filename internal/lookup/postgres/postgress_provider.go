@@ -2,7 +2,10 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/shaibs3/Guardz/internal/db_model"
@@ -13,33 +16,134 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
+// DefaultInitTimeout bounds connecting and migrating at startup when init_timeout is not set
+const DefaultInitTimeout = 30 * time.Second
+
 type PostgresProvider struct {
-	gormDB *gorm.DB
-	logger *zap.Logger
-	cb     *gobreaker.CircuitBreaker
+	gormDB      *gorm.DB
+	sqlDB       *sql.DB
+	logger      *zap.Logger
+	cb          *gobreaker.CircuitBreaker
+	metrics     *dbMetrics
+	poolMetrics *poolMetrics
 }
 
-func NewPostgresProvider(config shared.DbProviderConfig, logger *zap.Logger, meter metric.Meter) (*PostgresProvider, error) {
+// NewPostgresProvider connects to Postgres. Metric names are prefixed with metricsNamespace when set.
+func NewPostgresProvider(config shared.DbProviderConfig, logger *zap.Logger, meter metric.Meter, metricsNamespace string) (*PostgresProvider, error) {
 	pgLogger := logger.Named("postgres")
 
 	connStr, ok := config.ExtraDetails["conn_str"].(string)
 	if !ok {
 		return nil, fmt.Errorf("conn_str is required for Postgres provider")
 	}
-	pgLogger.Info("initializing Postgres provider", zap.String("conn_str", connStr))
+	// Optional prefix for table names, e.g. "guardz_" or a schema such as "guardz."
+	tablePrefix, _ := config.ExtraDetails["table_prefix"].(string)
+	initTimeout, err := parseInitTimeout(config.ExtraDetails["init_timeout"])
+	if err != nil {
+		return nil, err
+	}
+	pgLogger.Info("initializing Postgres provider",
+		zap.String("conn_str", connStr),
+		zap.String("table_prefix", tablePrefix),
+		zap.Duration("init_timeout", initTimeout))
+
+	// Connecting and migrating must not stall startup when the database is slow or unreachable
+	ctx, cancel := context.WithTimeout(context.Background(), initTimeout)
+	defer cancel()
 
-	// Initialize GORM
-	gormDB, err := gorm.Open(postgres.Open(connStr), &gorm.Config{})
+	// Initialize GORM, pinging below under the deadline rather than in Open
+	gormConfig := newGormConfig(tablePrefix)
+	gormConfig.DisableAutomaticPing = true
+	gormDB, err := gorm.Open(postgres.Open(connStr), gormConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open GORM connection: %w", err)
 	}
-	if err := gormDB.AutoMigrate(&GormPath{}, &GormURL{}); err != nil {
-		return nil, fmt.Errorf("failed to auto-migrate: %w", err)
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
+		return nil, initError("failed to connect", initTimeout, err)
+	}
+	if err := migrate(ctx, gormDB); err != nil {
+		_ = sqlDB.Close()
+		return nil, initError("failed to auto-migrate", initTimeout, err)
+	}
+
+	// Sample connection pool stats in the background until Close
+	poolMetrics := newPoolMetrics(meter, metricsNamespace, pgLogger)
+	poolMetrics.start(sqlDB, DefaultPoolStatsInterval)
+
+	pgLogger.Info("Postgres provider initialized successfully")
+	return &PostgresProvider{
+		gormDB:      gormDB,
+		sqlDB:       sqlDB,
+		logger:      pgLogger,
+		cb:          newCircuitBreaker(),
+		metrics:     newDBMetrics(meter, metricsNamespace, pgLogger),
+		poolMetrics: poolMetrics,
+	}, nil
+}
+
+// Close stops pool stats sampling and closes the database connections
+func (p *PostgresProvider) Close() error {
+	if p.poolMetrics != nil {
+		p.poolMetrics.stop()
+	}
+	if p.sqlDB != nil {
+		return p.sqlDB.Close()
 	}
+	return nil
+}
 
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+// Ping checks that the database answers, through the circuit breaker so an open breaker fails fast
+func (p *PostgresProvider) Ping(ctx context.Context) error {
+	return p.execute(ctx, "ping", func() error {
+		return p.sqlDB.PingContext(ctx)
+	})
+}
+
+// parseInitTimeout reads the init_timeout extra detail, a duration string such as "10s"
+func parseInitTimeout(value interface{}) (time.Duration, error) {
+	if value == nil {
+		return DefaultInitTimeout, nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("init_timeout must be a duration string, got %v", value)
+	}
+	timeout, err := time.ParseDuration(str)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("init_timeout must be a positive duration, got %q", str)
+	}
+	return timeout, nil
+}
+
+// initError describes an initialization step that failed, calling out when it ran out of time
+func initError(step string, timeout time.Duration, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s: database did not respond within init timeout %s: %w", step, timeout, err)
+	}
+	return fmt.Errorf("%s: %w", step, err)
+}
+
+// newGormConfig creates the GORM configuration, applying the table prefix to all models
+func newGormConfig(tablePrefix string) *gorm.Config {
+	return &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{
+			TablePrefix:         tablePrefix,
+			IdentifierMaxLength: 64,
+		},
+	}
+}
+
+// newCircuitBreaker creates the circuit breaker guarding database operations
+func newCircuitBreaker() *gobreaker.CircuitBreaker {
+	return gobreaker.NewCircuitBreaker(gobreaker.Settings{
 		Name:        "PostgresDB",
 		MaxRequests: 5,
 		Interval:    60 * time.Second,
@@ -48,41 +152,252 @@ func NewPostgresProvider(config shared.DbProviderConfig, logger *zap.Logger, met
 			return counts.ConsecutiveFailures > 3
 		},
 	})
+}
 
-	pgLogger.Info("Postgres provider initialized successfully")
-	return &PostgresProvider{
-		gormDB: gormDB,
-		logger: pgLogger,
-		cb:     cb,
-	}, nil
+// execute runs a database operation through the circuit breaker and records its latency and outcome
+func (p *PostgresProvider) execute(ctx context.Context, operation string, fn func() error) error {
+	start := time.Now()
+	_, err := p.cb.Execute(func() (interface{}, error) {
+		return nil, fn()
+	})
+	p.metrics.record(ctx, operation, start, err)
+	return err
+}
+
+// lockPath returns the row for path, creating it if needed, locked FOR UPDATE until the transaction ends.
+// The insert leans on the unique index on path, so concurrent first stores to a new path
+// resolve to the same row instead of racing into a duplicate-key error.
+func lockPath(tx *gorm.DB, path string) (GormPath, error) {
+	if err := tx.Clauses(clauseOnConflictPath()).Create(&GormPath{Path: path}).Error; err != nil {
+		return GormPath{}, err
+	}
+
+	var pth GormPath
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("path = ?", path).First(&pth).Error
+	return pth, err
+}
+
+// clauseOnConflictPath skips inserting a path that already exists
+func clauseOnConflictPath() clause.OnConflict {
+	return clause.OnConflict{
+		Columns:   []clause.Column{{Name: "path"}},
+		DoNothing: true,
+	}
 }
 
 // StoreURLsForPath stores URLs for a path with row-level locking to prevent race conditions
 func (p *PostgresProvider) StoreURLsForPath(ctx context.Context, path string, urls []string) error {
+	return p.StoreURLRecordsForPath(ctx, path, db_model.RecordsFromURLs(urls))
+}
+
+// StoreURLRecordsForPath stores URL records for a path, keeping per-URL settings such as TimeoutMs
+func (p *PostgresProvider) StoreURLRecordsForPath(ctx context.Context, path string, records []db_model.URLRecord) error {
+	return p.execute(ctx, "store_urls_for_path", func() error {
+		return p.storeURLRecordsForPath(ctx, path, records)
+	})
+}
+
+func (p *PostgresProvider) storeURLRecordsForPath(ctx context.Context, path string, records []db_model.URLRecord) error {
 	return p.gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		var pth GormPath
-		// Use FOR UPDATE to lock the row during write operations
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("path = ?", path).FirstOrCreate(&pth, GormPath{Path: path}).Error; err != nil {
+		// Lock the path row during write operations
+		pth, err := lockPath(tx, path)
+		if err != nil {
 			return err
 		}
+		_, err = replaceURLs(tx, pth, records)
+		return err
+	})
+}
+
+// ReplaceIfVersion replaces the URLs for path only while it is still at version
+func (p *PostgresProvider) ReplaceIfVersion(ctx context.Context, path string, records []db_model.URLRecord, version uint64) (uint64, error) {
+	var newVersion uint64
+	mismatch := false
+	err := p.execute(ctx, "replace_if_version", func() error {
+		var err error
+		newVersion, mismatch, err = p.replaceIfVersion(ctx, path, records, version)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if mismatch {
+		// Reported outside the breaker, a conflict is not a database failure
+		return newVersion, db_model.ErrVersionMismatch
+	}
+	return newVersion, nil
+}
 
-		// Remove old URLs for idempotency
-		if err := tx.Where("path_id = ?", pth.ID).Delete(&GormURL{}).Error; err != nil {
+// replaceIfVersion returns the current version and true instead of writing when the version does not match
+func (p *PostgresProvider) replaceIfVersion(ctx context.Context, path string, records []db_model.URLRecord, version uint64) (uint64, bool, error) {
+	var newVersion uint64
+	mismatch := false
+	err := p.gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The row lock makes the version check and the write atomic
+		pth, err := lockPath(tx, path)
+		if err != nil {
 			return err
 		}
+		if pth.Version != version {
+			newVersion, mismatch = pth.Version, true
+			return nil
+		}
+		newVersion, err = replaceURLs(tx, pth, records)
+		return err
+	})
+	return newVersion, mismatch, err
+}
+
+// replaceURLs swaps the URLs of a locked path for records and bumps its version
+func replaceURLs(tx *gorm.DB, pth GormPath, records []db_model.URLRecord) (uint64, error) {
+	// Remove old URLs for idempotency
+	if err := tx.Where("path_id = ?", pth.ID).Delete(&GormURL{}).Error; err != nil {
+		return 0, err
+	}
 
+	// Storing no URLs clears the path
+	if len(records) > 0 {
 		// Create new URL records
-		urlObjs := make([]GormURL, len(urls))
-		for i, u := range urls {
-			urlObjs[i] = GormURL{PathID: pth.ID, URL: u}
+		urlObjs := make([]GormURL, len(records))
+		for i, record := range records {
+			urlObjs[i] = GormURL{
+				PathID:    pth.ID,
+				URL:       record.URL,
+				TimeoutMs: record.TimeoutMs,
+				Referer:   record.Referer,
+				Origin:    record.Origin,
+				Headers:   record.Headers,
+			}
 		}
-		return tx.Create(&urlObjs).Error
+		if err := tx.Create(&urlObjs).Error; err != nil {
+			return 0, err
+		}
+	}
+	return bumpVersion(tx, pth)
+}
+
+// DeleteURLsForPath removes the URLs stored for path. The path row is kept so its version
+// keeps increasing if the path is written again.
+func (p *PostgresProvider) DeleteURLsForPath(ctx context.Context, path string) error {
+	notFound := false
+	err := p.execute(ctx, "delete_urls_for_path", func() error {
+		var err error
+		notFound, err = p.deleteURLsForPath(ctx, path)
+		return err
 	})
+	if err != nil {
+		return err
+	}
+	if notFound {
+		// Reported outside the breaker, a missing path is not a database failure
+		return db_model.ErrPathNotFound
+	}
+	return nil
+}
+
+// deleteURLsForPath returns true instead of writing when the path has no URLs
+func (p *PostgresProvider) deleteURLsForPath(ctx context.Context, path string) (bool, error) {
+	notFound := false
+	err := p.gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pth GormPath
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("path = ?", path).Limit(1).Find(&pth).Error
+		if err != nil {
+			return err
+		}
+		if pth.ID == 0 {
+			notFound = true
+			return nil
+		}
+		deleted := tx.Where("path_id = ?", pth.ID).Delete(&GormURL{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		if deleted.RowsAffected == 0 {
+			notFound = true
+			return nil
+		}
+		_, err = bumpVersion(tx, pth)
+		return err
+	})
+	return notFound, err
+}
+
+// bumpVersion increments the version of a locked path and returns the new version
+func bumpVersion(tx *gorm.DB, pth GormPath) (uint64, error) {
+	if err := tx.Model(&GormPath{}).Where("id = ?", pth.ID).
+		UpdateColumn("version", gorm.Expr("version + 1")).Error; err != nil {
+		return 0, err
+	}
+	return pth.Version + 1, nil
+}
+
+// GetPathVersion returns the version of path, zero when it has never been written
+func (p *PostgresProvider) GetPathVersion(ctx context.Context, path string) (uint64, error) {
+	var version uint64
+	err := p.execute(ctx, "get_path_version", func() error {
+		var pth GormPath
+		err := p.gormDB.WithContext(ctx).Where("path = ?", path).Limit(1).Find(&pth).Error
+		version = pth.Version
+		return err
+	})
+	return version, err
+}
+
+// AddURLForPath adds a single URL to a path unless it is already stored, reporting whether it was added
+func (p *PostgresProvider) AddURLForPath(ctx context.Context, path string, url string) (bool, error) {
+	var added bool
+	err := p.execute(ctx, "add_url_for_path", func() error {
+		var err error
+		added, err = p.addURLForPath(ctx, path, url)
+		return err
+	})
+	return added, err
+}
+
+func (p *PostgresProvider) addURLForPath(ctx context.Context, path string, url string) (bool, error) {
+	added := false
+	err := p.gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the path row to serialize concurrent adds to the same path
+		pth, err := lockPath(tx, path)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&GormURL{}).Where("path_id = ? AND url = ?", pth.ID, url).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		if err := tx.Create(&GormURL{PathID: pth.ID, URL: url}).Error; err != nil {
+			return err
+		}
+		if _, err := bumpVersion(tx, pth); err != nil {
+			return err
+		}
+		added = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return added, nil
 }
 
 // GetURLsByPath retrieves URLs for a path with row-level locking to ensure consistency
 func (p *PostgresProvider) GetURLsByPath(ctx context.Context, path string) ([]db_model.URLRecord, error) {
+	var records []db_model.URLRecord
+	err := p.execute(ctx, "get_urls_by_path", func() error {
+		var err error
+		records, err = p.getURLsByPath(ctx, path)
+		return err
+	})
+	return records, err
+}
+
+func (p *PostgresProvider) getURLsByPath(ctx context.Context, path string) ([]db_model.URLRecord, error) {
 	var pth GormPath
 	// Use FOR SHARE to prevent writes during read operations
 	if err := p.gormDB.WithContext(ctx).Clauses(clause.Locking{Strength: "SHARE"}).
@@ -98,11 +413,117 @@ func (p *PostgresProvider) GetURLsByPath(ctx context.Context, path string) ([]db
 	// Convert GormURL to db_model.URLRecord
 	records := make([]db_model.URLRecord, len(urls))
 	for i, url := range urls {
-		records[i] = db_model.URLRecord{
-			ID:     url.ID,
-			PathID: url.PathID,
-			URL:    url.URL,
-		}
+		records[i] = url.record("")
+	}
+	return records, nil
+}
+
+// GetURLsUpdatedSince retrieves URLs written after since, ordered by update time
+func (p *PostgresProvider) GetURLsUpdatedSince(ctx context.Context, since time.Time) ([]db_model.URLRecord, error) {
+	var records []db_model.URLRecord
+	err := p.execute(ctx, "get_urls_updated_since", func() error {
+		var err error
+		records, err = p.getURLsUpdatedSince(ctx, since)
+		return err
+	})
+	return records, err
+}
+
+func (p *PostgresProvider) getURLsUpdatedSince(ctx context.Context, since time.Time) ([]db_model.URLRecord, error) {
+	var urls []GormURL
+	if err := p.gormDB.WithContext(ctx).Where("updated_at > ?", since).
+		Order("updated_at, path_id, id").Find(&urls).Error; err != nil {
+		return nil, err
+	}
+	return p.withPathNames(ctx, urls)
+}
+
+// SearchURLs finds URLs containing substring case-insensitively, across all paths
+func (p *PostgresProvider) SearchURLs(ctx context.Context, substring string, limit int) ([]db_model.URLRecord, error) {
+	var records []db_model.URLRecord
+	err := p.execute(ctx, "search_urls", func() error {
+		var err error
+		records, err = p.searchURLs(ctx, substring, limit)
+		return err
+	})
+	return records, err
+}
+
+func (p *PostgresProvider) searchURLs(ctx context.Context, substring string, limit int) ([]db_model.URLRecord, error) {
+	var urls []GormURL
+	pattern := "%" + escapeLike(substring) + "%"
+	if err := p.gormDB.WithContext(ctx).Where(`url ILIKE ? ESCAPE '\'`, pattern).
+		Order("path_id, id").Limit(limit).Find(&urls).Error; err != nil {
+		return nil, err
+	}
+	return p.withPathNames(ctx, urls)
+}
+
+// ListPaths returns every path that has URLs stored, sorted
+func (p *PostgresProvider) ListPaths(ctx context.Context) ([]string, error) {
+	var paths []string
+	err := p.execute(ctx, "list_paths", func() error {
+		return pathsWithURLs(p.gormDB.WithContext(ctx)).Pluck("path", &paths).Error
+	})
+	return paths, err
+}
+
+// pathsWithURLs selects the paths that have URLs stored, sorted. Paths whose URLs were all
+// deleted keep their row, and are left out.
+func pathsWithURLs(db *gorm.DB) *gorm.DB {
+	return db.Model(&GormPath{}).Where("id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&GormURL{}).Select("path_id")).
+		Order("path")
+}
+
+// StoreFetchResult records the latest fetch of a stored URL without touching its updated_at
+func (p *PostgresProvider) StoreFetchResult(ctx context.Context, path string, record db_model.URLRecord) error {
+	return p.execute(ctx, "store_fetch_result", func() error {
+		return fetchResultUpdate(p.gormDB.WithContext(ctx), path, record).Error
+	})
+}
+
+// fetchResultUpdate updates the fetch columns of record.URL on path. UpdateColumns skips the
+// automatic updated_at, which tracks writes to the stored URLs rather than fetches.
+func fetchResultUpdate(db *gorm.DB, path string, record db_model.URLRecord) *gorm.DB {
+	fetchedAt := record.FetchedAt
+	pathIDs := db.Session(&gorm.Session{NewDB: true}).Model(&GormPath{}).Select("id").Where("path = ?", path)
+	return db.Model(&GormURL{}).Where("path_id IN (?) AND url = ?", pathIDs, record.URL).
+		UpdateColumns(map[string]interface{}{
+			"status_code": record.StatusCode,
+			"content":     record.Content,
+			"fetch_error": record.FetchError,
+			"fetched_at":  &fetchedAt,
+		})
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// withPathNames converts URL rows to records with their path names resolved
+func (p *PostgresProvider) withPathNames(ctx context.Context, urls []GormURL) ([]db_model.URLRecord, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	// Resolve path names for the URLs
+	pathIDs := make([]uint64, 0, len(urls))
+	for _, url := range urls {
+		pathIDs = append(pathIDs, url.PathID)
+	}
+	var paths []GormPath
+	if err := p.gormDB.WithContext(ctx).Where("id IN ?", pathIDs).Find(&paths).Error; err != nil {
+		return nil, err
+	}
+	pathNames := make(map[uint64]string, len(paths))
+	for _, pth := range paths {
+		pathNames[pth.ID] = pth.Path
+	}
+
+	records := make([]db_model.URLRecord, len(urls))
+	for i, url := range urls {
+		records[i] = url.record(pathNames[url.PathID])
 	}
 	return records, nil
 }
@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/shaibs3/Guardz/internal/lookup/shared"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// newTestProvider connects to the database in GUARDZ_TEST_POSTGRES_DSN, skipping the test when unset
+func newTestProvider(t *testing.T) *PostgresProvider {
+	t.Helper()
+	connStr := os.Getenv("GUARDZ_TEST_POSTGRES_DSN")
+	if connStr == "" {
+		t.Skip("GUARDZ_TEST_POSTGRES_DSN not set; skipping Postgres integration test")
+	}
+	provider, err := NewPostgresProvider(shared.DbProviderConfig{
+		DbType:       shared.DbTypePostgres,
+		ExtraDetails: map[string]interface{}{"conn_str": connStr},
+	}, zap.NewNop(), nil, "")
+	require.NoError(t, err)
+	return provider
+}
+
+func TestLockPath_UsesOnConflict(t *testing.T) {
+	db := dryRunDB(t, "")
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Clauses(clauseOnConflictPath()).Create(&GormPath{Path: "p"})
+	})
+	require.Contains(t, sql, `ON CONFLICT ("path") DO NOTHING`)
+}
+
+func TestPostgresProvider_ConcurrentFirstStore(t *testing.T) {
+	provider := newTestProvider(t)
+	ctx := context.Background()
+	path := fmt.Sprintf("concurrent-%d", time.Now().UnixNano())
+
+	const writers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- provider.StoreURLsForPath(ctx, path, []string{fmt.Sprintf("https://example.com/%d", i)})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err, "concurrent first stores should not surface duplicate-key errors")
+	}
+
+	records, err := provider.GetURLsByPath(ctx, path)
+	require.NoError(t, err)
+	require.Len(t, records, 1, "the last writer's set should win")
+}
+
+func TestPathsWithURLs_SQL(t *testing.T) {
+	db := dryRunDB(t, "guardz_")
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var paths []string
+		return pathsWithURLs(tx).Pluck("path", &paths)
+	})
+	require.Equal(t, `SELECT "path" FROM "guardz_paths" WHERE id IN (SELECT "path_id" FROM "guardz_urls") ORDER BY path`, sql)
+}
+
+func TestFetchResultUpdate_SQL(t *testing.T) {
+	db := dryRunDB(t, "")
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return fetchResultUpdate(tx, "p", db_model.URLRecord{URL: "https://example.com", StatusCode: 200, Content: "ok"})
+	})
+	require.Contains(t, sql, `UPDATE "urls" SET`)
+	require.Contains(t, sql, `"status_code"=200`)
+	require.Contains(t, sql, `"content"='ok'`)
+	require.NotContains(t, sql, "updated_at", "recording a fetch is not a change to the stored URLs")
+	require.Contains(t, sql, `WHERE path_id IN (SELECT "id" FROM "paths" WHERE path = 'p') AND url = 'https://example.com'`)
+}
+
+func TestEscapeLike(t *testing.T) {
+	require.Equal(t, `100\%\_off\\`, escapeLike(`100%_off\`))
+	require.Equal(t, "example.com", escapeLike("example.com"))
+}
+
+func TestNewPostgresProvider_InitTimeout(t *testing.T) {
+	// A database that accepts connections but never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	start := time.Now()
+	_, err = NewPostgresProvider(shared.DbProviderConfig{
+		DbType: shared.DbTypePostgres,
+		ExtraDetails: map[string]interface{}{
+			"conn_str":     fmt.Sprintf("postgresql://user:pass@%s/guardz?sslmode=disable", listener.Addr()),
+			"init_timeout": "200ms",
+		},
+	}, zap.NewNop(), nil, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "init timeout 200ms")
+	require.Less(t, time.Since(start), 5*time.Second, "startup should fail fast")
+}
+
+func TestParseInitTimeout(t *testing.T) {
+	timeout, err := parseInitTimeout(nil)
+	require.NoError(t, err)
+	require.Equal(t, DefaultInitTimeout, timeout)
+
+	timeout, err = parseInitTimeout("5s")
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, timeout)
+
+	_, err = parseInitTimeout("soon")
+	require.Error(t, err)
+	_, err = parseInitTimeout(5)
+	require.Error(t, err)
+}
+
+func TestPostgresProvider_DeleteURLsForPath(t *testing.T) {
+	provider := newTestProvider(t)
+	ctx := context.Background()
+	path := fmt.Sprintf("delete-%d", time.Now().UnixNano())
+
+	require.ErrorIs(t, provider.DeleteURLsForPath(ctx, path), db_model.ErrPathNotFound)
+	require.NoError(t, provider.StoreURLsForPath(ctx, path, []string{"https://a.example.com", "https://b.example.com"}))
+	require.NoError(t, provider.DeleteURLsForPath(ctx, path))
+
+	records, err := provider.GetURLsByPath(ctx, path)
+	require.NoError(t, err)
+	require.Empty(t, records)
+	version, err := provider.GetPathVersion(ctx, path)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), version, "the path row is kept and its version bumped")
+	require.ErrorIs(t, provider.DeleteURLsForPath(ctx, path), db_model.ErrPathNotFound)
+}
+
+func TestPostgresProvider_StoreFetchResult(t *testing.T) {
+	provider := newTestProvider(t)
+	ctx := context.Background()
+	path := fmt.Sprintf("fetch-result-%d", time.Now().UnixNano())
+	require.NoError(t, provider.StoreURLsForPath(ctx, path, []string{"https://a.example.com"}))
+	before, err := provider.GetURLsByPath(ctx, path)
+	require.NoError(t, err)
+
+	fetchedAt := time.Now().UTC().Truncate(time.Microsecond)
+	require.NoError(t, provider.StoreFetchResult(ctx, path, db_model.URLRecord{
+		URL: "https://a.example.com", StatusCode: 200, Content: "hello", FetchedAt: fetchedAt,
+	}))
+
+	records, err := provider.GetURLsByPath(ctx, path)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, 200, records[0].StatusCode)
+	require.Equal(t, "hello", records[0].Content)
+	require.True(t, fetchedAt.Equal(records[0].FetchedAt))
+	require.True(t, before[0].UpdatedAt.Equal(records[0].UpdatedAt), "a fetch is not a change")
+}
+
+func TestPostgresProvider_ListPaths(t *testing.T) {
+	provider := newTestProvider(t)
+	ctx := context.Background()
+	prefix := fmt.Sprintf("list-%d-", time.Now().UnixNano())
+	require.NoError(t, provider.StoreURLsForPath(ctx, prefix+"b", []string{"https://b.example.com"}))
+	require.NoError(t, provider.StoreURLsForPath(ctx, prefix+"a", []string{"https://a.example.com"}))
+	require.NoError(t, provider.StoreURLsForPath(ctx, prefix+"empty", nil))
+
+	paths, err := provider.ListPaths(ctx)
+	require.NoError(t, err)
+	var ours []string
+	for _, path := range paths {
+		if strings.HasPrefix(path, prefix) {
+			ours = append(ours, path)
+		}
+	}
+	require.Equal(t, []string{prefix + "a", prefix + "b"}, ours)
+}
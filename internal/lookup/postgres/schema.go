@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// models are the tables the provider migrates. The GORM models are the only definition of
+// the schema, Schema renders the same migration as SQL.
+var models = []interface{}{&GormPath{}, &GormURL{}, &GormGeoIPRange{}}
+
+// backfilledColumns are the urls columns made NOT NULL after they were first created, with the
+// value older rows holding NULL get before the constraint is added
+var backfilledColumns = []struct {
+	name  string
+	value interface{}
+}{
+	{"timeout_ms", 0},
+	{"referer", ""},
+	{"origin", ""},
+}
+
+// migrate creates or updates the provider's tables, first repairing the rows of existing tables
+// the constraints would reject
+func migrate(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+	if err := backfill(db); err != nil {
+		return fmt.Errorf("failed to backfill existing rows: %w", err)
+	}
+	return db.AutoMigrate(models...)
+}
+
+// backfill prepares tables created by an older schema for the NOT NULL constraints and the
+// cascading foreign key. Fresh databases have nothing to repair.
+func backfill(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&GormPath{}) || !migrator.HasTable(&GormURL{}) {
+		return nil
+	}
+	var columns []string
+	for _, column := range backfilledColumns {
+		if migrator.HasColumn(&GormURL{}, column.name) {
+			columns = append(columns, column.name)
+		}
+	}
+	return repairRows(db, columns)
+}
+
+// repairRows sets NULLs in the given backfilled columns to their default, and deletes paths
+// without a path, URLs without a URL and URLs whose path no longer exists. Each statement is
+// idempotent, so a migration interrupted halfway is finished by the next start.
+func repairRows(db *gorm.DB, columns []string) error {
+	for _, column := range backfilledColumns {
+		if !slices.Contains(columns, column.name) {
+			continue
+		}
+		// UpdateColumn leaves updated_at alone
+		err := db.Model(&GormURL{}).Where(column.name+" IS NULL").UpdateColumn(column.name, column.value).Error
+		if err != nil {
+			return err
+		}
+	}
+	if err := db.Where("path IS NULL").Delete(&GormPath{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("url IS NULL").Delete(&GormURL{}).Error; err != nil {
+		return err
+	}
+	return db.Where("path_id IS NULL OR path_id NOT IN (?)", db.Model(&GormPath{}).Select("id")).Delete(&GormURL{}).Error
+}
+
+// Schema returns the SQL that creates the provider's tables, with every table name prefixed
+// like the table_prefix extra detail, for creating them ahead of time or reviewing a migration
+func Schema(tablePrefix string) (string, error) {
+	statements := &statementRecorder{}
+	config := newGormConfig(tablePrefix)
+	config.DryRun = true
+	config.DisableAutomaticPing = true
+	config.Logger = statements
+	db, err := gorm.Open(postgres.New(postgres.Config{}), config)
+	if err != nil {
+		return "", err
+	}
+	if err := db.Migrator().CreateTable(models...); err != nil {
+		return "", err
+	}
+	return strings.Join(statements.sql, ";\n") + ";\n", nil
+}
+
+// statementRecorder is a GORM logger collecting the SQL of a dry run
+type statementRecorder struct {
+	sql []string
+}
+
+func (r *statementRecorder) LogMode(logger.LogLevel) logger.Interface      { return r }
+func (r *statementRecorder) Info(context.Context, string, ...interface{})  {}
+func (r *statementRecorder) Warn(context.Context, string, ...interface{})  {}
+func (r *statementRecorder) Error(context.Context, string, ...interface{}) {}
+
+func (r *statementRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.sql = append(r.sql, sql)
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// createTableColumns returns the column names of table in the CREATE TABLE statement of sql
+func createTableColumns(t *testing.T, sql, table string) []string {
+	t.Helper()
+	stmt := regexp.MustCompile(`CREATE TABLE "` + regexp.QuoteMeta(table) + `" \((.*)\);`).FindStringSubmatch(sql)
+	require.NotNil(t, stmt, "no CREATE TABLE for %s", table)
+	var columns []string
+	for _, match := range regexp.MustCompile(`(?:^|,)"(\w+)" `).FindAllStringSubmatch(stmt[1], -1) {
+		columns = append(columns, match[1])
+	}
+	return columns
+}
+
+func TestSchema_SingleMigrationColumns(t *testing.T) {
+	sql, err := Schema("")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"id", "path", "version"}, createTableColumns(t, sql, "paths"))
+	require.Equal(t, []string{"id", "path_id", "url", "updated_at", "timeout_ms", "referer", "origin", "headers",
+		"status_code", "content", "fetch_error", "fetched_at"}, createTableColumns(t, sql, "urls"))
+	require.Contains(t, sql, `"path" text NOT NULL`)
+	require.Contains(t, sql, `CREATE UNIQUE INDEX IF NOT EXISTS "idx_paths_path" ON "paths" ("path")`)
+	require.Contains(t, sql, `"url" text NOT NULL`)
+	require.Contains(t, sql, `"headers" jsonb`)
+	require.Contains(t, sql, `FOREIGN KEY ("path_id") REFERENCES "paths"("id") ON DELETE CASCADE`)
+	require.Contains(t, sql, `CREATE INDEX IF NOT EXISTS "idx_urls_updated_at" ON "urls" ("updated_at")`)
+}
+
+func TestSchema_MatchesStoreModel(t *testing.T) {
+	sql, err := Schema("")
+	require.NoError(t, err)
+	columns := createTableColumns(t, sql, "urls")
+
+	// Every persisted field of the record the store layer hands out has a column
+	recordType := reflect.TypeOf(db_model.URLRecord{})
+	for i := 0; i < recordType.NumField(); i++ {
+		column := recordType.Field(i).Tag.Get("db_model")
+		if column == "" || column == "-" {
+			continue
+		}
+		require.Contains(t, columns, column)
+	}
+}
+
+func TestSchema_Prefixed(t *testing.T) {
+	sql, err := Schema("guardz_")
+	require.NoError(t, err)
+
+	require.Contains(t, sql, `CREATE TABLE "guardz_paths"`)
+	require.Contains(t, sql, `CREATE TABLE "guardz_urls"`)
+	require.Contains(t, sql, `REFERENCES "guardz_paths"("id")`)
+	require.NotContains(t, sql, `"paths"`)
+}
+
+func TestRepairRows_Statements(t *testing.T) {
+	statements := &statementRecorder{}
+	db := dryRunDB(t, "guardz_").Session(&gorm.Session{Logger: statements, SkipDefaultTransaction: true})
+
+	require.NoError(t, repairRows(db, []string{"timeout_ms", "origin"}))
+	require.Equal(t, []string{
+		`UPDATE "guardz_urls" SET "timeout_ms"=0 WHERE timeout_ms IS NULL`,
+		`UPDATE "guardz_urls" SET "origin"='' WHERE origin IS NULL`,
+		`DELETE FROM "guardz_paths" WHERE path IS NULL`,
+		`DELETE FROM "guardz_urls" WHERE url IS NULL`,
+		`DELETE FROM "guardz_urls" WHERE path_id IS NULL OR path_id NOT IN (SELECT "id" FROM "guardz_paths")`,
+	}, statements.sql, "columns an older schema lacks are left alone")
+}
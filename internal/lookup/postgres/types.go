@@ -1,23 +1,65 @@
 package postgres
 
+import (
+	"time"
+
+	"github.com/shaibs3/Guardz/internal/db_model"
+	"gorm.io/gorm/schema"
+)
+
 // GORM models for demonstration
 // (You can move these to a shared db package if you wish)
 type GormPath struct {
-	ID   uint64    `gorm:"primaryKey"`
-	Path string    `gorm:"uniqueIndex"`
-	URLs []GormURL `gorm:"foreignKey:PathID"`
+	ID      uint64    `gorm:"primaryKey"`
+	Path    string    `gorm:"uniqueIndex;not null"`
+	Version uint64    `gorm:"not null;default:0"`
+	URLs    []GormURL `gorm:"foreignKey:PathID;constraint:OnDelete:CASCADE"`
 }
 
-func (GormPath) TableName() string {
-	return "paths"
+// TableName resolves through the naming strategy so a configured table prefix or schema applies
+func (GormPath) TableName(namer schema.Namer) string {
+	return namer.TableName("path")
 }
 
 type GormURL struct {
-	ID     uint64 `gorm:"primaryKey"`
-	PathID uint64
-	URL    string
+	ID        uint64 `gorm:"primaryKey"`
+	PathID    uint64
+	URL       string            `gorm:"not null"`
+	UpdatedAt time.Time         `gorm:"index;not null;default:now()"`
+	TimeoutMs int               `gorm:"not null;default:0"`
+	Referer   string            `gorm:"not null;default:''"`
+	Origin    string            `gorm:"not null;default:''"`
+	Headers   map[string]string `gorm:"type:jsonb;serializer:json"`
+
+	// The latest fetch of the URL, when fetch results are persisted
+	StatusCode int    `gorm:"not null;default:0"`
+	Content    string `gorm:"not null;default:''"`
+	FetchError string `gorm:"not null;default:''"`
+	FetchedAt  *time.Time
+}
+
+// record converts the row to the URL record the store layer hands out
+func (u GormURL) record(path string) db_model.URLRecord {
+	record := db_model.URLRecord{
+		ID:         u.ID,
+		PathID:     u.PathID,
+		Path:       path,
+		URL:        u.URL,
+		UpdatedAt:  u.UpdatedAt,
+		TimeoutMs:  u.TimeoutMs,
+		Referer:    u.Referer,
+		Origin:     u.Origin,
+		Headers:    u.Headers,
+		StatusCode: u.StatusCode,
+		Content:    u.Content,
+		FetchError: u.FetchError,
+	}
+	if u.FetchedAt != nil {
+		record.FetchedAt = *u.FetchedAt
+	}
+	return record
 }
 
-func (GormURL) TableName() string {
-	return "urls"
+func (GormURL) TableName(namer schema.Namer) string {
+	return namer.TableName("url")
 }
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB opens a GORM handle that renders SQL without connecting to a database
+func dryRunDB(t *testing.T, tablePrefix string) *gorm.DB {
+	t.Helper()
+	config := newGormConfig(tablePrefix)
+	config.DryRun = true
+	config.DisableAutomaticPing = true
+	db, err := gorm.Open(postgres.Open("host=localhost user=guardz dbname=guardz"), config)
+	require.NoError(t, err)
+	return db
+}
+
+func TestTableNames_Default(t *testing.T) {
+	db := dryRunDB(t, "")
+
+	stmt := db.Where("path = ?", "p").Find(&[]GormPath{}).Statement
+	require.Contains(t, stmt.SQL.String(), `FROM "paths"`)
+
+	stmt = db.Where("path_id = ?", 1).Find(&[]GormURL{}).Statement
+	require.Contains(t, stmt.SQL.String(), `FROM "urls"`)
+}
+
+func TestTableNames_Prefixed(t *testing.T) {
+	db := dryRunDB(t, "guardz_")
+
+	stmt := db.Where("path = ?", "p").Find(&[]GormPath{}).Statement
+	require.Contains(t, stmt.SQL.String(), `FROM "guardz_paths"`)
+
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("path_id = ?", 1).Delete(&GormURL{})
+	})
+	require.Contains(t, sql, `DELETE FROM "guardz_urls"`)
+}
+
+func TestTableNames_Schema(t *testing.T) {
+	db := dryRunDB(t, "tenant.")
+
+	stmt := db.Where("path = ?", "p").Find(&[]GormPath{}).Statement
+	require.Contains(t, stmt.SQL.String(), `FROM "tenant"."paths"`)
+}
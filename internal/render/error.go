@@ -0,0 +1,71 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Error replies to the request with message and status, rendered as an HTML page when the
+// client prefers text/html and as JSON otherwise. Like http.Error, it does not end the
+// request; the caller should ensure no further writes are done to w.
+func Error(w http.ResponseWriter, r *http.Request, message string, status int) {
+	ErrorWithDetails(w, r, message, status, nil)
+}
+
+// ErrorWithDetails is like Error, adding details as extra fields of the JSON body.
+// The HTML page shows the message only.
+func ErrorWithDetails(w http.ResponseWriter, r *http.Request, message string, status int, details map[string]interface{}) {
+	h := w.Header()
+	// Headers set for a successful response must not describe the error body
+	h.Del("Content-Length")
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	if prefersHTML(r.Header.Get("Accept")) {
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		title := fmt.Sprintf("%d %s", status, http.StatusText(status))
+		_, _ = fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<p>%s</p>\n</body>\n</html>\n",
+			title, title, html.EscapeString(message))
+		return
+	}
+
+	h.Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	body := make(map[string]interface{}, len(details)+2)
+	for k, v := range details {
+		body[k] = v
+	}
+	body["error"] = message
+	body["status"] = status
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// prefersHTML reports whether the Accept header ranks text/html above application/json.
+// Ties, wildcards and a missing header all favour JSON.
+func prefersHTML(accept string) bool {
+	var htmlQ, jsonQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		case "application/json", "application/*", "*/*":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	return htmlQ > jsonQ
+}
@@ -0,0 +1,58 @@
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestError_NegotiatesContentType(t *testing.T) {
+	testCases := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{name: "no accept header", accept: "", contentType: "application/json"},
+		{name: "json", accept: "application/json", contentType: "application/json"},
+		{name: "html", accept: "text/html", contentType: "text/html; charset=utf-8"},
+		{name: "browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", contentType: "text/html; charset=utf-8"},
+		{name: "json preferred by weight", accept: "text/html;q=0.5, application/json", contentType: "application/json"},
+		{name: "tie favours json", accept: "text/html, application/json", contentType: "application/json"},
+		{name: "wildcard", accept: "*/*", contentType: "application/json"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			w := httptest.NewRecorder()
+			Error(w, req, "No URL <provided>", http.StatusBadRequest)
+
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			require.Equal(t, tc.contentType, w.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestError_Bodies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	ErrorWithDetails(w, req, "All URLs are invalid", http.StatusBadRequest, map[string]interface{}{"invalid_urls": []string{"ftp://x"}})
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "All URLs are invalid", body["error"])
+	require.Equal(t, float64(http.StatusBadRequest), body["status"])
+	require.Equal(t, []interface{}{"ftp://x"}, body["invalid_urls"])
+
+	req.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
+	Error(w, req, "No URL <provided>", http.StatusNotFound)
+	require.Contains(t, w.Body.String(), "<h1>404 Not Found</h1>")
+	require.Contains(t, w.Body.String(), "No URL &lt;provided&gt;", "the message must be escaped")
+}
@@ -0,0 +1,40 @@
+package request_id
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// maxLength bounds inbound request IDs; longer ones are replaced with a generated ID
+const maxLength = 128
+
+// contextKey carries the request ID on a request context
+type contextKey struct{}
+
+// NewContext returns a context carrying id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or "" if there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Resolve returns the inbound ID when it is usable, otherwise a newly generated one
+func Resolve(inbound string) string {
+	if inbound != "" && len(inbound) <= maxLength {
+		return inbound
+	}
+	return Generate()
+}
+
+// Generate returns a random 32 character hex ID
+func Generate() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never returns an error on supported platforms
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
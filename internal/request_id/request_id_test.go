@@ -0,0 +1,24 @@
+package request_id
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	require.Equal(t, "abc-123", Resolve("abc-123"), "a usable inbound ID is kept")
+
+	generated := Resolve("")
+	require.Len(t, generated, 32)
+	require.NotEqual(t, generated, Resolve(""))
+
+	require.Len(t, Resolve(strings.Repeat("x", maxLength+1)), 32, "oversized IDs are replaced")
+}
+
+func TestContext(t *testing.T) {
+	require.Empty(t, FromContext(context.Background()))
+	require.Equal(t, "abc", FromContext(NewContext(context.Background(), "abc")))
+}
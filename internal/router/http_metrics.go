@@ -1,6 +1,7 @@
 package router
 
 import (
+	"github.com/shaibs3/Guardz/internal/telemetry"
 	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 )
@@ -14,9 +15,10 @@ type HTTPMetrics struct {
 	RateLimitedRequests metric.Int64Counter
 }
 
-func NewHTTPMetrics(meter metric.Meter, logger *zap.Logger) *HTTPMetrics {
+// NewHTTPMetrics creates the HTTP instruments, prefixing their names with namespace when set
+func NewHTTPMetrics(meter metric.Meter, namespace string, logger *zap.Logger) *HTTPMetrics {
 	requestDuration, err := meter.Float64Histogram(
-		"http_request_duration_seconds",
+		telemetry.MetricName(namespace, "http_request_duration_seconds"),
 		metric.WithDescription("HTTP request duration in seconds"),
 		metric.WithUnit("s"),
 	)
@@ -25,7 +27,7 @@ func NewHTTPMetrics(meter metric.Meter, logger *zap.Logger) *HTTPMetrics {
 	}
 
 	requestCount, err := meter.Int64Counter(
-		"http_requests_total",
+		telemetry.MetricName(namespace, "http_requests_total"),
 		metric.WithDescription("Total number of HTTP requests"),
 		metric.WithUnit("1"),
 	)
@@ -34,7 +36,7 @@ func NewHTTPMetrics(meter metric.Meter, logger *zap.Logger) *HTTPMetrics {
 	}
 
 	errorRequests, err := meter.Int64Counter(
-		"http_error_requests_total",
+		telemetry.MetricName(namespace, "http_error_requests_total"),
 		metric.WithDescription("Total number of HTTP error requests (4xx, 5xx)"),
 		metric.WithUnit("1"),
 	)
@@ -43,7 +45,7 @@ func NewHTTPMetrics(meter metric.Meter, logger *zap.Logger) *HTTPMetrics {
 	}
 
 	responseStatus, err := meter.Int64Counter(
-		"http_response_status_total",
+		telemetry.MetricName(namespace, "http_response_status_total"),
 		metric.WithDescription("Total number of HTTP responses by status code"),
 		metric.WithUnit("1"),
 	)
@@ -52,7 +54,7 @@ func NewHTTPMetrics(meter metric.Meter, logger *zap.Logger) *HTTPMetrics {
 	}
 
 	activeRequests, err := meter.Int64UpDownCounter(
-		"http_requests_in_flight",
+		telemetry.MetricName(namespace, "http_requests_in_flight"),
 		metric.WithDescription("Number of HTTP requests currently in flight"),
 		metric.WithUnit("1"),
 	)
@@ -61,7 +63,7 @@ func NewHTTPMetrics(meter metric.Meter, logger *zap.Logger) *HTTPMetrics {
 	}
 
 	rateLimitedRequests, err := meter.Int64Counter(
-		"http_rate_limited_requests_total",
+		telemetry.MetricName(namespace, "http_rate_limited_requests_total"),
 		metric.WithDescription("Total number of HTTP requests that were rate limited"),
 		metric.WithUnit("1"),
 	)
@@ -0,0 +1,37 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+)
+
+func TestNewHTTPMetrics_Namespace(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	metrics := NewHTTPMetrics(meter, "guardz", zap.NewNop())
+	metrics.RequestCount.Add(ctx, 1)
+	metrics.RequestDuration.Record(ctx, 0.1)
+	metrics.RateLimitedRequests.Add(ctx, 1)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+
+	var names []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names = append(names, m.Name)
+		}
+	}
+	require.ElementsMatch(t, []string{
+		"guardz_http_requests_total",
+		"guardz_http_request_duration_seconds",
+		"guardz_http_rate_limited_requests_total",
+	}, names)
+}
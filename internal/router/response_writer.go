@@ -16,3 +16,8 @@ func (rw *ResponseWriter) Write(b []byte) (int, error) {
 	size, err := rw.ResponseWriter.Write(b)
 	return size, err
 }
+
+// Unwrap exposes the underlying writer so http.ResponseController can flush streamed responses
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
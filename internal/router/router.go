@@ -1,12 +1,17 @@
 package router
 
 import (
+	"context"
+	"math"
 	"net/http"
+	"regexp"
 	"strconv"
 	"time"
 
 	"golang.org/x/time/rate"
 
+	"github.com/shaibs3/Guardz/internal/render"
+	"github.com/shaibs3/Guardz/internal/request_id"
 	"github.com/shaibs3/Guardz/internal/service_health"
 	"github.com/shaibs3/Guardz/internal/telemetry"
 
@@ -14,6 +19,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -24,22 +30,44 @@ type Handler interface {
 
 // Router handles all routing logic and middleware setup
 type Router struct {
+	// RateLimitMaxWait is how long a rate-limited request may be queued waiting for a token
+	// before being rejected with 429. Zero rejects immediately.
+	RateLimitMaxWait time.Duration
+
+	// RetryAfterMax caps the Retry-After advertised on 429 responses. Zero leaves it uncapped.
+	RetryAfterMax time.Duration
+
+	// RequestIDHeader names the header carrying the request ID. When set, every request is given an ID,
+	// taken from this header or generated, which is echoed on the response and carried on the request context.
+	RequestIDHeader string
+
+	// SlowRequestThreshold, when positive, additionally logs requests taking longer than it at Warn
+	SlowRequestThreshold time.Duration
+
+	// Watchdog, when set, tracks request progress and fails liveness if the request path stalls
+	Watchdog *service_health.Watchdog
+
+	// ReadinessProbe, when set, checks a dependency such as the database and fails readiness while it is down
+	ReadinessProbe *service_health.ReadinessProbe
+
 	router        *mux.Router
 	rateLimiter   *rate.Limiter
 	logger        *zap.Logger
 	routerMetrics *HTTPMetrics
+	tracer        trace.Tracer
 	handlers      []Handler
 }
 
 // NewRouter creates a new router instance
 func NewRouter(rateLimiter *rate.Limiter, telemetry *telemetry.Telemetry, logger *zap.Logger, handlers []Handler) *Router {
-	httpMetrics := NewHTTPMetrics(telemetry.Meter, logger.Named("metrics"))
+	httpMetrics := NewHTTPMetrics(telemetry.Meter, telemetry.MetricsNamespace, logger.Named("metrics"))
 
 	r := &Router{
 		router:        mux.NewRouter(),
 		rateLimiter:   rateLimiter,
 		logger:        logger.Named("router"),
 		routerMetrics: httpMetrics,
+		tracer:        telemetry.Tracer,
 		handlers:      handlers,
 	}
 	return r
@@ -78,8 +106,8 @@ func (router *Router) setupRoutes() {
 	router.logger.Info("setting up application routes")
 
 	// Health check endpoints
-	router.router.HandleFunc("/health/live", service_health.LivenessHandler(router.logger)).Methods("GET", "HEAD")
-	router.router.HandleFunc("/health/ready", service_health.ReadinessHandler(router.logger)).Methods("GET", "HEAD")
+	router.router.HandleFunc("/health/live", service_health.LivenessHandler(router.logger, router.Watchdog)).Methods("GET", "HEAD")
+	router.router.HandleFunc("/health/ready", service_health.ReadinessHandler(router.logger, router.ReadinessProbe)).Methods("GET", "HEAD")
 
 	// Metrics endpoint
 	router.router.Handle("/metrics", promhttp.Handler()).Methods("GET")
@@ -96,12 +124,14 @@ func (router *Router) setupRoutes() {
 func (router *Router) setupMiddleware() http.Handler {
 	router.logger.Info("setting up middleware")
 
-	// Apply middlewares in order: metrics -> rate limiting -> router
-	metricsHandler := router.metricsMiddleware(router.logger.Named("metrics"))(router.router)
+	// Apply middlewares in order: request ID -> rate limiting -> metrics -> watchdog -> router
+	watchedRouter := router.watchdogMiddleware(router.router)
+	metricsHandler := router.metricsMiddleware(router.logger.Named("metrics"))(watchedRouter)
 	rateLimitedRouter := router.rateLimitMiddleware(metricsHandler)
+	identifiedRouter := router.requestIDMiddleware(rateLimitedRouter)
 
 	router.logger.Info("middleware configured successfully")
-	return rateLimitedRouter
+	return identifiedRouter
 }
 
 // MetricsMiddleware creates middleware for comprehensive HTTP metrics
@@ -110,6 +140,22 @@ func (router *Router) metricsMiddleware(logger *zap.Logger) func(http.Handler) h
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 
+			// Start a request span; whether it is recorded is up to the sampler. It is named by
+			// route template so paths do not each make their own span name.
+			spanName := r.Method
+			route := router.routeTemplate(r)
+			if route != "" {
+				spanName += " " + route
+			}
+			ctx, span := router.tracer.Start(r.Context(), spanName,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.route", route),
+					attribute.String("url.path", r.URL.Path),
+				))
+			defer span.End()
+			r = r.WithContext(ctx)
+
 			// Increment active requests
 			if router.routerMetrics.ActiveRequests != nil {
 				router.routerMetrics.ActiveRequests.Add(r.Context(), 1)
@@ -124,6 +170,7 @@ func (router *Router) metricsMiddleware(logger *zap.Logger) func(http.Handler) h
 
 			// Record metrics
 			duration := time.Since(start)
+			span.SetAttributes(attribute.Int("http.status_code", wrappedWriter.statusCode))
 
 			attrs := []attribute.KeyValue{
 				attribute.String("method", r.Method),
@@ -165,11 +212,69 @@ func (router *Router) metricsMiddleware(logger *zap.Logger) func(http.Handler) h
 				zap.Int("status_code", wrappedWriter.statusCode),
 				zap.Duration("duration", duration),
 				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("request_id", request_id.FromContext(r.Context())),
 			)
+
+			if router.SlowRequestThreshold > 0 && duration > router.SlowRequestThreshold {
+				logger.Warn("slow request",
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.Int("status_code", wrappedWriter.statusCode),
+					zap.Duration("duration", duration),
+					zap.Duration("threshold", router.SlowRequestThreshold),
+					zap.String("request_id", request_id.FromContext(r.Context())),
+				)
+			}
 		})
 	}
 }
 
+// routeVariablePattern matches the pattern of a route variable, as in {path:.*}
+var routeVariablePattern = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// routeTemplate returns the path template of the route r matches with variable patterns
+// dropped, such as "/{path}", or "" when it matches none
+func (router *Router) routeTemplate(r *http.Request) string {
+	var match mux.RouteMatch
+	if !router.router.Match(r, &match) || match.Route == nil {
+		return ""
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return routeVariablePattern.ReplaceAllString(template, "{$1}")
+}
+
+// requestIDMiddleware gives every request an ID, if a RequestIDHeader is configured
+func (router *Router) requestIDMiddleware(next http.Handler) http.Handler {
+	if router.RequestIDHeader == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := request_id.Resolve(r.Header.Get(router.RequestIDHeader))
+		w.Header().Set(router.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(request_id.NewContext(r.Context(), id)))
+	})
+}
+
+// watchdogMiddleware reports request progress to the watchdog, if one is configured
+func (router *Router) watchdogMiddleware(next http.Handler) http.Handler {
+	if router.Watchdog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Probes and scrapes are not application progress
+		if r.URL.Path == "/metrics" || r.URL.Path == "/health/live" || r.URL.Path == "/health/ready" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		router.Watchdog.Begin()
+		defer router.Watchdog.End()
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (router *Router) rateLimitMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Skip rate limiting for health check and metrics endpoints
@@ -179,13 +284,49 @@ func (router *Router) rateLimitMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		if !router.rateLimiter.Allow() {
+		if !router.acquireToken(r) {
 			if router.routerMetrics != nil && router.routerMetrics.RateLimitedRequests != nil {
 				router.routerMetrics.RateLimitedRequests.Add(r.Context(), 1)
 			}
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			if retryAfter, ok := router.retryAfter(); ok {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			}
+			render.Error(w, r, "Too Many Requests", http.StatusTooManyRequests)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// retryAfter estimates in whole seconds how long until a token is available, capped at RetryAfterMax.
+// It reports false when no token will ever be available and there is no cap to advertise instead.
+func (router *Router) retryAfter() (int, bool) {
+	reservation := router.rateLimiter.Reserve()
+	delay := reservation.Delay()
+	// Only asking, the token is not taken
+	reservation.Cancel()
+
+	if router.RetryAfterMax > 0 && delay > router.RetryAfterMax {
+		delay = router.RetryAfterMax
+	}
+	if delay == rate.InfDuration {
+		return 0, false
+	}
+	seconds := int(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds, true
+}
+
+// acquireToken takes a rate limiter token, queuing for up to RateLimitMaxWait when none is available
+func (router *Router) acquireToken(r *http.Request) bool {
+	if router.RateLimitMaxWait <= 0 {
+		return router.rateLimiter.Allow()
+	}
+
+	// Wait fails straight away when the required delay would exceed the deadline
+	ctx, cancel := context.WithTimeout(r.Context(), router.RateLimitMaxWait)
+	defer cancel()
+	return router.rateLimiter.Wait(ctx) == nil
+}
@@ -0,0 +1,249 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shaibs3/Guardz/internal/request_id"
+	"github.com/shaibs3/Guardz/internal/service_health"
+	"github.com/shaibs3/Guardz/internal/telemetry"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/time/rate"
+)
+
+// okHandler registers a single route answering 200
+type okHandler struct{}
+
+func (okHandler) RegisterRoutes(router *mux.Router, logger *zap.Logger) {
+	router.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+}
+
+func newTestServer(t *testing.T, limiter *rate.Limiter, configure func(*Router)) http.Handler {
+	t.Helper()
+	logger := zap.NewNop()
+	tel, err := telemetry.NewTelemetry(logger)
+	require.NoError(t, err)
+	r := NewRouter(limiter, tel, logger, []Handler{okHandler{}})
+	if configure != nil {
+		configure(r)
+	}
+	return r.CreateServer(":0").Handler
+}
+
+func serve(handler http.Handler, path string) int {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Code
+}
+
+func TestRateLimit_ImmediateRejectionByDefault(t *testing.T) {
+	handler := newTestServer(t, rate.NewLimiter(rate.Limit(1), 1), nil)
+
+	require.Equal(t, http.StatusOK, serve(handler, "/ok"))
+	require.Equal(t, http.StatusTooManyRequests, serve(handler, "/ok"), "without a max wait the request is rejected at once")
+}
+
+func TestRateLimit_ShortBurstIsQueued(t *testing.T) {
+	// 20 tokens per second: each extra request waits ~50ms, within the 200ms grace
+	handler := newTestServer(t, rate.NewLimiter(rate.Limit(20), 1), func(r *Router) {
+		r.RateLimitMaxWait = 200 * time.Millisecond
+	})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusOK, serve(handler, "/ok"), "burst request %d should be queued and served", i)
+	}
+	require.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond, "queued requests should have waited for tokens")
+}
+
+func TestRateLimit_SustainedFloodStill429s(t *testing.T) {
+	// 1 token per second: the next token is far beyond the 100ms grace
+	handler := newTestServer(t, rate.NewLimiter(rate.Limit(1), 1), func(r *Router) {
+		r.RateLimitMaxWait = 100 * time.Millisecond
+	})
+
+	require.Equal(t, http.StatusOK, serve(handler, "/ok"))
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusTooManyRequests, serve(handler, "/ok"), "flood request %d should be rejected", i)
+	}
+	require.Less(t, time.Since(start), 100*time.Millisecond, "requests that cannot be served in time should not wait")
+}
+
+func TestRateLimit_RetryAfterIsClamped(t *testing.T) {
+	// One token every ~17 minutes, far beyond the cap
+	limiter := rate.NewLimiter(rate.Limit(0.001), 1)
+	handler := newTestServer(t, limiter, func(r *Router) {
+		r.RetryAfterMax = 30 * time.Second
+	})
+
+	require.Equal(t, http.StatusOK, serve(handler, "/ok"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// Below the cap the computed delay is advertised as-is
+	handler = newTestServer(t, rate.NewLimiter(rate.Limit(0.1), 1), func(r *Router) {
+		r.RetryAfterMax = 30 * time.Second
+	})
+	require.Equal(t, http.StatusOK, serve(handler, "/ok"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	require.Equal(t, "10", w.Header().Get("Retry-After"))
+}
+
+// requestIDHandler registers a route answering with the request ID found on its context
+type requestIDHandler struct{}
+
+func (requestIDHandler) RegisterRoutes(router *mux.Router, logger *zap.Logger) {
+	router.HandleFunc("/id", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(request_id.FromContext(r.Context())))
+	}).Methods("GET")
+}
+
+func TestRequestID_PropagatedOnContext(t *testing.T) {
+	logger := zap.NewNop()
+	tel, err := telemetry.NewTelemetry(logger)
+	require.NoError(t, err)
+	r := NewRouter(rate.NewLimiter(rate.Inf, 1), tel, logger, []Handler{requestIDHandler{}})
+	r.RequestIDHeader = "X-Request-ID"
+	handler := r.CreateServer(":0").Handler
+
+	req := httptest.NewRequest(http.MethodGet, "/id", nil)
+	req.Header.Set("X-Request-ID", "inbound-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, "inbound-1", w.Body.String())
+	require.Equal(t, "inbound-1", w.Header().Get("X-Request-ID"))
+
+	// Without an inbound ID one is generated
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/id", nil))
+	require.Len(t, w.Body.String(), 32)
+	require.Equal(t, w.Body.String(), w.Header().Get("X-Request-ID"))
+}
+
+// blockingHandler registers a route that blocks until release is closed
+type blockingHandler struct {
+	release chan struct{}
+}
+
+func (b blockingHandler) RegisterRoutes(router *mux.Router, logger *zap.Logger) {
+	router.HandleFunc("/block", func(w http.ResponseWriter, r *http.Request) {
+		<-b.release
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+}
+
+func TestLiveness_FailsWhenRequestPathStalls(t *testing.T) {
+	logger := zap.NewNop()
+	tel, err := telemetry.NewTelemetry(logger)
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	r := NewRouter(rate.NewLimiter(rate.Inf, 1), tel, logger, []Handler{blockingHandler{release: release}})
+	r.Watchdog = service_health.NewWatchdog(50 * time.Millisecond)
+	handler := r.CreateServer(":0").Handler
+
+	require.Equal(t, http.StatusOK, serve(handler, "/health/live"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(handler, "/block")
+	}()
+
+	require.Eventually(t, func() bool {
+		return serve(handler, "/health/live") == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond, "liveness should fail while the handler is stalled")
+
+	close(release)
+	<-done
+	require.Equal(t, http.StatusOK, serve(handler, "/health/live"), "liveness recovers once requests complete")
+}
+
+// slowHandler registers a fast route and one that sleeps for delay
+type slowHandler struct {
+	delay time.Duration
+}
+
+func (s slowHandler) RegisterRoutes(router *mux.Router, logger *zap.Logger) {
+	router.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(s.delay)
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+}
+
+func TestSlowRequestThreshold_WarnsOnlyForSlowRequests(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+	tel, err := telemetry.NewTelemetry(zap.NewNop())
+	require.NoError(t, err)
+	r := NewRouter(rate.NewLimiter(rate.Inf, 1), tel, logger, []Handler{slowHandler{delay: 100 * time.Millisecond}})
+	r.SlowRequestThreshold = 50 * time.Millisecond
+	handler := r.CreateServer(":0").Handler
+
+	require.Equal(t, http.StatusOK, serve(handler, "/fast"))
+	require.Zero(t, logs.FilterMessage("slow request").Len(), "a fast request is not reported as slow")
+
+	require.Equal(t, http.StatusOK, serve(handler, "/slow"))
+	slow := logs.FilterMessage("slow request").All()
+	require.Len(t, slow, 1)
+	require.Equal(t, zap.WarnLevel, slow[0].Level)
+	require.Equal(t, "/slow", slow[0].ContextMap()["path"])
+	require.GreaterOrEqual(t, slow[0].ContextMap()["duration"], 100*time.Millisecond)
+
+	// Every request is still logged as completed
+	require.Equal(t, 2, logs.FilterMessage("request completed").Len())
+}
+
+// pathHandler registers a catch-all route like the dynamic handler's
+type pathHandler struct{}
+
+func (pathHandler) RegisterRoutes(router *mux.Router, logger *zap.Logger) {
+	router.HandleFunc("/{path:.*}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+}
+
+func TestMetricsMiddleware_NamesSpansByRoute(t *testing.T) {
+	logger := zap.NewNop()
+	tel, err := telemetry.NewTelemetry(logger)
+	require.NoError(t, err)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	r := NewRouter(rate.NewLimiter(rate.Inf, 1), tel, logger, []Handler{pathHandler{}})
+	r.tracer = tp.Tracer("test")
+	handler := r.CreateServer(":0").Handler
+
+	require.Equal(t, http.StatusOK, serve(handler, "/users/1"))
+	require.Equal(t, http.StatusOK, serve(handler, "/users/2"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/3", nil))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	for i, path := range []string{"/users/1", "/users/2"} {
+		require.Equal(t, "GET /{path}", spans[i].Name, "paths share the span name of their route")
+		attrs := make(map[string]string)
+		for _, attr := range spans[i].Attributes {
+			attrs[string(attr.Key)] = attr.Value.Emit()
+		}
+		require.Equal(t, "/{path}", attrs["http.route"])
+		require.Equal(t, path, attrs["url.path"])
+	}
+	require.Equal(t, "PUT", spans[2].Name, "unmatched requests are named by method alone")
+}
@@ -7,14 +7,23 @@ import (
 	"time"
 )
 
-// LivenessHandler checks if the service is alive
-func LivenessHandler(logger *zap.Logger) http.HandlerFunc {
+// LivenessHandler checks if the service is alive.
+// When a watchdog is given, liveness fails while the request path is stalled.
+func LivenessHandler(logger *zap.Logger, watchdog *Watchdog) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+
+		status := "alive"
+		if watchdog != nil && watchdog.Stalled() {
+			status = "stalled"
+			logger.Warn("liveness check failed - no request progress within the watchdog window")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
 
 		response := HealthResponse{
-			Status:    "alive",
+			Status:    status,
 			Timestamp: time.Now(),
 			Service:   "guardz",
 		}
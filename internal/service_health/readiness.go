@@ -8,11 +8,11 @@ import (
 	"time"
 )
 
-// ReadinessHandler checks if the service is ready to serve requests
-func ReadinessHandler(logger *zap.Logger) http.HandlerFunc {
+// ReadinessHandler checks if the service is ready to serve requests.
+// When a probe is given, readiness fails while its dependency check fails.
+func ReadinessHandler(logger *zap.Logger, probe *ReadinessProbe) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
 
 		// Check if the provider is properly initialized
 		// This is a placeholder check; replace with actual provider initialization logic
@@ -23,6 +23,16 @@ func ReadinessHandler(logger *zap.Logger) http.HandlerFunc {
 			logger.Warn("service not ready - missing DB_PROVIDER configuration")
 		}
 
+		code := http.StatusOK
+		if probe != nil {
+			if err := probe.Check(r.Context()); err != nil {
+				status = "not ready"
+				code = http.StatusServiceUnavailable
+				logger.Warn("service not ready - dependency check failed", zap.Error(err))
+			}
+		}
+		w.WriteHeader(code)
+
 		response := HealthResponse{
 			Status:    status,
 			Timestamp: time.Now(),
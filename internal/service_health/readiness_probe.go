@@ -0,0 +1,66 @@
+package service_health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// readinessCheckTimeout bounds a single dependency check
+const readinessCheckTimeout = 5 * time.Second
+
+// ReadinessProbe runs a dependency check, such as a database ping, on behalf of readiness
+// requests. Its result is reused for the cache interval and concurrent probes wait for the
+// check already running, so aggressive probing runs at most one check per interval.
+type ReadinessProbe struct {
+	check    func(ctx context.Context) error
+	interval time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+	inFlight  chan struct{}
+}
+
+// NewReadinessProbe creates a probe running check at most once per interval
+func NewReadinessProbe(check func(ctx context.Context) error, interval time.Duration) *ReadinessProbe {
+	return &ReadinessProbe{check: check, interval: interval}
+}
+
+// Check returns the outcome of the dependency check, running it only when the cached
+// outcome is older than the interval and no other probe is already running it
+func (p *ReadinessProbe) Check(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.checkedAt.IsZero() && time.Since(p.checkedAt) < p.interval {
+		err := p.err
+		p.mu.Unlock()
+		return err
+	}
+	if wait := p.inFlight; wait != nil {
+		p.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.err
+	}
+	done := make(chan struct{})
+	p.inFlight = done
+	p.mu.Unlock()
+
+	// Other probes share this check, so it must not end with the request that started it
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), readinessCheckTimeout)
+	err := p.check(checkCtx)
+	cancel()
+
+	p.mu.Lock()
+	p.err = err
+	p.checkedAt = time.Now()
+	p.inFlight = nil
+	p.mu.Unlock()
+	close(done)
+	return err
+}
@@ -0,0 +1,73 @@
+package service_health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestReadinessProbe_CoalescesConcurrentChecks(t *testing.T) {
+	var pings atomic.Int32
+	probe := NewReadinessProbe(func(ctx context.Context) error {
+		pings.Add(1)
+		// Hold the ping so every probe arrives while it is running
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}, time.Minute)
+	handler := ReadinessHandler(zap.NewNop(), probe)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	require.Equal(t, int32(1), pings.Load(), "concurrent probes should share one ping")
+	for code := range codes {
+		require.Equal(t, http.StatusOK, code)
+	}
+}
+
+func TestReadinessProbe_CachesForInterval(t *testing.T) {
+	var pings atomic.Int32
+	pingErr := errors.New("connection refused")
+	probe := NewReadinessProbe(func(ctx context.Context) error {
+		pings.Add(1)
+		return pingErr
+	}, 50*time.Millisecond)
+
+	require.ErrorIs(t, probe.Check(context.Background()), pingErr)
+	require.ErrorIs(t, probe.Check(context.Background()), pingErr, "a failure is cached too")
+	require.Equal(t, int32(1), pings.Load())
+
+	time.Sleep(60 * time.Millisecond)
+	require.ErrorIs(t, probe.Check(context.Background()), pingErr)
+	require.Equal(t, int32(2), pings.Load(), "the ping runs again once the interval has passed")
+}
+
+func TestReadinessHandler_FailsWhileCheckFails(t *testing.T) {
+	probe := NewReadinessProbe(func(ctx context.Context) error {
+		return errors.New("database is down")
+	}, time.Minute)
+
+	w := httptest.NewRecorder()
+	ReadinessHandler(zap.NewNop(), probe)(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Contains(t, w.Body.String(), `"status":"not ready"`)
+}
@@ -0,0 +1,44 @@
+package service_health
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Watchdog detects a wedged request path. The request path reports each request's
+// start and end; while requests are in flight, at least one must complete within
+// the window or the service is considered stalled.
+type Watchdog struct {
+	window       time.Duration
+	inFlight     atomic.Int64
+	lastProgress atomic.Int64 // unix nanoseconds
+}
+
+// NewWatchdog creates a watchdog that reports a stall after window without progress under load
+func NewWatchdog(window time.Duration) *Watchdog {
+	w := &Watchdog{window: window}
+	w.lastProgress.Store(time.Now().UnixNano())
+	return w
+}
+
+// Begin records that a request started
+func (w *Watchdog) Begin() {
+	if w.inFlight.Add(1) == 1 {
+		// An idle service has made no progress to measure, start the clock now
+		w.lastProgress.Store(time.Now().UnixNano())
+	}
+}
+
+// End records that a request finished, which counts as progress
+func (w *Watchdog) End() {
+	w.lastProgress.Store(time.Now().UnixNano())
+	w.inFlight.Add(-1)
+}
+
+// Stalled reports whether requests are in flight but none has completed within the window
+func (w *Watchdog) Stalled() bool {
+	if w.inFlight.Load() == 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, w.lastProgress.Load())) > w.window
+}
@@ -0,0 +1,28 @@
+package service_health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdog_Stalled(t *testing.T) {
+	w := NewWatchdog(20 * time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	require.False(t, w.Stalled(), "an idle service is not stalled")
+
+	w.Begin()
+	require.False(t, w.Stalled(), "the window starts when load arrives")
+	time.Sleep(30 * time.Millisecond)
+	require.True(t, w.Stalled(), "no progress within the window under load")
+
+	w.Begin()
+	w.End()
+	require.False(t, w.Stalled(), "a completed request is progress")
+
+	w.End()
+	time.Sleep(30 * time.Millisecond)
+	require.False(t, w.Stalled())
+}
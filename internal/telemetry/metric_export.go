@@ -0,0 +1,109 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// MetricExport configures pushing metrics to an exporter, such as OTLP, next to the
+// Prometheus scrape endpoint
+type MetricExport struct {
+	// Exporter receives the pushed metrics. Nil disables pushing.
+	Exporter sdkmetric.Exporter
+
+	// Interval is how often metrics are pushed. Zero keeps the SDK default of one minute.
+	Interval time.Duration
+
+	// BatchSize caps the metrics sent in one export call, splitting larger collections into
+	// several calls. Zero sends every metric in one call.
+	BatchSize int
+}
+
+// NewOTLPMetricExporter creates an exporter pushing metrics over OTLP/HTTP to endpoint, a URL
+// such as http://collector:4318. An empty endpoint returns a nil exporter, which disables pushing.
+func NewOTLPMetricExporter(ctx context.Context, endpoint string) (sdkmetric.Exporter, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	if err := checkOTLPEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	return otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(endpoint))
+}
+
+// checkOTLPEndpoint rejects endpoints that are not absolute http or https URLs, which the OTLP
+// exporters would otherwise ignore in favour of their default endpoint
+func checkOTLPEndpoint(endpoint string) error {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("endpoint %q must be an http or https URL", endpoint)
+	}
+	return nil
+}
+
+// newPeriodicReader creates the reader pushing metrics to export.Exporter every export.Interval
+func newPeriodicReader(export MetricExport) *sdkmetric.PeriodicReader {
+	exporter := export.Exporter
+	if export.BatchSize > 0 {
+		exporter = &batchingExporter{Exporter: exporter, size: export.BatchSize}
+	}
+	var opts []sdkmetric.PeriodicReaderOption
+	if export.Interval > 0 {
+		opts = append(opts, sdkmetric.WithInterval(export.Interval))
+	}
+	return sdkmetric.NewPeriodicReader(exporter, opts...)
+}
+
+// batchingExporter hands its exporter at most size metrics per export call
+type batchingExporter struct {
+	sdkmetric.Exporter
+	size int
+}
+
+// Export exports rm in batches, carrying on past failed batches so one rejected batch does
+// not drop the rest
+func (e *batchingExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	var errs []error
+	for _, batch := range splitMetrics(rm, e.size) {
+		if err := e.Exporter.Export(ctx, batch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// splitMetrics splits rm into collections of at most size metrics, keeping every metric
+// under its instrumentation scope. A collection without metrics is returned as is.
+func splitMetrics(rm *metricdata.ResourceMetrics, size int) []*metricdata.ResourceMetrics {
+	var batches []*metricdata.ResourceMetrics
+	current := &metricdata.ResourceMetrics{Resource: rm.Resource}
+	count := 0
+	for _, scope := range rm.ScopeMetrics {
+		metrics := scope.Metrics
+		for len(metrics) > 0 {
+			if count == size {
+				batches = append(batches, current)
+				current = &metricdata.ResourceMetrics{Resource: rm.Resource}
+				count = 0
+			}
+			n := min(size-count, len(metrics))
+			current.ScopeMetrics = append(current.ScopeMetrics, metricdata.ScopeMetrics{
+				Scope:   scope.Scope,
+				Metrics: metrics[:n],
+			})
+			metrics = metrics[n:]
+			count += n
+		}
+	}
+	return append(batches, current)
+}
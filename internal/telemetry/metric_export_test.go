@@ -0,0 +1,133 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// recordingExporter records the number of metrics of every export call
+type recordingExporter struct {
+	mu      sync.Mutex
+	exports []int
+}
+
+func (e *recordingExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+func (e *recordingExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (e *recordingExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	count := 0
+	for _, scope := range rm.ScopeMetrics {
+		count += len(scope.Metrics)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.exports = append(e.exports, count)
+	return nil
+}
+
+func (e *recordingExporter) ForceFlush(context.Context) error { return nil }
+func (e *recordingExporter) Shutdown(context.Context) error   { return nil }
+
+func (e *recordingExporter) exported() []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]int(nil), e.exports...)
+}
+
+func TestNewPeriodicReader_Interval(t *testing.T) {
+	exporter := &recordingExporter{}
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(newPeriodicReader(MetricExport{
+		Exporter: exporter,
+		Interval: 20 * time.Millisecond,
+	})))
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+
+	counter, err := provider.Meter("test").Int64Counter("requests_total")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 1)
+
+	// The SDK default interval is a minute, so repeated pushes come from the configured one
+	require.Eventually(t, func() bool {
+		return len(exporter.exported()) >= 3
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestNewPeriodicReader_BatchSize(t *testing.T) {
+	exporter := &recordingExporter{}
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(newPeriodicReader(MetricExport{
+		Exporter:  exporter,
+		BatchSize: 2,
+	})))
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+
+	for i := 0; i < 5; i++ {
+		counter, err := provider.Meter("test").Int64Counter(fmt.Sprintf("counter_%d_total", i))
+		require.NoError(t, err)
+		counter.Add(context.Background(), 1)
+	}
+	require.NoError(t, provider.ForceFlush(context.Background()))
+	require.Equal(t, []int{2, 2, 1}, exporter.exported())
+}
+
+func TestSplitMetrics_KeepsScopes(t *testing.T) {
+	rm := &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{
+		{Metrics: []metricdata.Metrics{{Name: "a1"}, {Name: "a2"}, {Name: "a3"}}},
+		{Metrics: []metricdata.Metrics{{Name: "b1"}}},
+	}}
+	rm.ScopeMetrics[0].Scope.Name = "a"
+	rm.ScopeMetrics[1].Scope.Name = "b"
+
+	batches := splitMetrics(rm, 2)
+	require.Len(t, batches, 2)
+	require.Len(t, batches[0].ScopeMetrics, 1)
+	require.Equal(t, "a", batches[0].ScopeMetrics[0].Scope.Name)
+	require.Len(t, batches[1].ScopeMetrics, 2, "a batch may span scopes")
+	require.Equal(t, "a3", batches[1].ScopeMetrics[0].Metrics[0].Name)
+	require.Equal(t, "b", batches[1].ScopeMetrics[1].Scope.Name)
+
+	require.Len(t, splitMetrics(&metricdata.ResourceMetrics{}, 2), 1, "empty collections are still exported")
+}
+
+func TestNewOTLPMetricExporter(t *testing.T) {
+	var pushes atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/metrics" {
+			pushes.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	exporter, err := NewOTLPMetricExporter(context.Background(), "")
+	require.NoError(t, err)
+	require.Nil(t, exporter, "no endpoint disables pushing")
+
+	_, err = NewOTLPMetricExporter(context.Background(), "collector:4318")
+	require.Error(t, err)
+
+	exporter, err = NewOTLPMetricExporter(context.Background(), collector.URL)
+	require.NoError(t, err)
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(newPeriodicReader(MetricExport{Exporter: exporter})))
+	counter, err := provider.Meter("test").Int64Counter("requests_total")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 1)
+
+	// Shutting down pushes the last collection
+	require.NoError(t, provider.Shutdown(context.Background()))
+	require.Equal(t, int32(1), pushes.Load())
+}
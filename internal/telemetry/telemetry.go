@@ -1,21 +1,35 @@
 package telemetry
 
 import (
+	"context"
+	"errors"
+
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 // Telemetry handles OpenTelemetry initialization and metrics
 type Telemetry struct {
 	Meter  metric.Meter
-	logger *zap.Logger
+	Tracer trace.Tracer
+
+	// MetricsNamespace is prepended to every instrument name, e.g. "guardz" yields "guardz_http_requests_total"
+	MetricsNamespace string
+
+	meterProvider  *sdkmetric.MeterProvider
+	tracerProvider *sdktrace.TracerProvider
+	logger         *zap.Logger
 }
 
-// New initializes OpenTelemetry with Prometheus exporter
-func NewTelemetry(logger *zap.Logger) (*Telemetry, error) {
+// New initializes OpenTelemetry with Prometheus exporter. Metrics are also pushed to the
+// exporter of every export given.
+func NewTelemetry(logger *zap.Logger, exports ...MetricExport) (*Telemetry, error) {
 	logger = logger.Named("telemetry")
 
 	// Initialize Prometheus exporter
@@ -25,9 +39,17 @@ func NewTelemetry(logger *zap.Logger) (*Telemetry, error) {
 	}
 
 	// Create meter provider
-	provider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(exporter),
-	)
+	opts := []sdkmetric.Option{sdkmetric.WithReader(exporter)}
+	for _, export := range exports {
+		if export.Exporter == nil {
+			continue
+		}
+		opts = append(opts, sdkmetric.WithReader(newPeriodicReader(export)))
+		logger.Info("OpenTelemetry metrics pushed to exporter",
+			zap.Duration("interval", export.Interval),
+			zap.Int("batch_size", export.BatchSize))
+	}
+	provider := sdkmetric.NewMeterProvider(opts...)
 	otel.SetMeterProvider(provider)
 
 	logger.Info("OpenTelemetry metrics initialized with Prometheus exporter")
@@ -36,7 +58,66 @@ func NewTelemetry(logger *zap.Logger) (*Telemetry, error) {
 	meter := otel.GetMeterProvider().Meter("guardz")
 
 	return &Telemetry{
-		Meter:  meter,
-		logger: logger,
+		Meter:         meter,
+		Tracer:        otel.Tracer("guardz"),
+		meterProvider: provider,
+		logger:        logger,
 	}, nil
 }
+
+// SetupTracing installs a tracer provider that samples the given ratio of new traces.
+// Spans are exported to exporter when one is provided.
+func (t *Telemetry) SetupTracing(sampleRatio float64, exporter sdktrace.SpanExporter) {
+	t.tracerProvider = NewTracerProvider(sampleRatio, exporter)
+	otel.SetTracerProvider(t.tracerProvider)
+	t.Tracer = t.tracerProvider.Tracer("guardz")
+
+	t.logger.Info("OpenTelemetry tracing initialized",
+		zap.Float64("sample_ratio", sampleRatio),
+		zap.Bool("exporter_configured", exporter != nil))
+}
+
+// Shutdown pushes the last metrics to the metric exporters and flushes and stops the tracer
+// provider if tracing was set up
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	var errs []error
+	if t.meterProvider != nil {
+		errs = append(errs, t.meterProvider.Shutdown(ctx))
+	}
+	if t.tracerProvider != nil {
+		errs = append(errs, t.tracerProvider.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// MetricName prefixes name with namespace, leaving it unchanged when namespace is empty
+func MetricName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "_" + name
+}
+
+// NewTracerProvider creates a tracer provider with a ratio-based sampler.
+// Child spans follow their parent's sampling decision.
+func NewTracerProvider(sampleRatio float64, exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// NewOTLPSpanExporter creates an exporter sending spans over OTLP/HTTP to endpoint, a URL such
+// as http://collector:4318. An empty endpoint returns a nil exporter, which keeps spans in process.
+func NewOTLPSpanExporter(ctx context.Context, endpoint string) (sdktrace.SpanExporter, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	if err := checkOTLPEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	return otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+}
@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewTracerProvider_Sampling(t *testing.T) {
+	testCases := []struct {
+		name          string
+		ratio         float64
+		expectedSpans int
+	}{
+		{name: "ratio 0 exports nothing", ratio: 0, expectedSpans: 0},
+		{name: "ratio 1 exports every span", ratio: 1, expectedSpans: 10},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			exporter := tracetest.NewInMemoryExporter()
+			tp := NewTracerProvider(tc.ratio, exporter)
+
+			tracer := tp.Tracer("test")
+			for i := 0; i < 10; i++ {
+				_, span := tracer.Start(ctx, "request")
+				span.End()
+			}
+			require.NoError(t, tp.ForceFlush(ctx))
+			require.Len(t, exporter.GetSpans(), tc.expectedSpans)
+			require.NoError(t, tp.Shutdown(ctx))
+		})
+	}
+}
+
+func TestNewOTLPSpanExporter(t *testing.T) {
+	var exports atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+			exports.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	exporter, err := NewOTLPSpanExporter(context.Background(), "")
+	require.NoError(t, err)
+	require.Nil(t, exporter, "no endpoint keeps spans in process")
+
+	_, err = NewOTLPSpanExporter(context.Background(), "collector:4318")
+	require.Error(t, err)
+
+	exporter, err = NewOTLPSpanExporter(context.Background(), collector.URL)
+	require.NoError(t, err)
+	tp := NewTracerProvider(1, exporter)
+	_, span := tp.Tracer("test").Start(context.Background(), "request")
+	span.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+	require.Equal(t, int32(1), exports.Load())
+}
+
+func TestMetricName(t *testing.T) {
+	require.Equal(t, "http_requests_total", MetricName("", "http_requests_total"))
+	require.Equal(t, "guardz_http_requests_total", MetricName("guardz", "http_requests_total"))
+}